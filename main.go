@@ -3,7 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/lonegunmanb/avmfix/pkg"
 )
@@ -11,23 +13,114 @@ import (
 const (
 	folderFlag      = "folder"
 	excludeFlag     = "exclude"
+	includeFlag     = "include"
+	checkFlag       = "check"
+	diffFlag        = "diff"
+	recursiveFlag   = "recursive"
+	offlineFlag     = "offline"
+	mirrorFlag      = "provider-mirror"
+	cacheFlag       = "schema-cache-dir"
+	sourcesFlag     = "schema-sources"
+	registryFlag    = "registry-url"
+	unlockedFlag    = "allow-unlocked-providers"
+	schemaFileFlag  = "schema-file"
+	initFlag        = "init"
+	initBinaryFlag  = "init-binary"
+	failSoftFlag    = "fail-soft"
+	reportFlag      = "report"
+	reportFileFlag  = "report-file"
+	configFlag      = "config"
+	enableFlag      = "enable-rules"
+	disableFlag     = "disable-rules"
+	listRulesFlag   = "list-rules"
+	variablesFlag   = "variables-file"
+	outputsFlag     = "outputs-file"
 	helpFlag        = "help"
 	
 	folderUsage     = "The folder path to scan and apply fixes"
-	excludeUsage    = "Glob matching pattern to exclude files/folders from processing"
+	excludeUsage    = "Glob matching paths relative to the folder to exclude from processing, repeatable, a pattern starting with ! re-includes paths"
+	includeUsage    = "Glob matching paths relative to the folder to process, repeatable, only matching files are processed if set"
+	checkUsage      = "Report files that need fixes without writing them, exit with non-zero code if there is any"
+	diffUsage       = "Print a unified diff of the proposed fixes without writing them"
+	recursiveUsage  = "Process every nested folder containing .tf files as a separated module"
+	offlineUsage    = "Forbid network calls, init never runs and providers are resolved from .terraform/providers and the provider mirror only"
+	mirrorUsage     = "Filesystem mirror folder to search for provider binaries before the registry"
+	cacheUsage      = "Folder to persist provider schemas in, set it to empty string to disable the cache"
+	sourcesUsage    = "Comma-separated order to resolve provider schemas in, sources not listed are never used: cache, providers, mirror, registry (default all, in this order)"
+	registryUsage   = "Base URL of the provider registry download API, e.g. an Artifactory remote repository, https://registry.opentofu.org/v1/providers by default"
+	unlockedUsage   = "Allow downloading providers without hashes in .terraform.lock.hcl, they're only checked against the shasum reported by the registry"
+	schemaFileUsage = "Output file of 'terraform providers schema -json' to read provider schemas from, instead of running provider binaries"
+	initUsage       = "When to run init before fixing a folder: always (default, auto with -check or -diff), never, or auto (only when the lock file or modules.json is missing or stale)"
+	initBinaryUsage = "The executable running init, e.g. terraform (default) or tofu"
+	failSoftUsage   = "Leave blocks whose schema cannot be resolved untouched and print them as warnings, instead of failing"
+	reportUsage     = "Write a machine-readable report of the fixes, json or sarif"
+	reportFileUsage = "File to write the report into, the report is written to stdout if it's empty"
+	configUsage     = "Config file, .avmfix.hcl or .avmfix.yaml in the folder or its parents is used if it's not set"
+	enableUsage     = "Comma-separated rule ids to enable, overriding the config file"
+	disableUsage    = "Comma-separated rule ids to disable, overriding the config file"
+	listRulesUsage  = "List all rules and exit"
+	variablesUsage  = "The file variables are moved into, variables.tf by default"
+	outputsUsage    = "The file outputs are moved into, outputs.tf by default"
 	helpUsage       = "Show help information"
 	
 	errorMessage    = "Error during processing:"
 	successMessage  = "Processing completed successfully"
+	checkMessage    = "file(s) need to be fixed by avmfix"
+	failedMessage   = "folder(s) failed"
+	warningMessage  = "Warning:"
 )
 
 func main() {
 	var dirPath string
-	var excludePattern string
+	var excludePatterns listFlag
+	var includePatterns listFlag
+	var check bool
+	var diff bool
+	var recursive bool
+	var offline bool
+	var providerMirror string
+	var schemaCacheDir string
+	var schemaSources string
+	var registryURL string
+	var allowUnlocked bool
+	var schemaFile string
+	var initMode string
+	var initBinary string
+	var failSoft bool
+	var report string
+	var reportFile string
+	var configFile string
+	var enableRules string
+	var disableRules string
+	var listRules bool
+	var variablesFile string
+	var outputsFile string
 	var showHelp bool
 
 	flag.StringVar(&dirPath, folderFlag, "", folderUsage)
-	flag.StringVar(&excludePattern, excludeFlag, "", excludeUsage)
+	flag.Var(&excludePatterns, excludeFlag, excludeUsage)
+	flag.Var(&includePatterns, includeFlag, includeUsage)
+	flag.BoolVar(&check, checkFlag, false, checkUsage)
+	flag.BoolVar(&diff, diffFlag, false, diffUsage)
+	flag.BoolVar(&recursive, recursiveFlag, false, recursiveUsage)
+	flag.BoolVar(&offline, offlineFlag, false, offlineUsage)
+	flag.StringVar(&providerMirror, mirrorFlag, "", mirrorUsage)
+	flag.StringVar(&schemaCacheDir, cacheFlag, pkg.DefaultSchemaCacheDir(), cacheUsage)
+	flag.StringVar(&schemaSources, sourcesFlag, "", sourcesUsage)
+	flag.StringVar(&registryURL, registryFlag, "", registryUsage)
+	flag.BoolVar(&allowUnlocked, unlockedFlag, false, unlockedUsage)
+	flag.StringVar(&schemaFile, schemaFileFlag, "", schemaFileUsage)
+	flag.StringVar(&initMode, initFlag, "", initUsage)
+	flag.StringVar(&initBinary, initBinaryFlag, "", initBinaryUsage)
+	flag.BoolVar(&failSoft, failSoftFlag, false, failSoftUsage)
+	flag.StringVar(&report, reportFlag, "", reportUsage)
+	flag.StringVar(&reportFile, reportFileFlag, "", reportFileUsage)
+	flag.StringVar(&configFile, configFlag, "", configUsage)
+	flag.StringVar(&enableRules, enableFlag, "", enableUsage)
+	flag.StringVar(&disableRules, disableFlag, "", disableUsage)
+	flag.BoolVar(&listRules, listRulesFlag, false, listRulesUsage)
+	flag.StringVar(&variablesFile, variablesFlag, "", variablesUsage)
+	flag.StringVar(&outputsFile, outputsFlag, "", outputsUsage)
 	flag.BoolVar(&showHelp, helpFlag, false, helpUsage)
 	
 	flag.Usage = func() {
@@ -36,6 +129,12 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s --folder /path/to/terraform/files \n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --folder /path/to/terraform/files --exclude '**/test_*.tf'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --folder /path/to/terraform/files --exclude 'legacy_*.tf' --exclude '!legacy_keep.tf' --include 'generated/**'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --folder /path/to/terraform/files --check\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --folder /path/to/terraform/files --diff\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --folder /path/to/terraform/repo --recursive --exclude 'examples/legacy'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --folder /path/to/terraform/files --check --report sarif --report-file avmfix.sarif\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --folder /path/to/terraform/files --disable-rules variable-file-placement,output-file-placement\n", os.Args[0])
 	}
 	
 	flag.Parse()
@@ -45,16 +144,164 @@ func main() {
 		return
 	}
 
+	if listRules {
+		for _, rule := range pkg.Rules() {
+			fmt.Printf("%-26s %s\n", rule.ID, rule.Description)
+		}
+		return
+	}
+
 	if dirPath == "" {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	err := pkg.DirectoryAutoFix(dirPath, excludePattern)
+	// An empty mode leaves the decision to the config file.
+	var mode pkg.InitMode
+	var err error
+	if initMode != "" {
+		if mode, err = pkg.ParseInitMode(initMode); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", errorMessage, err)
+			os.Exit(1)
+		}
+	}
+
+	var format pkg.ReportFormat
+	if report != "" {
+		if format, err = pkg.ParseReportFormat(report); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", errorMessage, err)
+			os.Exit(1)
+		}
+		if reportFile == "" {
+			// Keep stdout for the report only.
+			stdout = os.Stderr
+		}
+	}
+
+	result, err := pkg.Run(dirPath, pkg.Options{
+		ExcludePatterns:        excludePatterns,
+		IncludePatterns:        includePatterns,
+		Recursive:              recursive,
+		DryRun:                 check || diff,
+		Offline:                offline,
+		ProviderMirror:         providerMirror,
+		SchemaCacheDir:         schemaCacheDir,
+		SchemaSources:          splitList(schemaSources),
+		RegistryURL:            registryURL,
+		AllowUnlockedProviders: allowUnlocked,
+		SchemaFile:             schemaFile,
+		Init:                   mode,
+		InitBinary:             initBinary,
+		FailSoft:               failSoft,
+		ConfigFile:             configFile,
+		EnabledRules:           splitList(enableRules),
+		DisabledRules:          splitList(disableRules),
+		VariablesFile:          variablesFile,
+		OutputsFile:            outputsFile,
+	})
+	// The provider plugins must be stopped before any os.Exit below.
+	pkg.Cleanup()
+	if result != nil {
+		if result.ConfigFile != "" {
+			fmt.Fprintf(stdout, "config %s\n", result.ConfigFile)
+		}
+		printDirectories(result)
+		printWarnings(result.Warnings)
+		if format != "" {
+			writeReport(format, reportFile, result, dirPath)
+		}
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s %v\n", errorMessage, err)
 		os.Exit(1)
 	}
+	if check || diff {
+		printChanges(result.Changes, check, diff)
+		return
+	}
 
-	fmt.Println(successMessage)
+	fmt.Fprintln(stdout, successMessage)
+}
+
+// listFlag collects the values of a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func splitList(list string) []string {
+	var r []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			r = append(r, item)
+		}
+	}
+	return r
+}
+
+// stdout receives the human-readable output, it's redirected to stderr when the report is written to stdout.
+var stdout io.Writer = os.Stdout
+
+func writeReport(format pkg.ReportFormat, reportFile string, result *pkg.Result, dirPath string) {
+	w := io.Writer(os.Stdout)
+	if reportFile != "" {
+		f, err := os.Create(reportFile) // #nosec G304
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", errorMessage, err)
+			os.Exit(1)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+	if err := pkg.WriteReport(w, format, result, dirPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%s %v\n", errorMessage, err)
+		os.Exit(1)
+	}
+}
+
+func printDirectories(result *pkg.Result) {
+	for _, d := range result.Directories {
+		if d.Err != nil {
+			fmt.Fprintf(os.Stderr, "FAILED %s (init: %s): %v\n", d.Path, d.Init, d.Err)
+			continue
+		}
+		fmt.Fprintf(stdout, "ok     %s (init: %s)\n", d.Path, d.Init)
+	}
+	if failed := result.Failed(); len(failed) > 0 {
+		fmt.Fprintf(os.Stderr, "%d/%d %s\n", len(failed), len(result.Directories), failedMessage)
+	}
+}
+
+func printWarnings(warnings []pkg.Warning) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "%s %s\n", warningMessage, w)
+	}
+}
+
+func printChanges(changes []pkg.FileChange, check, diff bool) {
+	for _, change := range changes {
+		if !diff {
+			fmt.Fprintln(stdout, change.Path)
+			continue
+		}
+		d, err := change.UnifiedDiff()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", errorMessage, err)
+			os.Exit(1)
+		}
+		fmt.Fprint(stdout, d)
+	}
+	if check && len(changes) > 0 {
+		fmt.Fprintf(os.Stderr, "%d %s\n", len(changes), checkMessage)
+		os.Exit(1)
+	}
+	fmt.Fprintln(stdout, successMessage)
 }
@@ -3,3 +3,9 @@ package pkg
 type AutoFixBlock interface {
 	AutoFix() error
 }
+
+// singleRuleBlock is implemented by the AutoFixBlocks applying a single rule, the rule is recorded when their fix changes the block.
+// The other blocks record the rules they apply themselves.
+type singleRuleBlock interface {
+	rule() string
+}
@@ -21,8 +21,9 @@ type blockWithSchema interface {
 }
 
 type providerBlock interface {
-	getProviderNamespace() string
+	getProvider() providerAddress
 	getProviderVersion() string
+	getSchemaGetter() SchemaGetter
 }
 
 type rootBlock interface {
@@ -0,0 +1,205 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the config files discovered in the target folder or its parents, in order of precedence.
+var configFileNames = []string{".avmfix.hcl", ".avmfix.yaml", ".avmfix.yml"}
+
+// Config is the content of an avmfix config file, e.g.
+//
+//	exclude        = ["examples/legacy/**"]
+//	init           = "auto"
+//	variables_file = "variables.tf"
+//
+//	rule "variable-file-placement" {
+//	  enabled = false
+//	}
+//
+// Exclude and Include are relative to the folder containing the config file.
+type Config struct {
+	Exclude       []string     `hcl:"exclude,optional"`
+	Include       []string     `hcl:"include,optional"`
+	Init          string       `hcl:"init,optional"`
+	InitBinary    string       `hcl:"init_binary,optional"`
+	VariablesFile string       `hcl:"variables_file,optional"`
+	OutputsFile   string       `hcl:"outputs_file,optional"`
+	Rules         []RuleConfig `hcl:"rule,block"`
+}
+
+// RuleConfig toggles a rule, the rule keeps its default state if `enabled` is omitted.
+type RuleConfig struct {
+	ID      string `hcl:"id,label"`
+	Enabled *bool  `hcl:"enabled,optional"`
+}
+
+// yamlConfig is the YAML form of Config, rules are a map from rule id to enabled, e.g. `variable-nullable: false`.
+type yamlConfig struct {
+	Exclude       []string        `yaml:"exclude"`
+	Include       []string        `yaml:"include"`
+	Init          string          `yaml:"init"`
+	InitBinary    string          `yaml:"init_binary"`
+	VariablesFile string          `yaml:"variables_file"`
+	OutputsFile   string          `yaml:"outputs_file"`
+	Rules         map[string]bool `yaml:"rules"`
+}
+
+// LoadConfig reads the avmfix config file, files ending with `.yaml` or `.yml` are read as YAML, others as HCL.
+func LoadConfig(path string) (*Config, error) {
+	content, err := afero.ReadFile(Fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	var config *Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		config, err = parseYamlConfig(content)
+	default:
+		config, err = parseHclConfig(path, content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+func parseHclConfig(path string, content []byte) (*Config, error) {
+	f, diags := hclsyntax.ParseConfig(content, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	config := &Config{}
+	if diags = gohcl.DecodeBody(f.Body, nil, config); diags.HasErrors() {
+		return nil, diags
+	}
+	return config, nil
+}
+
+func parseYamlConfig(content []byte) (*Config, error) {
+	var c yamlConfig
+	// Unknown keys are rejected like unsupported arguments in the HCL config, a typo must not be silently ignored.
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	config := &Config{
+		Exclude:       c.Exclude,
+		Include:       c.Include,
+		Init:          c.Init,
+		InitBinary:    c.InitBinary,
+		VariablesFile: c.VariablesFile,
+		OutputsFile:   c.OutputsFile,
+	}
+	var ids []string
+	for id := range c.Rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		enabled := c.Rules[id]
+		config.Rules = append(config.Rules, RuleConfig{ID: id, Enabled: &enabled})
+	}
+	return config, nil
+}
+
+// FindConfig looks for a config file in the folder, then its parents, and returns the first one found.
+// An empty string is returned if there is none.
+func FindConfig(dirPath string) (string, error) {
+	dir, err := filepath.Abs(dirPath)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range configFileNames {
+			path := filepath.Join(dir, name)
+			exists, err := afero.Exists(Fs, path)
+			if err != nil {
+				return "", err
+			}
+			if exists {
+				return path, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// applyConfig fills the options that haven't been set by the caller from the config, the caller's options take precedence.
+// base is the target folder relative to the config file's folder, the exclude and include patterns of the config are relative to it.
+func (opts Options) applyConfig(config *Config, base string) (Options, error) {
+	if config == nil {
+		return opts, nil
+	}
+	if opts.ExcludePattern == "" && len(opts.ExcludePatterns) == 0 {
+		opts.ExcludePatterns = config.Exclude
+		opts.excludeBase = base
+	}
+	if len(opts.IncludePatterns) == 0 {
+		opts.IncludePatterns = config.Include
+		opts.includeBase = base
+	}
+	if opts.Init == "" && config.Init != "" {
+		mode, err := ParseInitMode(config.Init)
+		if err != nil {
+			return opts, err
+		}
+		opts.Init = mode
+	}
+	if opts.InitBinary == "" {
+		opts.InitBinary = config.InitBinary
+	}
+	if opts.VariablesFile == "" {
+		opts.VariablesFile = config.VariablesFile
+	}
+	if opts.OutputsFile == "" {
+		opts.OutputsFile = config.OutputsFile
+	}
+	return opts, nil
+}
+
+// configBase returns the target folder relative to the config file's folder, slash separated.
+// It's empty if the config file isn't in the target folder or one of its parents, then the patterns are relative to the target folder.
+func configBase(configFile, dirPath string) (string, error) {
+	configDir, err := filepath.Abs(filepath.Dir(configFile))
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.Abs(dirPath)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(configDir, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// checkFileName makes sure the custom variables or outputs file is a `.tf` or `.tofu` file in the module folder.
+func checkFileName(kind, name string) error {
+	if name == "" {
+		return nil
+	}
+	if filepath.Base(name) != name || !(strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tofu")) {
+		return fmt.Errorf("%s file %q must be a .tf or .tofu file name without folder", kind, name)
+	}
+	return nil
+}
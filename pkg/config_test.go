@@ -0,0 +1,207 @@
+package pkg_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindConfigShouldDiscoverConfigInParents(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/.avmfix.yaml":           "init: never\n",
+		"/repo/modules/a/main.tf":      unsortedLocals,
+		"/repo/modules/.avmfix.hcl":    `init = "auto"`,
+		"/repo/examples/basic/main.tf": unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	path, err := pkg.FindConfig("/repo/modules/a")
+	require.NoError(t, err)
+	assert.Equal(t, "/repo/modules/.avmfix.hcl", path)
+	path, err = pkg.FindConfig("/repo/examples/basic")
+	require.NoError(t, err)
+	assert.Equal(t, "/repo/.avmfix.yaml", path)
+	path, err = pkg.FindConfig("/other")
+	require.NoError(t, err)
+	assert.Empty(t, path)
+}
+
+func TestLoadConfigShouldReadHclAndYaml(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/.avmfix.hcl": `exclude        = ["examples/**", "*.auto.tf"]
+init           = "auto"
+init_binary    = "tofu"
+variables_file = "vars.tf"
+outputs_file   = "outs.tf"
+
+rule "variable-nullable" {
+  enabled = false
+}
+`,
+		"/.avmfix.yaml": `exclude:
+  - examples/**
+  - "*.auto.tf"
+init: auto
+init_binary: tofu
+variables_file: vars.tf
+outputs_file: outs.tf
+rules:
+  variable-nullable: false
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	disabled := false
+	expected := &pkg.Config{
+		Exclude:       []string{"examples/**", "*.auto.tf"},
+		Init:          "auto",
+		InitBinary:    "tofu",
+		VariablesFile: "vars.tf",
+		OutputsFile:   "outs.tf",
+		Rules: []pkg.RuleConfig{
+			{ID: "variable-nullable", Enabled: &disabled},
+		},
+	}
+	for _, path := range []string{"/.avmfix.hcl", "/.avmfix.yaml"} {
+		config, err := pkg.LoadConfig(path)
+		require.NoError(t, err, path)
+		assert.Equal(t, expected, config, path)
+	}
+}
+
+func TestLoadConfigShouldRejectUnknownKeys(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/.avmfix.hcl":  "variable_file = \"vars.tf\"\n",
+		"/.avmfix.yaml": "variable_file: vars.tf\n",
+		"/.avmfix.yml":  "",
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	for _, path := range []string{"/.avmfix.hcl", "/.avmfix.yaml"} {
+		_, err := pkg.LoadConfig(path)
+		require.Error(t, err, path)
+		assert.Contains(t, err.Error(), "variable_file", path)
+	}
+	config, err := pkg.LoadConfig("/.avmfix.yml")
+	require.NoError(t, err)
+	assert.Equal(t, &pkg.Config{}, config)
+}
+
+func TestRunShouldApplyDiscoveredConfig(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/.avmfix.hcl": `exclude        = ["legacy.tf"]
+variables_file = "vars.tf"
+`,
+		"/repo/module/main.tf":   unsortedLocals + "\n" + nullableVariable,
+		"/repo/module/legacy.tf": unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/repo/module", pkg.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "/repo/.avmfix.hcl", result.ConfigFile)
+	content, err := afero.ReadFile(mockFs, "/repo/module/vars.tf")
+	require.NoError(t, err)
+	assert.Equal(t, `variable "name" {
+  type = string
+}`, strings.TrimSpace(string(content)))
+	content, err = afero.ReadFile(mockFs, "/repo/module/legacy.tf")
+	require.NoError(t, err)
+	assert.Equal(t, unsortedLocals, string(content))
+}
+
+func TestRunShouldMatchConfigPatternsRelativeToConfigFolder(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/.avmfix.hcl": `exclude = ["modules/a/legacy.tf", "modules/b", "/main.tf"]
+include = ["modules/a/**"]
+`,
+		"/repo/modules/a/main.tf":   unsortedLocals,
+		"/repo/modules/a/legacy.tf": unsortedLocals,
+		"/repo/modules/b/main.tf":   unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/repo/modules/a", pkg.Options{})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/repo/modules/a/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, formatHcl(sortedLocals), formatHcl(string(content)))
+	content, err = afero.ReadFile(mockFs, "/repo/modules/a/legacy.tf")
+	require.NoError(t, err)
+	assert.Equal(t, unsortedLocals, string(content))
+
+	_, err = pkg.Run("/repo/modules/b", pkg.Options{})
+	require.NoError(t, err)
+	content, err = afero.ReadFile(mockFs, "/repo/modules/b/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, unsortedLocals, string(content))
+}
+
+func TestRunOptionsShouldTakePrecedenceOverConfig(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/.avmfix.hcl": `exclude        = ["legacy.tf"]
+variables_file = "vars.tf"
+`,
+		"/repo/module/main.tf":   unsortedLocals + "\n" + nullableVariable,
+		"/repo/module/legacy.tf": unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/repo/module", pkg.Options{
+		ExcludePattern: "none.tf",
+		VariablesFile:  "inputs.tf",
+	})
+	require.NoError(t, err)
+	exists, err := afero.Exists(mockFs, "/repo/module/inputs.tf")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = afero.Exists(mockFs, "/repo/module/vars.tf")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	content, err := afero.ReadFile(mockFs, "/repo/module/legacy.tf")
+	require.NoError(t, err)
+	assert.Equal(t, formatHcl(sortedLocals), formatHcl(string(content)))
+}
+
+func TestRunWithInvalidVariablesFileShouldReturnError(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{
+		VariablesFile: "../variables.tf",
+	})
+	assert.ErrorContains(t, err, "must be a .tf or .tofu file name without folder")
+}
+
+func TestRunWithTofuVariablesFileShouldMoveVariablesIntoIt(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": nullableVariable,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{
+		VariablesFile: "variables.tofu",
+		OutputsFile:   "outputs.tofu",
+	})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/variables.tofu")
+	require.NoError(t, err)
+	assert.Equal(t, `variable "name" {
+  type = string
+}`, strings.TrimSpace(string(content)))
+}
@@ -1,15 +1,16 @@
 package pkg
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	"github.com/gobwas/glob"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/spf13/afero"
@@ -17,18 +18,25 @@ import (
 
 var Fs = afero.NewOsFs()
 
-func DirectoryAutoFix(dirPath string, excludePattern ...string) error {
-	pattern := ""
-	if len(excludePattern) > 0 {
-		pattern = excludePattern[0]
+func (d *directory) run() error {
+	// The folder's lock file and `.terraform/providers` are set on a fork of the plugin server, so they never apply to other folders.
+	if s, ok := d.schemaGetter().(*Server); ok {
+		d.schemas = s.fork()
 	}
-	d := newDirectory(dirPath, pattern)
 	if err := d.ensureModules(); err != nil {
 		return err
 	}
 	if err := d.parseTerraformLockFile(); err != nil {
 		return fmt.Errorf("failed to parse .terraform.lock.hcl: %w", err)
 	}
+	if err := d.loadRequiredProviders(); err != nil {
+		return fmt.Errorf("failed to read required_providers: %w", err)
+	}
+	if err := d.addProviderHashes(); err != nil {
+		return fmt.Errorf("failed to parse .terraform.lock.hcl: %w", err)
+	}
+	d.addLocalProviders()
+	d.prefetchProviders()
 	// variables and outputs files might move blocks into main.tf without fix, so we need run AutoFix twice
 	for i := 0; i < 2; i++ {
 		if err := d.AutoFix(); err != nil {
@@ -44,10 +52,27 @@ type fileMode interface {
 
 type directory struct {
 	path             string
-	excludeGlob      glob.Glob
+	root             string
+	fs               afero.Fs
+	initMode         InitMode
+	initBinary       string
+	initReport       string
+	offline          bool
+	failSoft         bool
+	disabledRules    map[string]bool
+	warnings         []Warning
+	filter           *pathFilter
+	variablesFile    string
+	outputsFile      string
 	tfFiles          map[string]*HclFile
 	dirEntries       map[string]fileMode
 	providerVersions map[string]map[string]string
+	// requiredProviders maps the local names in `required_providers` to the source addresses.
+	requiredProviders map[string]providerAddress
+	// schemas resolves the provider schemas, e.g. from the file passed as Options.SchemaFile, see schemaGetter.
+	schemas SchemaGetter
+	// fixes are the rules applied to the blocks, see recordFix.
+	fixes map[fixKey][]string
 }
 
 func (d *directory) AutoFix() error {
@@ -67,7 +92,120 @@ func (d *directory) AutoFix() error {
 	return nil
 }
 
+// changes compares the files in d.fs with the ones in Fs and returns the differences, sorted by path.
+func (d *directory) changes() ([]FileChange, error) {
+	var names []string
+	for name := range d.tfFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var r []FileChange
+	for _, name := range names {
+		path := filepath.Join(d.path, name)
+		fixed, err := afero.ReadFile(d.fs, path)
+		if err != nil {
+			return nil, err
+		}
+		exist, err := afero.Exists(Fs, path)
+		if err != nil {
+			return nil, err
+		}
+		var original []byte
+		if exist {
+			if original, err = afero.ReadFile(Fs, path); err != nil {
+				return nil, err
+			}
+		}
+		if exist && bytes.Equal(original, fixed) {
+			continue
+		}
+		r = append(r, FileChange{
+			Path:     path,
+			Original: original,
+			Fixed:    fixed,
+			root:     d.root,
+		})
+	}
+	return r, nil
+}
+
+// commit writes the staged changes to Fs. Every file is written into a temp file in the same folder first,
+// then all temp files are renamed to their targets. If a rename fails, the files already renamed are restored from
+// their original content, and the files created by the commit are removed, so a failed write leaves no file touched.
+func (d *directory) commit(changes []FileChange) error {
+	staged := make(map[string]string, len(changes))
+	cleanup := func() {
+		for _, tmp := range staged {
+			_ = Fs.Remove(tmp)
+		}
+	}
+	for _, change := range changes {
+		tmp, err := d.stage(change)
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to stage %s: %w", change.Path, err)
+		}
+		staged[change.Path] = tmp
+	}
+	for i, change := range changes {
+		if err := Fs.Rename(staged[change.Path], change.Path); err != nil {
+			cleanup()
+			err = fmt.Errorf("failed to write %s: %w", change.Path, err)
+			return errors.Join(err, d.rollback(changes[:i]))
+		}
+		delete(staged, change.Path)
+	}
+	return nil
+}
+
+// rollback restores the committed files to their original content, the files that didn't exist are removed.
+func (d *directory) rollback(committed []FileChange) error {
+	var errs []error
+	for _, change := range committed {
+		if change.Original == nil {
+			if err := Fs.Remove(change.Path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove %s: %w", change.Path, err))
+			}
+			continue
+		}
+		tmp, err := d.stage(FileChange{Path: change.Path, Original: change.Original, Fixed: change.Original})
+		if err == nil {
+			if err = Fs.Rename(tmp, change.Path); err != nil {
+				_ = Fs.Remove(tmp)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", change.Path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *directory) stage(change FileChange) (string, error) {
+	mode := os.FileMode(0644)
+	if entry, ok := d.dirEntries[d.fileKey(change.Path)]; ok && change.Original != nil {
+		mode = entry.Mode()
+	}
+	tmp, err := afero.TempFile(Fs, filepath.Dir(change.Path), "."+filepath.Base(change.Path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(change.Fixed)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = Fs.Chmod(tmp.Name(), mode)
+	}
+	if err != nil {
+		_ = Fs.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
 func (d *directory) AppendBlockToFile(destFileName string, block *HclBlock) {
+	destFileName = d.effectiveFileName(destFileName)
 	if err := d.ensureDestFile(destFileName); err != nil {
 		return
 	}
@@ -78,13 +216,21 @@ func (d *directory) AppendBlockToFile(destFileName string, block *HclBlock) {
 		hclFile.appendNewline()
 	}
 	hclFile.appendBlock(block)
+	// Re-parse the destination so its syntax tree contains the appended block too, otherwise a later AutoFix on it would see mismatched bodies.
+	if reparsed, diags := ParseConfig(hclFile.WriteFile.Bytes(), hclFile.FileName); !diags.HasErrors() {
+		reparsed.dir = d
+		*hclFile = *reparsed
+	}
 	_ = d.writeFileToDisk(hclFile)
 }
 
 func (d *directory) writeFileToDisk(hclFile *HclFile) error {
-	baseName := filepath.Base(hclFile.FileName)
-	mode := d.dirEntries[baseName].Mode()
-	err := afero.WriteFile(Fs, hclFile.FileName, hclFile.WriteFile.Bytes(), mode)
+	mode := d.dirEntries[d.fileKey(hclFile.FileName)].Mode()
+	content, err := hclFile.content()
+	if err != nil {
+		return err
+	}
+	err = afero.WriteFile(d.fs, hclFile.FileName, content, mode)
 	if err != nil {
 		return err
 	}
@@ -92,43 +238,102 @@ func (d *directory) writeFileToDisk(hclFile *HclFile) error {
 }
 
 func (d *directory) loadTfFiles() error {
-	files, err := afero.ReadDir(Fs, d.path)
+	if err := d.loadFiles(""); err != nil {
+		return err
+	}
+	// Test files could be in the `tests` folder too.
+	exists, err := afero.DirExists(d.fs, filepath.Join(d.path, testFilesDir))
+	if err != nil || !exists {
+		return err
+	}
+	return d.loadFiles(testFilesDir)
+}
+
+// loadFiles loads the files in the sub folder of the module folder, or the module folder itself if subDir is empty.
+// Only test files are loaded from a sub folder. The files are keyed by their paths relative to the module folder.
+func (d *directory) loadFiles(subDir string) error {
+	files, err := afero.ReadDir(d.fs, filepath.Join(d.path, subDir))
 	if err != nil {
 		return err
 	}
+	shadowed := shadowedFiles(fileNames(files))
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".tf") {
-			// Check if file should be excluded
-			if d.shouldExclude(file.Name()) {
-				continue
-			}
-			
-			path := filepath.Join(d.path, file.Name())
-			content, err := afero.ReadFile(Fs, path)
-			if err != nil {
-				return err
-			}
+		name := filepath.Join(subDir, file.Name())
+		if file.IsDir() || shadowed[file.Name()] || !isTestFile(name) && (subDir != "" || !isConfigFile(name) && !isQueryFile(name)) {
+			continue
+		}
+		// Check if file should be excluded
+		if d.shouldExclude(name) {
+			continue
+		}
 
-			hclFile, diags := ParseConfig(content, path)
-			if diags.HasErrors() {
-				return diags
-			}
-			hclFile.dir = d
-			d.tfFiles[file.Name()] = hclFile
-			d.dirEntries[file.Name()] = file
+		path := filepath.Join(d.path, name)
+		content, err := afero.ReadFile(d.fs, path)
+		if err != nil {
+			return err
+		}
+
+		hclFile, diags := ParseConfig(content, path)
+		if diags.HasErrors() {
+			return diags
 		}
+		hclFile.dir = d
+		d.tfFiles[name] = hclFile
+		d.dirEntries[name] = file
 	}
 	return nil
 }
 
+// configBodies parses the config files in the folder from d.fs, excluded files and files shadowed by `.tofu` files are skipped.
+// A `.tf.json` file contributes its `terraform` and `module` blocks only, see jsonConfigBody.
+func (d *directory) configBodies() ([]*hclsyntax.Body, error) {
+	files, err := afero.ReadDir(d.fs, d.path)
+	if err != nil {
+		return nil, err
+	}
+	shadowed := shadowedFiles(fileNames(files))
+	var bodies []*hclsyntax.Body
+	for _, file := range files {
+		if file.IsDir() || !isConfigFile(file.Name()) || shadowed[file.Name()] || d.shouldExclude(file.Name()) {
+			continue
+		}
+		content, err := afero.ReadFile(d.fs, filepath.Join(d.path, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if isJSONConfigFile(file.Name()) {
+			doc, err := parseJSONObject(content, file.Name())
+			if err != nil {
+				return nil, err
+			}
+			bodies = append(bodies, jsonConfigBody(doc))
+			continue
+		}
+		f, diags := hclsyntax.ParseConfig(content, file.Name(), hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		bodies = append(bodies, f.Body.(*hclsyntax.Body))
+	}
+	return bodies, nil
+}
+
+func fileNames(files []os.FileInfo) []string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return names
+}
+
 func (d *directory) ensureDestFile(destFileName string) error {
 	destFilePath := filepath.Join(d.path, destFileName)
-	exist, err := afero.Exists(Fs, destFilePath)
+	exist, err := afero.Exists(d.fs, destFilePath)
 	if err != nil {
 		return err
 	}
 	if !exist {
-		file, err := Fs.Create(destFilePath)
+		file, err := d.fs.Create(destFilePath)
 		if err != nil {
 			// handle error
 			return err
@@ -146,35 +351,99 @@ func (d *directory) ensureDestFile(destFileName string) error {
 	return nil
 }
 
-var terraformInitFunc = func(path string) error {
-	initCmd := exec.Command("terraform", "init", "-backend=false")
+var terraformInitFunc = func(path, binary string) error {
+	initCmd := exec.Command(binary, "init", "-backend=false") // #nosec G204
 	initCmd.Dir = path
 	initCmd.Stdout = os.Stdout
 	initCmd.Stderr = os.Stderr
 	return initCmd.Run()
 }
 
+// fileKey returns the key of the file in d.tfFiles and d.dirEntries, it's the path relative to the module folder.
+func (d *directory) fileKey(path string) string {
+	rel, err := filepath.Rel(d.path, path)
+	if err != nil {
+		return filepath.Base(path)
+	}
+	return rel
+}
+
 func (d *directory) shouldExclude(fileName string) bool {
-	if d.excludeGlob == nil {
-		return false
+	return d.filter.skipFile(d.relativePath(fileName))
+}
+
+// relativePath returns the slash separated path of the file relative to the folder the run started from.
+func (d *directory) relativePath(fileName string) string {
+	rel, err := filepath.Rel(d.root, filepath.Join(d.path, fileName))
+	if err != nil {
+		return fileName
+	}
+	return filepath.ToSlash(rel)
+}
+
+// addLocalProviders lets the plugin server reuse the providers installed by `terraform init` instead of downloading them again.
+func (d *directory) addLocalProviders() {
+	s, ok := d.schemaGetter().(*Server)
+	if !ok {
+		return
+	}
+	providersDir, err := filepath.Abs(filepath.Join(d.path, ".terraform", "providers"))
+	if err != nil {
+		return
+	}
+	s.addInitProviderDir(providersDir)
+}
+
+// schemaGetter returns the getter resolving the provider schemas of the folder, the plugin server by default.
+func (d *directory) schemaGetter() SchemaGetter {
+	if d == nil || d.schemas == nil {
+		return tfPluginServer
+	}
+	return d.schemas
+}
+
+// variablesFileName returns the file variables are moved into.
+func (d *directory) variablesFileName() string {
+	if d == nil || d.variablesFile == "" {
+		return "variables.tf"
 	}
-	return d.excludeGlob.Match(fileName)
+	return d.variablesFile
 }
 
-func (d *directory) ensureModules() error {
-	return terraformInitFunc(d.path)
+// outputsFileName returns the file outputs are moved into.
+func (d *directory) outputsFileName() string {
+	if d == nil || d.outputsFile == "" {
+		return "outputs.tf"
+	}
+	return d.outputsFile
+}
+
+// isVariablesFile checks whether the file only contains variables, it's the configured variables file,
+// or any file named like `variables*.tf` if there is none.
+func (d *directory) isVariablesFile(fileName string) bool {
+	if d == nil || d.variablesFile == "" {
+		return variablesFileRegex.MatchString(fileName)
+	}
+	return filepath.Base(fileName) == d.variablesFile
 }
 
-func newDirectory(path, excludePattern string) *directory {
-	var excludeGlob glob.Glob
-	if excludePattern != "" {
-		excludeGlob = glob.MustCompile(excludePattern)
+// isOutputsFile checks whether the file only contains outputs, it's the configured outputs file,
+// or any file named like `outputs*.tf` if there is none.
+func (d *directory) isOutputsFile(fileName string) bool {
+	if d == nil || d.outputsFile == "" {
+		return outputsFileRegex.MatchString(fileName)
 	}
+	return filepath.Base(fileName) == d.outputsFile
+}
+
+func newDirectory(path string, filter *pathFilter) *directory {
 	return &directory{
-		path:        path,
-		excludeGlob: excludeGlob,
-		tfFiles:     make(map[string]*HclFile),
-		dirEntries:  make(map[string]fileMode),
+		path:       path,
+		root:       path,
+		fs:         Fs,
+		filter:     filter,
+		tfFiles:    make(map[string]*HclFile),
+		dirEntries: make(map[string]fileMode),
 	}
 }
 
@@ -273,27 +542,6 @@ func parseTerraformLockFileStub(lockFilePath string) (map[string]map[string]stri
 
 var parseTerraformLockFile = parseTerraformLockFileStub
 
-func (d *directory) resolveNamespace(resourceType string) (string, error) {
-	providerType := providerName(resourceType)
-	for space, providers := range d.providerVersions {
-		if _, ok := providers[providerType]; ok {
-			return space, nil
-		}
-	}
-	return "", fmt.Errorf("namespace for resource %s not found", resourceType)
-}
-
 func providerName(resourceType string) string {
 	return strings.Split(resourceType, "_")[0]
 }
-
-func (d *directory) resolveProviderVersion(namespace, resourceType string) (string, error) {
-	providerType := providerName(resourceType)
-	if providers, ok := d.providerVersions[namespace]; ok {
-		if version, ok := providers[providerType]; ok {
-			return version, nil
-		}
-	}
-	return "", fmt.Errorf("version for resource %s in namespace %s not found", resourceType, namespace)
-
-}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"errors"
 	"path/filepath"
 	"testing"
 
@@ -14,7 +15,7 @@ func Test_EnsureModulesShouldRunTerraformAlways(t *testing.T) {
 	mockFs := afero.NewMemMapFs()
 	require.NoError(t, mockFs.Mkdir("/tmp/.terraform", 0644))
 	getInvoked := false
-	stub := gostub.Stub(&Fs, mockFs).Stub(&terraformInitFunc, func(string) error {
+	stub := gostub.Stub(&Fs, mockFs).Stub(&terraformInitFunc, func(string, string) error {
 		getInvoked = true
 		return nil
 	})
@@ -155,3 +156,93 @@ func TestDirectoryContainsModuleBlockShouldRunTerraformInitFirst(t *testing.T) {
 	_ = DirectoryAutoFix(filepath.Join("test-fixture", "local_module"))
 	assert.True(t, called)
 }
+
+func TestRunWithSchemaFile(t *testing.T) {
+	mockFs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(mockFs, "/schemas.json", []byte(`{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/hashicorp/azurerm": {
+      "resource_schemas": {
+        "azurerm_resource_group": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "name": {"type": "string", "required": true},
+              "location": {"type": "string", "required": true},
+              "tags": {"type": ["map", "string"], "optional": true}
+            }
+          }
+        }
+      }
+    }
+  }
+}`), 0644))
+	require.NoError(t, afero.WriteFile(mockFs, "/module/main.tf", []byte(`resource "azurerm_resource_group" "this" {
+  tags     = {}
+  location = "eastus"
+  name     = "rg"
+}
+`), 0644))
+	// The schema file is passed down to the folder, the plugin server shared by concurrent runs is left untouched.
+	server := tfPluginServer
+	var serverDuringRun SchemaGetter
+	stub := gostub.Stub(&Fs, mockFs).Stub(&terraformInitFunc, func(string, string) error {
+		serverDuringRun = tfPluginServer
+		return nil
+	})
+	defer stub.Reset()
+
+	_, err := Run("/module", Options{
+		SchemaFile: "/schemas.json",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, server, serverDuringRun)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, `resource "azurerm_resource_group" "this" {
+  location = "eastus"
+  name     = "rg"
+  tags     = {}
+}
+`, string(content))
+}
+
+type failingAutoFixBlock struct {
+	block *HclBlock
+}
+
+func (b failingAutoFixBlock) AutoFix() error {
+	b.block.Clear().appendNewline()
+	return errors.New("fix failed")
+}
+
+func TestAutoFixBlock_FailSoftShouldRestoreBlockWhoseFixFails(t *testing.T) {
+	config := `resource "azurerm_resource_group" "this" {
+  name     = "rg"
+  location = "eastus"
+
+  tags = {
+    b = 1
+    a = 2
+  }
+}
+`
+	for _, failSoft := range []bool{false, true} {
+		f, diag := ParseConfig([]byte(config), "main.tf")
+		require.False(t, diag.HasErrors())
+		f.dir = newDirectory("/module", nil)
+		f.dir.failSoft = failSoft
+		block := f.GetBlock(0)
+		err := f.autoFixBlock(failingAutoFixBlock{block: block}, block)
+		if !failSoft {
+			assert.EqualError(t, err, "fix failed")
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, config, string(f.WriteFile.Bytes()))
+		require.Len(t, f.dir.warnings, 1)
+		assert.Equal(t, "resource.azurerm_resource_group.this", f.dir.warnings[0].Block)
+		assert.Equal(t, "fix failed", f.dir.warnings[0].Reason)
+	}
+}
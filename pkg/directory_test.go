@@ -333,6 +333,141 @@ func TestOutputBlockInOutputsDotTfFileShouldNotBeMoved(t *testing.T) {
 	assert.False(t, exists)
 }
 
+func TestDirectoryCheckShouldReportChangesWithoutWriting(t *testing.T) {
+	mainTf := `output "test" {}
+
+locals {
+  b = "b"
+  a = "a"
+}
+`
+	mockFs := fakeFs(map[string]string{
+		"main.tf": mainTf,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	changes, err := pkg.DirectoryCheck("")
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "main.tf", changes[0].Path)
+	assert.Equal(t, mainTf, string(changes[0].Original))
+	assert.Equal(t, formatHcl(`
+locals {
+  a = "a"
+  b = "b"
+}
+`), formatHcl(string(changes[0].Fixed)))
+	assert.Equal(t, "outputs.tf", changes[1].Path)
+	assert.Nil(t, changes[1].Original)
+	assert.Contains(t, string(changes[1].Fixed), `output "test" {`)
+
+	content, err := afero.ReadFile(mockFs, "main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, mainTf, string(content))
+	exists, err := afero.Exists(mockFs, "outputs.tf")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestDirectoryCheckShouldReportNothingForCompliantFolder(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"main.tf": `locals {
+  a = "a"
+  b = "b"
+}
+`,
+		"variables.tf": `variable "test" {
+}
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	changes, err := pkg.DirectoryCheck("")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestFileChangeUnifiedDiffShouldCoverBlockMovedBetweenFiles(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"main.tf": `variable "test" {}
+`,
+		"variables.tf": `variable "existing" {
+}
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	changes, err := pkg.DirectoryCheck("")
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+
+	mainDiff, err := changes[0].UnifiedDiff()
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/main.tf
++++ b/main.tf
+@@ -1 +0,0 @@
+-variable "test" {}
+`, mainDiff)
+
+	variablesDiff, err := changes[1].UnifiedDiff()
+	require.NoError(t, err)
+	assert.Contains(t, variablesDiff, "--- a/variables.tf\n+++ b/variables.tf\n")
+	assert.Contains(t, variablesDiff, "+variable \"test\" {")
+}
+
+func TestFileChangeUnifiedDiffShouldCompareCreatedFileWithDevNull(t *testing.T) {
+	change := pkg.FileChange{
+		Path:  "outputs.tf",
+		Fixed: []byte("output \"test\" {\n}\n"),
+	}
+	diff, err := change.UnifiedDiff()
+	require.NoError(t, err)
+	assert.Equal(t, `--- /dev/null
++++ b/outputs.tf
+@@ -0,0 +1,2 @@
++output "test" {
++}
+`, diff)
+}
+
+func TestFileChangeUnifiedDiffShouldUsePathsRelativeToTargetFolder(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/modules/a/main.tf": unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/repo", pkg.Options{
+		Recursive: true,
+		DryRun:    true,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 1)
+	diff, err := result.Changes[0].UnifiedDiff()
+	require.NoError(t, err)
+	assert.Contains(t, diff, "--- a/modules/a/main.tf\n+++ b/modules/a/main.tf\n")
+}
+
+func TestFileChangeUnifiedDiffShouldMarkMissingNewlineAtEndOfFile(t *testing.T) {
+	change := pkg.FileChange{
+		Path:     "main.tf",
+		Original: []byte("locals {}"),
+		Fixed:    []byte("locals {}\n"),
+	}
+	diff, err := change.UnifiedDiff()
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/main.tf
++++ b/main.tf
+@@ -1 +1 @@
+-locals {}
+\ No newline at end of file
++locals {}
+`, diff)
+}
+
 func fakeFs(files map[string]string) afero.Fs {
 	fs := afero.NewMemMapFs()
 	for path, content := range files {
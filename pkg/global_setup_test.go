@@ -59,11 +59,11 @@ func (d dummySchemaGetter) GetEphemeralResourceSchema(request Request, ephemeral
 }
 
 func TestMain(m *testing.M) {
-	stub := gostub.Stub(&resolveNamespace, func(string, *HclFile) (string, error) {
-		return "registry.terraform.io/hashicorp", nil
-	}).Stub(&resolveProviderVersion, func(string, string, *HclFile) (string, error) {
+	stub := gostub.Stub(&resolveProvider, func(block *HclBlock, _ *HclFile) (providerAddress, error) {
+		return providerAddress{Hostname: defaultProviderHostname, Namespace: "hashicorp", Type: providerName(blockResourceType(block))}, nil
+	}).Stub(&resolveProviderVersion, func(providerAddress, *HclFile) (string, error) {
 		return "4.37.0", nil
-	}).Stub(&tfPluginServer, dummySchemaGetter{}).Stub(&terraformInitFunc, func(string) error {
+	}).Stub(&tfPluginServer, dummySchemaGetter{}).Stub(&terraformInitFunc, func(string, string) error {
 		return nil
 	}).Stub(&parseTerraformLockFile, func(lockFilePath string) (map[string]map[string]string, error) {
 		return map[string]map[string]string{
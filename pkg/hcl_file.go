@@ -13,9 +13,14 @@ type HclFile struct {
 	dir       *directory
 	WriteFile *hclwrite.File
 	FileName  string
+	// json is the document of a `.tf.json` file, WriteFile is nil for such a file.
+	json *jsonObject
 }
 
 func ParseConfig(config []byte, filename string) (*HclFile, hcl.Diagnostics) {
+	if isJSONConfigFile(filename) {
+		return parseJSONConfig(config, filename)
+	}
 	file, rDiag := hclsyntax.ParseConfig(config, filename, hcl.InitialPos)
 	writeFile, wDiag := hclwrite.ParseConfig(config, filename, hcl.InitialPos)
 	if rDiag.HasErrors() || wDiag.HasErrors() {
@@ -34,18 +39,28 @@ func (f *HclFile) GetBlock(i int) *HclBlock {
 	return NewHclBlock(block, writeBlock)
 }
 
-var outputsFileRegex = regexp.MustCompile(`.*?outputs.*?\.tf$`)
-var variablesFileRegex = regexp.MustCompile(`.*?variables.*?\.tf$`)
+var outputsFileRegex = regexp.MustCompile(`.*?outputs.*?\.(tf|tofu)$`)
+var variablesFileRegex = regexp.MustCompile(`.*?variables.*?\.(tf|tofu)$`)
 
 func (f *HclFile) AutoFix() error {
-	if outputsFileRegex.MatchString(f.FileName) {
+	if f.json != nil {
+		return f.autoFixJSON()
+	}
+	if isTestFile(f.FileName) {
+		return BuildTestFile(f).AutoFix()
+	}
+	if isQueryFile(f.FileName) {
+		return BuildQueryFile(f).AutoFix()
+	}
+	override := isOverrideFile(f.FileName)
+	if !override && f.dir.isOutputsFile(f.FileName) {
 		outputsFile := BuildOutputsFile(f)
 		if err := outputsFile.AutoFix(); err != nil {
 			return err
 		}
 		return nil
 	}
-	if variablesFileRegex.MatchString(f.FileName) {
+	if !override && f.dir.isVariablesFile(f.FileName) {
 		variablesFile := BuildVariablesFile(f)
 		return variablesFile.AutoFix()
 	}
@@ -55,11 +70,27 @@ func (f *HclFile) AutoFix() error {
 	}
 	for i, b := range f.Body.(*hclsyntax.Body).Blocks {
 		hclBlock := blocks[i]
+		if b.Type == "module" {
+			if err := f.checkModuleSource(hclBlock); err != nil {
+				return err
+			}
+		}
+		// Variables and outputs are only moved here, they're sorted in their own files.
+		// Module blocks are fixed by more rules than module-order.
+		if rule, ok := orderRules[b.Type]; ok && b.Type != "variable" && b.Type != "output" && b.Type != "module" && !f.dir.ruleEnabled(rule) {
+			continue
+		}
+		if b.Type == "module" && !moduleRulesEnabled(f.dir) {
+			continue
+		}
 		var ab AutoFixBlock
 		if len(hclBlock.Labels) > 1 {
 			var err error
 			ab, err = BuildBlockWithSchema(hclBlock, f)
 			if err != nil {
+				if f.skipBlock(b, err) {
+					continue
+				}
 				return err
 			}
 		}
@@ -69,6 +100,9 @@ func (f *HclFile) AutoFix() error {
 				var err error
 				ab, err = BuildModuleBlock(hclBlock, f.dir.path, f)
 				if err != nil {
+					if f.skipBlock(b, err) {
+						continue
+					}
 					return err
 				}
 			}
@@ -80,6 +114,10 @@ func (f *HclFile) AutoFix() error {
 			{
 				ab = BuildRemovedBlock(hclBlock, f)
 			}
+		case "import":
+			{
+				ab = BuildImportBlock(hclBlock, f)
+			}
 		case "locals":
 			{
 				ab = BuildLocalsBlock(hclBlock, f)
@@ -90,26 +128,92 @@ func (f *HclFile) AutoFix() error {
 			}
 		case "variable":
 			{
-				f.dir.AppendBlockToFile("variables.tf", hclBlock)
-				_ = f.RemoveBlock(hclBlock)
+				if override || !f.dir.ruleEnabled(RuleVariableFilePlacement) {
+					ab = f.inPlaceVariableBlock(hclBlock, override)
+				} else {
+					f.dir.recordFix(hclBlock.Block, RuleVariableFilePlacement)
+					f.dir.AppendBlockToFile(f.dir.variablesFileName(), hclBlock)
+					_ = f.RemoveBlock(hclBlock)
+				}
 			}
 		case "output":
 			{
-				f.dir.AppendBlockToFile("outputs.tf", hclBlock)
-				_ = f.RemoveBlock(hclBlock)
+				if override || !f.dir.ruleEnabled(RuleOutputFilePlacement) {
+					ab = f.inPlaceOutputBlock(hclBlock, override)
+				} else {
+					f.dir.recordFix(hclBlock.Block, RuleOutputFilePlacement)
+					f.dir.AppendBlockToFile(f.dir.outputsFileName(), hclBlock)
+					_ = f.RemoveBlock(hclBlock)
+				}
 			}
 		}
 
 		if ab == nil {
 			continue
 		}
-		if err := ab.AutoFix(); err != nil {
+		if err := f.autoFixBlock(ab, hclBlock); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// autoFixBlock applies the fix to the block, in fail-soft mode a block whose fix fails is restored and left untouched.
+func (f *HclFile) autoFixBlock(ab AutoFixBlock, block *HclBlock) error {
+	body := block.WriteBlock.Body()
+	var original hclwrite.Tokens
+	for _, t := range body.BuildTokens(nil) {
+		token := *t
+		original = append(original, &token)
+	}
+	fix := ab.AutoFix
+	if srb, ok := ab.(singleRuleBlock); ok {
+		fix = func() error {
+			return f.dir.applyRule(block, srb.rule(), ab.AutoFix)
+		}
+	}
+	err := fix()
+	if err == nil || !f.skipBlock(block.Block, err) {
+		return err
+	}
+	body.Clear()
+	body.AppendUnstructuredTokens(original)
+	return nil
+}
+
+// inPlaceVariableBlock returns the fix of a variable kept in its file, in an override file or when it's not moved into
+// the variables file. A variable in an override file is only sorted, `nullable = true` and `sensitive = false` are kept
+// since they might override the original values.
+func (f *HclFile) inPlaceVariableBlock(block *HclBlock, overriding bool) AutoFixBlock {
+	if !f.dir.ruleEnabled(RuleVariableOrder) && (overriding || !f.dir.ruleEnabled(RuleVariableNullable) && !f.dir.ruleEnabled(RuleVariableSensitive)) {
+		return nil
+	}
+	b := BuildVariableBlock(f.File, block)
+	b.dir = f.dir
+	b.overriding = overriding
+	return b
+}
+
+// inPlaceOutputBlock returns the fix of an output kept in its file, in an override file or when it's not moved into
+// the outputs file. An output in an override file is only sorted.
+func (f *HclFile) inPlaceOutputBlock(block *HclBlock, overriding bool) AutoFixBlock {
+	if !f.dir.ruleEnabled(RuleOutputOrder) && (overriding || !f.dir.ruleEnabled(RuleOutputSensitive)) {
+		return nil
+	}
+	b := BuildOutputBlock(f.File, block)
+	b.dir = f.dir
+	b.overriding = overriding
+	return b
+}
+
+// content returns the fixed content of the file.
+func (f *HclFile) content() ([]byte, error) {
+	if f.json != nil {
+		return f.json.bytes()
+	}
+	return f.WriteFile.Bytes(), nil
+}
+
 func (f *HclFile) appendNewline() {
 	f.WriteFile.Body().AppendNewline()
 }
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+type ImportBlock struct {
+	HclBlock *HclBlock
+	file     *HclFile
+}
+
+func BuildImportBlock(block *HclBlock, file *HclFile) *ImportBlock {
+	return &ImportBlock{
+		HclBlock: block,
+		file:     file,
+	}
+}
+
+func (b *ImportBlock) rule() string {
+	return RuleImportIdentityOrder
+}
+
+// AutoFix sorts the keys of the `identity` object by the resource identity schema, attributes required for import come first,
+// then the optional ones, both sorted by name. The block is left untouched if the provider doesn't declare an identity for the resource.
+func (b *ImportBlock) AutoFix() error {
+	identity, ok := b.HclBlock.Attributes()["identity"]
+	if !ok {
+		return nil
+	}
+	resourceType := importResourceType(b.HclBlock)
+	if resourceType == "" {
+		return nil
+	}
+	schema, err := b.identitySchema(resourceType)
+	if err != nil {
+		if b.file.skipBlock(b.HclBlock.Block, err) {
+			return nil
+		}
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+	tokens := identity.WriteAttribute.Expr().BuildTokens(hclwrite.Tokens{})
+	b.HclBlock.WriteBlock.Body().SetAttributeRaw("identity", sortObjectTokens(tokens, func(x, y string) bool {
+		groupX, groupY := identityAttributeGroup(x, schema), identityAttributeGroup(y, schema)
+		if groupX != groupY {
+			return groupX < groupY
+		}
+		return groupX != unknownIdentityAttribute && x < y
+	}, nil))
+	return nil
+}
+
+func (b *ImportBlock) identitySchema(resourceType string) (*tfjson.IdentitySchema, error) {
+	provider, err := resolveProvider(b.HclBlock, b.file)
+	if err != nil {
+		return nil, err
+	}
+	version, err := resolveProviderVersion(provider, b.file)
+	if err != nil {
+		return nil, err
+	}
+	return queryIdentitySchema(b.file.dir.schemaGetter(), resourceType, provider, version)
+}
+
+const unknownIdentityAttribute = 2
+
+// identityAttributeGroup returns 0 for attributes required for import, 1 for the other declared attributes and unknownIdentityAttribute
+// for keys the schema doesn't declare, unknown keys are kept after the others in their original order.
+func identityAttributeGroup(name string, schema *tfjson.IdentitySchema) int {
+	attr, ok := schema.Attributes[name]
+	switch {
+	case !ok:
+		return unknownIdentityAttribute
+	case attr.RequiredForImport:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// importResourceType returns the type of the resource the `import` block imports into, e.g. `azurerm_resource_group` for
+// `to = azurerm_resource_group.this["a"]`. An empty string is returned for resources in child modules, since they're served
+// by the child modules' providers.
+func importResourceType(block *HclBlock) string {
+	to, ok := block.Body.Attributes["to"]
+	if !ok {
+		return ""
+	}
+	expr := to.Expr
+	for {
+		switch e := expr.(type) {
+		case *hclsyntax.IndexExpr:
+			// e.g. `azurerm_resource_group.this[each.key]`
+			expr = e.Collection
+		case *hclsyntax.RelativeTraversalExpr:
+			expr = e.Source
+		case *hclsyntax.ScopeTraversalExpr:
+			if root := e.Traversal.RootName(); root != "module" {
+				return root
+			}
+			return ""
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const identitySchemasJson = `{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/hashicorp/azurerm": {
+      "resource_schemas": {
+        "azurerm_resource_group": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "name": {"type": "string", "required": true},
+              "location": {"type": "string", "required": true}
+            }
+          }
+        }
+      },
+      "resource_identity_schemas": {
+        "azurerm_resource_group": {
+          "version": 0,
+          "attributes": {
+            "subscription_id": {"type": "string", "optional_for_import": true},
+            "name": {"type": "string", "required_for_import": true},
+            "resource_group_name": {"type": "string", "required_for_import": true}
+          }
+        }
+      },
+      "list_resource_schemas": {
+        "azurerm_resource_group": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "subscription_id": {"type": "string", "required": true},
+              "name_prefix": {"type": "string", "optional": true},
+              "id": {"type": "string", "computed": true}
+            },
+            "block_types": {
+              "filter": {
+                "nesting_mode": "list",
+                "block": {
+                  "attributes": {
+                    "tag": {"type": "string", "optional": true}
+                  }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func TestRunShouldSortImportIdentityBySchema(t *testing.T) {
+	cases := []struct {
+		desc     string
+		config   string
+		expected string
+	}{
+		{
+			desc: "required attributes first",
+			config: `import {
+  to = azurerm_resource_group.this
+  identity = {
+    subscription_id     = "00000000-0000-0000-0000-000000000000"
+    unknown             = "kept last"
+    resource_group_name = "rg" # the group
+    name                = "rg"
+  }
+}
+`,
+			expected: `import {
+  to = azurerm_resource_group.this
+  identity = {
+    name                = "rg"
+    resource_group_name = "rg" # the group
+    subscription_id     = "00000000-0000-0000-0000-000000000000"
+    unknown             = "kept last"
+  }
+}
+`,
+		},
+		{
+			desc: "for_each",
+			config: `import {
+  for_each = var.groups
+  to       = azurerm_resource_group.this[each.key]
+  identity = { subscription_id = each.value.subscription_id, name = each.key }
+}
+`,
+			expected: `import {
+  for_each = var.groups
+  to       = azurerm_resource_group.this[each.key]
+  identity = { name = each.key, subscription_id = each.value.subscription_id }
+}
+`,
+		},
+		{
+			desc: "resource in child module",
+			config: `import {
+  to       = module.rg.azurerm_resource_group.this
+  identity = { subscription_id = "s", name = "rg" }
+}
+`,
+			expected: `import {
+  to       = module.rg.azurerm_resource_group.this
+  identity = { subscription_id = "s", name = "rg" }
+}
+`,
+		},
+		{
+			desc: "import by id",
+			config: `import {
+  to = azurerm_resource_group.this
+  id = "/subscriptions/s/resourceGroups/rg"
+}
+`,
+			expected: `import {
+  to = azurerm_resource_group.this
+  id = "/subscriptions/s/resourceGroups/rg"
+}
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			mockFs := fakeFs(map[string]string{
+				"/schemas.json":   identitySchemasJson,
+				"/module/main.tf": c.config,
+			})
+			stub := gostub.Stub(&pkg.Fs, mockFs)
+			defer stub.Reset()
+
+			result, err := pkg.Run("/module", pkg.Options{
+				SchemaFile: "/schemas.json",
+			})
+			require.NoError(t, err)
+			content, err := afero.ReadFile(mockFs, "/module/main.tf")
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, string(content))
+			if c.config == c.expected {
+				assert.Empty(t, result.Fixes)
+				return
+			}
+			require.Len(t, result.Fixes, 1)
+			assert.Equal(t, pkg.RuleImportIdentityOrder, result.Fixes[0].Rule)
+		})
+	}
+}
+
+func TestRunWithDisabledImportIdentityOrderShouldKeepImportBlocks(t *testing.T) {
+	config := `import {
+  to       = azurerm_resource_group.this
+  identity = { subscription_id = "s", name = "rg" }
+}
+`
+	mockFs := fakeFs(map[string]string{
+		"/schemas.json":   identitySchemasJson,
+		"/module/main.tf": config,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{
+		SchemaFile:    "/schemas.json",
+		DisabledRules: []string{pkg.RuleImportIdentityOrder},
+	})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, config, string(content))
+}
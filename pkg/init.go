@@ -0,0 +1,188 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/afero"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// InitMode decides whether `init` runs before a folder is fixed.
+type InitMode string
+
+const (
+	// InitAlways runs `init` for every folder, it's the default mode.
+	InitAlways InitMode = "always"
+	// InitNever never runs `init`, modules and the lock file must have been installed already.
+	InitNever InitMode = "never"
+	// InitAuto only runs `init` when `.terraform.lock.hcl` or `.terraform/modules/modules.json` is missing or stale.
+	InitAuto InitMode = "auto"
+)
+
+const defaultInitBinary = "terraform"
+
+// ParseInitMode converts a string into InitMode, an empty string means InitAlways.
+func ParseInitMode(mode string) (InitMode, error) {
+	switch m := InitMode(mode); m {
+	case "":
+		return InitAlways, nil
+	case InitAlways, InitNever, InitAuto:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown init mode %q, valid modes are %s, %s and %s", mode, InitAlways, InitNever, InitAuto)
+}
+
+func (d *directory) ensureModules() error {
+	binary := d.initBinary
+	if binary == "" {
+		binary = defaultInitBinary
+	}
+	// `init` downloads modules and providers, it never runs in offline mode whatever the init mode is.
+	if d.offline {
+		d.initReport = "skipped, offline mode"
+		return nil
+	}
+	switch d.initMode {
+	case InitNever:
+		d.initReport = "skipped, init disabled"
+		return nil
+	case InitAuto:
+		reason, err := d.initRequired()
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			d.initReport = "skipped, modules are up to date"
+			return nil
+		}
+		d.initReport = fmt.Sprintf("%s init, %s", binary, reason)
+	default:
+		d.initReport = fmt.Sprintf("%s init", binary)
+	}
+	return terraformInitFunc(d.path, binary)
+}
+
+type modulesManifest struct {
+	Modules []struct {
+		Key     string `json:"Key"`
+		Source  string `json:"Source"`
+		Version string `json:"Version"`
+		// Dir is the folder the module has been installed in, relative to the root module.
+		Dir string `json:"Dir"`
+	} `json:"Modules"`
+}
+
+// initRequired returns the reason why `init` must run, or an empty string if the installed modules match the configuration.
+func (d *directory) initRequired() (string, error) {
+	lockExists, err := afero.Exists(d.fs, filepath.Join(d.path, ".terraform.lock.hcl"))
+	if err != nil {
+		return "", err
+	}
+	if !lockExists {
+		return ".terraform.lock.hcl is missing", nil
+	}
+	calls, err := d.moduleCalls()
+	if err != nil {
+		return "", err
+	}
+	if len(calls) == 0 {
+		return "", nil
+	}
+	manifestPath := filepath.Join(d.path, ".terraform", "modules", "modules.json")
+	manifestExists, err := afero.Exists(d.fs, manifestPath)
+	if err != nil {
+		return "", err
+	}
+	if !manifestExists {
+		return "modules.json is missing", nil
+	}
+	content, err := afero.ReadFile(d.fs, manifestPath)
+	if err != nil {
+		return "", err
+	}
+	var manifest modulesManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return "modules.json is unreadable", nil
+	}
+	for _, call := range calls {
+		installed := false
+		for _, m := range manifest.Modules {
+			if m.Key == call.name && sameModuleSource(m.Source, call.source) && versionMatches(m.Version, call.version) {
+				installed = true
+				break
+			}
+		}
+		if !installed {
+			return fmt.Sprintf("module %s is not installed or stale", call.name), nil
+		}
+	}
+	return "", nil
+}
+
+type moduleCall struct {
+	name    string
+	source  string
+	version string
+}
+
+// moduleCalls returns the `module` blocks declared in the folder, `source` and `version` are read only when they're literal strings.
+func (d *directory) moduleCalls() ([]moduleCall, error) {
+	bodies, err := d.configBodies()
+	if err != nil {
+		return nil, err
+	}
+	var calls []moduleCall
+	for _, body := range bodies {
+		for _, b := range body.Blocks {
+			if b.Type != "module" || len(b.Labels) != 1 {
+				continue
+			}
+			calls = append(calls, moduleCall{
+				name:    b.Labels[0],
+				source:  literalString(b.Body.Attributes["source"]),
+				version: literalString(b.Body.Attributes["version"]),
+			})
+		}
+	}
+	return calls, nil
+}
+
+func literalString(attr *hclsyntax.Attribute) string {
+	if attr == nil {
+		return ""
+	}
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || !v.IsKnown() || v.IsNull() || !v.Type().Equals(cty.String) {
+		return ""
+	}
+	return v.AsString()
+}
+
+// sameModuleSource compares the source recorded in modules.json with the configured one,
+// Terraform records registry modules with their hostname, e.g. `registry.terraform.io/hashicorp/consul/aws`.
+func sameModuleSource(installed, configured string) bool {
+	if configured == "" || installed == configured {
+		return true
+	}
+	return strings.HasSuffix(installed, "/"+configured)
+}
+
+func versionMatches(installed, constraint string) bool {
+	if constraint == "" {
+		return true
+	}
+	c, err := version.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	v, err := version.NewVersion(installed)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const moduleCallConfig = `module "consul" {
+  source  = "hashicorp/consul/aws"
+  version = "~> 0.11"
+}
+`
+
+func stubInit(t *testing.T, mockFs afero.Fs) *[]string {
+	var binaries []string
+	stub := gostub.Stub(&Fs, mockFs).Stub(&terraformInitFunc, func(_ string, binary string) error {
+		binaries = append(binaries, binary)
+		return nil
+	})
+	t.Cleanup(stub.Reset)
+	return &binaries
+}
+
+func writeModulesManifest(t *testing.T, fs afero.Fs, version string) {
+	require.NoError(t, afero.WriteFile(fs, "/tmp/.terraform/modules/modules.json", []byte(`{"Modules":[{"Key":"","Source":"","Dir":"."},{"Key":"consul","Source":"registry.terraform.io/hashicorp/consul/aws","Version":"`+version+`","Dir":".terraform/modules/consul"}]}`), 0644))
+}
+
+func TestEnsureModules_NeverModeShouldSkipInit(t *testing.T) {
+	mockFs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(mockFs, "/tmp/main.tf", []byte("locals {\n  b = 1\n  a = 2\n}\n"), 0644))
+	binaries := stubInit(t, mockFs)
+
+	result, err := Run("/tmp", Options{Init: InitNever})
+	require.NoError(t, err)
+	assert.Empty(t, *binaries)
+	assert.Equal(t, "skipped, init disabled", result.Directories[0].Init)
+}
+
+func TestEnsureModules_DryRunShouldDefaultToAutoMode(t *testing.T) {
+	for _, mode := range []InitMode{"", InitAlways} {
+		t.Run(string(mode), func(t *testing.T) {
+			mockFs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(mockFs, "/tmp/main.tf", []byte(moduleCallConfig), 0644))
+			require.NoError(t, afero.WriteFile(mockFs, "/tmp/.terraform.lock.hcl", []byte(""), 0644))
+			writeModulesManifest(t, mockFs, "0.11.0")
+			binaries := stubInit(t, mockFs)
+
+			result, err := Run("/tmp", Options{Init: mode, DryRun: true, FailSoft: true})
+			require.NoError(t, err)
+			if mode == "" {
+				assert.Empty(t, *binaries)
+				assert.Equal(t, "skipped, modules are up to date", result.Directories[0].Init)
+				return
+			}
+			assert.Len(t, *binaries, 1)
+		})
+	}
+}
+
+func TestEnsureModules_OfflineShouldNeverRunInit(t *testing.T) {
+	for _, mode := range []InitMode{"", InitAlways, InitAuto} {
+		t.Run(string(mode), func(t *testing.T) {
+			mockFs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(mockFs, "/tmp/main.tf", []byte("locals {\n  b = 1\n  a = 2\n}\n"), 0644))
+			binaries := stubInit(t, mockFs)
+
+			result, err := Run("/tmp", Options{Init: mode, Offline: true})
+			require.NoError(t, err)
+			assert.Empty(t, *binaries)
+			assert.Equal(t, "skipped, offline mode", result.Directories[0].Init)
+		})
+	}
+}
+
+func TestEnsureModules_AutoMode(t *testing.T) {
+	cases := []struct {
+		desc           string
+		lockFile       bool
+		installed      string
+		expectedInit   bool
+		expectedReport string
+	}{
+		{
+			desc:           "up to date",
+			lockFile:       true,
+			installed:      "0.11.0",
+			expectedReport: "skipped, modules are up to date",
+		},
+		{
+			desc:           "lock file missing",
+			installed:      "0.11.0",
+			expectedInit:   true,
+			expectedReport: "terraform init, .terraform.lock.hcl is missing",
+		},
+		{
+			desc:           "modules.json missing",
+			lockFile:       true,
+			expectedInit:   true,
+			expectedReport: "terraform init, modules.json is missing",
+		},
+		{
+			desc:           "installed version doesn't match constraint",
+			lockFile:       true,
+			installed:      "0.10.0",
+			expectedInit:   true,
+			expectedReport: "terraform init, module consul is not installed or stale",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			mockFs := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(mockFs, "/tmp/main.tf", []byte(moduleCallConfig), 0644))
+			if c.lockFile {
+				require.NoError(t, afero.WriteFile(mockFs, "/tmp/.terraform.lock.hcl", []byte(""), 0644))
+			}
+			if c.installed != "" {
+				writeModulesManifest(t, mockFs, c.installed)
+			}
+			binaries := stubInit(t, mockFs)
+
+			d := newDirectory("/tmp", nil)
+			d.initMode = InitAuto
+			require.NoError(t, d.ensureModules())
+			assert.Equal(t, c.expectedInit, len(*binaries) == 1)
+			assert.Equal(t, c.expectedReport, d.initReport)
+		})
+	}
+}
+
+func TestEnsureModules_ShouldUseConfiguredBinary(t *testing.T) {
+	mockFs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(mockFs, "/tmp/main.tf", []byte(moduleCallConfig), 0644))
+	binaries := stubInit(t, mockFs)
+
+	d := newDirectory("/tmp", nil)
+	d.initBinary = "tofu"
+	require.NoError(t, d.ensureModules())
+	assert.Equal(t, []string{"tofu"}, *binaries)
+	assert.Equal(t, "tofu init", d.initReport)
+}
+
+func TestParseInitMode(t *testing.T) {
+	mode, err := ParseInitMode("")
+	require.NoError(t, err)
+	assert.Equal(t, InitAlways, mode)
+	mode, err = ParseInitMode("auto")
+	require.NoError(t, err)
+	assert.Equal(t, InitAuto, mode)
+	_, err = ParseInitMode("sometimes")
+	assert.ErrorContains(t, err, "unknown init mode")
+}
@@ -0,0 +1,272 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// jsonObject is a JSON object keeping the order of its members.
+// Values are *jsonObject, []any, json.Number, string, bool or nil.
+type jsonObject struct {
+	Members []*jsonMember
+	// Range covers the object from the opening brace to the closing brace.
+	Range hcl.Range
+}
+
+type jsonMember struct {
+	Name  string
+	Value any
+	// Range covers the name and the value.
+	Range hcl.Range
+}
+
+// get returns the value of the first member with the name.
+func (o *jsonObject) get(name string) (any, bool) {
+	for _, m := range o.Members {
+		if m.Name == name {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// remove removes the members with the name.
+func (o *jsonObject) remove(name string) {
+	members := o.Members[:0]
+	for _, m := range o.Members {
+		if m.Name != name {
+			members = append(members, m)
+		}
+	}
+	o.Members = members
+}
+
+// jsonObjects returns the value if it's an object, or the objects in it if it's an array.
+// Terraform allows an array of objects wherever a block is expected.
+func jsonObjects(v any) []*jsonObject {
+	switch value := v.(type) {
+	case *jsonObject:
+		return []*jsonObject{value}
+	case []any:
+		var r []*jsonObject
+		for _, item := range value {
+			if o, ok := item.(*jsonObject); ok {
+				r = append(r, o)
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+func isJSONConfigFile(fileName string) bool {
+	return strings.HasSuffix(fileName, ".tf.json") || strings.HasSuffix(fileName, ".tofu.json")
+}
+
+type jsonParser struct {
+	decoder    *json.Decoder
+	src        []byte
+	filename   string
+	lineStarts []int
+}
+
+// parseJSONObject parses a JSON document whose root is an object.
+func parseJSONObject(src []byte, filename string) (*jsonObject, error) {
+	p := &jsonParser{
+		decoder:    json.NewDecoder(bytes.NewReader(src)),
+		src:        src,
+		filename:   filename,
+		lineStarts: []int{0},
+	}
+	p.decoder.UseNumber()
+	for i, c := range src {
+		if c == '\n' {
+			p.lineStarts = append(p.lineStarts, i+1)
+		}
+	}
+	start := p.nextTokenStart()
+	tok, err := p.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, errors.New("the root of a JSON configuration file must be an object")
+	}
+	root, err := p.object(start)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected content after the root object")
+	}
+	return root, nil
+}
+
+func (p *jsonParser) value(tok json.Token, start int) (any, error) {
+	d, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch d {
+	case '{':
+		return p.object(start)
+	case '[':
+		return p.array()
+	}
+	return nil, fmt.Errorf("unexpected %q", d)
+}
+
+func (p *jsonParser) object(start int) (*jsonObject, error) {
+	o := &jsonObject{}
+	for p.decoder.More() {
+		memberStart := p.nextTokenStart()
+		tok, err := p.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object key %v", tok)
+		}
+		valueStart := p.nextTokenStart()
+		if tok, err = p.decoder.Token(); err != nil {
+			return nil, err
+		}
+		v, err := p.value(tok, valueStart)
+		if err != nil {
+			return nil, err
+		}
+		o.Members = append(o.Members, &jsonMember{
+			Name:  name,
+			Value: v,
+			Range: p.rangeOf(memberStart, int(p.decoder.InputOffset())),
+		})
+	}
+	if _, err := p.decoder.Token(); err != nil {
+		return nil, err
+	}
+	o.Range = p.rangeOf(start, int(p.decoder.InputOffset()))
+	return o, nil
+}
+
+func (p *jsonParser) array() ([]any, error) {
+	r := make([]any, 0)
+	for p.decoder.More() {
+		start := p.nextTokenStart()
+		tok, err := p.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		v, err := p.value(tok, start)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, v)
+	}
+	if _, err := p.decoder.Token(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// nextTokenStart returns the offset of the next token, the separators the decoder hasn't consumed yet are skipped.
+func (p *jsonParser) nextTokenStart() int {
+	i := int(p.decoder.InputOffset())
+	for i < len(p.src) && strings.IndexByte(" \t\r\n,:", p.src[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+func (p *jsonParser) rangeOf(start, end int) hcl.Range {
+	return hcl.Range{
+		Filename: p.filename,
+		Start:    p.pos(start),
+		End:      p.pos(end),
+	}
+}
+
+func (p *jsonParser) pos(offset int) hcl.Pos {
+	line := sort.Search(len(p.lineStarts), func(i int) bool { return p.lineStarts[i] > offset }) - 1
+	return hcl.Pos{
+		Line:   line + 1,
+		Column: offset - p.lineStarts[line] + 1,
+		Byte:   offset,
+	}
+}
+
+// bytes writes the object as JSON indented with two spaces, members are written in their order.
+func (o *jsonObject) bytes() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeJSONValue(buf, o, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+func writeJSONValue(buf *bytes.Buffer, v any, indent string) error {
+	inner := indent + "  "
+	switch value := v.(type) {
+	case *jsonObject:
+		if len(value.Members) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i, m := range value.Members {
+			buf.WriteString(inner)
+			if err := writeJSONScalar(buf, m.Name); err != nil {
+				return err
+			}
+			buf.WriteString(": ")
+			if err := writeJSONValue(buf, m.Value, inner); err != nil {
+				return err
+			}
+			if i < len(value.Members)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case []any:
+		if len(value) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, item := range value {
+			buf.WriteString(inner)
+			if err := writeJSONValue(buf, item, inner); err != nil {
+				return err
+			}
+			if i < len(value)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	default:
+		return writeJSONScalar(buf, value)
+	}
+	return nil
+}
+
+func writeJSONScalar(buf *bytes.Buffer, v any) error {
+	// Don't escape `<`, `>` and `&`, they're common in expressions like "${var.a > 0}".
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	// Encode always appends a newline.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
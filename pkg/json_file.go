@@ -0,0 +1,424 @@
+package pkg
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// jsonCommentKey is the property Terraform ignores in JSON syntax, it's kept at the top of its object.
+const jsonCommentKey = "//"
+
+// parseJSONConfig parses a `.tf.json` file, the document is kept in HclFile.json and rewritten as a whole, WriteFile is nil.
+func parseJSONConfig(config []byte, filename string) (*HclFile, hcl.Diagnostics) {
+	file, diags := hcljson.Parse(config, filename)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	doc, err := parseJSONObject(config, filename)
+	if err != nil {
+		return nil, hcl.Diagnostics{
+			{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid JSON configuration",
+				Detail:   err.Error(),
+			},
+		}
+	}
+	return &HclFile{
+		File:     file,
+		FileName: filename,
+		json:     doc,
+	}, hcl.Diagnostics{}
+}
+
+// autoFixJSON applies the fixes of `resource`, `variable` and `output` blocks to a `.tf.json` file.
+// Blocks are never moved across files, the members of their objects are ordered like the native syntax.
+func (f *HclFile) autoFixJSON() error {
+	for _, m := range f.json.Members {
+		switch m.Name {
+		case "resource":
+			if !f.dir.ruleEnabled(RuleResourceOrder) {
+				continue
+			}
+			for _, resources := range jsonObjects(m.Value) {
+				for _, resourceType := range resources.Members {
+					for _, resources := range jsonObjects(resourceType.Value) {
+						for _, resource := range resources.Members {
+							if err := f.fixJSONResource(resourceType.Name, resource); err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		case "variable":
+			for _, variables := range jsonObjects(m.Value) {
+				f.fixJSONVariables(variables)
+			}
+		case "output":
+			for _, outputs := range jsonObjects(m.Value) {
+				f.fixJSONOutputs(outputs)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *HclFile) fixJSONResource(resourceType string, resource *jsonMember) error {
+	for _, body := range jsonObjects(resource.Value) {
+		block := jsonSyntaxBlock("resource", []string{resourceType, resource.Name}, body)
+		schema, err := f.jsonResourceSchema(block)
+		if err != nil {
+			if f.skipBlock(block, err) {
+				continue
+			}
+			return err
+		}
+		if sortJSONBody(body, schema, true) {
+			f.dir.recordFix(block, RuleResourceOrder)
+		}
+	}
+	return nil
+}
+
+func (f *HclFile) jsonResourceSchema(block *hclsyntax.Block) (*tfjson.SchemaBlock, error) {
+	resourceType := block.Labels[0]
+	var provider providerAddress
+	var version string
+	// Special handling for builtin resources like terraform_data
+	if resourceType != "terraform_data" {
+		var err error
+		provider, err = resolveProvider(NewHclBlock(block, nil), f)
+		if err != nil {
+			return nil, err
+		}
+		version, err = resolveProviderVersion(provider, f)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return queryProviderBlockSchema(f.dir.schemaGetter(), []string{"resource", resourceType}, provider, version)
+}
+
+// schemaItemGroup is the position of an argument or a nested block in a sorted resource body, it follows ResourceBlock.AutoFix.
+type schemaItemGroup int
+
+const (
+	groupComment schemaItemGroup = iota
+	groupHeadMetaArg
+	groupRequiredAttr
+	groupOptionalAttr
+	groupRequiredNestedBlock
+	groupOptionalNestedBlock
+	groupTailMetaArg
+	groupTailMetaNestedBlock
+)
+
+// sortJSONBody sorts the members of a resource or nested block object by the schema, nested blocks are sorted recursively.
+// JSON doesn't tell attributes from nested blocks, a member is a nested block only if the schema says so.
+// It returns true if the order of any members has been changed.
+func sortJSONBody(body *jsonObject, schema *tfjson.SchemaBlock, root bool) bool {
+	changed := false
+	groups := make(map[*jsonMember]schemaItemGroup, len(body.Members))
+	for _, m := range body.Members {
+		groups[m] = schemaItemGroupOf(m.Name, schema, root)
+		if schema == nil || m.Name == "dynamic" {
+			continue
+		}
+		if nb, ok := schema.NestedBlocks[m.Name]; ok {
+			for _, nested := range jsonObjects(m.Value) {
+				changed = sortJSONBody(nested, nb.Block, false) || changed
+			}
+		}
+	}
+	original := slices.Clone(body.Members)
+	sort.SliceStable(body.Members, func(i, j int) bool {
+		a, b := body.Members[i], body.Members[j]
+		if groups[a] != groups[b] {
+			return groups[a] < groups[b]
+		}
+		switch groups[a] {
+		case groupComment:
+			return false
+		case groupHeadMetaArg:
+			return headMetaArgPriorities[a.Name] < headMetaArgPriorities[b.Name]
+		}
+		return a.Name < b.Name
+	})
+	return changed || !slices.Equal(original, body.Members)
+}
+
+func schemaItemGroupOf(name string, schema *tfjson.SchemaBlock, root bool) schemaItemGroup {
+	if name == jsonCommentKey {
+		return groupComment
+	}
+	if root {
+		if _, ok := headMetaArgPriority[name]; ok {
+			return groupHeadMetaArg
+		}
+		switch name {
+		case "depends_on":
+			return groupTailMetaArg
+		case "lifecycle":
+			return groupTailMetaNestedBlock
+		}
+	}
+	if schema == nil {
+		return groupOptionalAttr
+	}
+	if name == "dynamic" {
+		return groupOptionalNestedBlock
+	}
+	if nb, ok := schema.NestedBlocks[name]; ok {
+		if nb.MinItems > 0 {
+			return groupRequiredNestedBlock
+		}
+		return groupOptionalNestedBlock
+	}
+	if attr, ok := schema.Attributes[name]; ok && attr.Required {
+		return groupRequiredAttr
+	}
+	return groupOptionalAttr
+}
+
+func (f *HclFile) fixJSONVariables(variables *jsonObject) {
+	override := isOverrideFile(f.FileName)
+	for _, variable := range variables.Members {
+		for _, body := range jsonObjects(variable.Value) {
+			block := jsonSyntaxBlock("variable", []string{variable.Name}, body)
+			if f.dir.ruleEnabled(RuleVariableNullable) && !override && jsonValueIs(body, "nullable", true) {
+				body.remove("nullable")
+				f.dir.recordFix(block, RuleVariableNullable)
+			}
+			if f.dir.ruleEnabled(RuleVariableSensitive) && !override && jsonValueIs(body, "sensitive", false) {
+				body.remove("sensitive")
+				f.dir.recordFix(block, RuleVariableSensitive)
+			}
+			if f.dir.ruleEnabled(RuleVariableOrder) && sortJSONMembers(body, func(a, b *jsonMember) bool {
+				return jsonVariablePriority(a.Name) < jsonVariablePriority(b.Name)
+			}) {
+				f.dir.recordFix(block, RuleVariableOrder)
+			}
+		}
+	}
+	if !f.dir.ruleEnabled(RuleVariableOrder) {
+		return
+	}
+	original := slices.Clone(variables.Members)
+	sortJSONMembers(variables, func(a, b *jsonMember) bool {
+		requiredA, requiredB := isRequiredJSONVariable(a), isRequiredJSONVariable(b)
+		if requiredA != requiredB {
+			return requiredA
+		}
+		return a.Name < b.Name
+	})
+	f.recordMovedJSONMembers("variable", original, variables.Members, RuleVariableOrder)
+}
+
+// jsonVariablePriority follows VariableBlock.write, nested `validation` blocks are written after the attributes.
+func jsonVariablePriority(name string) int {
+	if name == "validation" {
+		return len(variableAttributePriorities)
+	}
+	return variableAttributePriorities[name]
+}
+
+func isRequiredJSONVariable(variable *jsonMember) bool {
+	for _, body := range jsonObjects(variable.Value) {
+		if _, ok := body.get("default"); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *HclFile) fixJSONOutputs(outputs *jsonObject) {
+	override := isOverrideFile(f.FileName)
+	for _, output := range outputs.Members {
+		for _, body := range jsonObjects(output.Value) {
+			block := jsonSyntaxBlock("output", []string{output.Name}, body)
+			if f.dir.ruleEnabled(RuleOutputSensitive) && !override && jsonValueIs(body, "sensitive", false) {
+				body.remove("sensitive")
+				f.dir.recordFix(block, RuleOutputSensitive)
+			}
+			if f.dir.ruleEnabled(RuleOutputOrder) && sortJSONMembers(body, func(a, b *jsonMember) bool {
+				// Nested `precondition` blocks are kept after the attributes.
+				if (a.Name == "precondition") != (b.Name == "precondition") {
+					return b.Name == "precondition"
+				}
+				return a.Name < b.Name
+			}) {
+				f.dir.recordFix(block, RuleOutputOrder)
+			}
+		}
+	}
+	if f.dir.ruleEnabled(RuleOutputOrder) {
+		original := slices.Clone(outputs.Members)
+		sortJSONMembers(outputs, func(a, b *jsonMember) bool {
+			return a.Name < b.Name
+		})
+		f.recordMovedJSONMembers("output", original, outputs.Members, RuleOutputOrder)
+	}
+}
+
+// recordMovedJSONMembers records the rule for the `variable` or `output` blocks whose position has been changed by the sort.
+func (f *HclFile) recordMovedJSONMembers(blockType string, original, sorted []*jsonMember, rule string) {
+	for i, m := range sorted {
+		if m == original[i] || m.Name == jsonCommentKey {
+			continue
+		}
+		for _, body := range jsonObjects(m.Value) {
+			f.dir.recordFix(jsonSyntaxBlock(blockType, []string{m.Name}, body), rule)
+		}
+	}
+}
+
+// sortJSONMembers sorts the members with a stable sort, the comment stays on the top.
+// It returns true if the order of the members has been changed.
+func sortJSONMembers(o *jsonObject, less func(a, b *jsonMember) bool) bool {
+	original := slices.Clone(o.Members)
+	sort.SliceStable(o.Members, func(i, j int) bool {
+		a, b := o.Members[i], o.Members[j]
+		if a.Name == jsonCommentKey || b.Name == jsonCommentKey {
+			return a.Name == jsonCommentKey && b.Name != jsonCommentKey
+		}
+		return less(a, b)
+	})
+	return !slices.Equal(original, o.Members)
+}
+
+func jsonValueIs(o *jsonObject, name string, expected bool) bool {
+	v, ok := o.get(name)
+	if !ok {
+		return false
+	}
+	b, ok := v.(bool)
+	return ok && b == expected
+}
+
+// jsonSyntaxBlock describes the object of a block in JSON syntax as a native syntax block, so it can be used to
+// resolve the provider, record warnings and compare blocks in reports. Every member is an attribute of the block.
+func jsonSyntaxBlock(blockType string, labels []string, body *jsonObject) *hclsyntax.Block {
+	attributes := make(hclsyntax.Attributes, len(body.Members))
+	for _, m := range body.Members {
+		attributes[m.Name] = &hclsyntax.Attribute{
+			Name:      m.Name,
+			Expr:      jsonSyntaxExpression(m),
+			SrcRange:  m.Range,
+			NameRange: m.Range,
+		}
+	}
+	start := hcl.Range{Filename: body.Range.Filename, Start: body.Range.Start, End: body.Range.Start}
+	end := hcl.Range{Filename: body.Range.Filename, Start: body.Range.End, End: body.Range.End}
+	return &hclsyntax.Block{
+		Type:   blockType,
+		Labels: labels,
+		Body: &hclsyntax.Body{
+			Attributes: attributes,
+			SrcRange:   body.Range,
+			EndRange:   end,
+		},
+		TypeRange:       start,
+		OpenBraceRange:  start,
+		CloseBraceRange: end,
+	}
+}
+
+func jsonSyntaxExpression(m *jsonMember) hclsyntax.Expression {
+	switch v := m.Value.(type) {
+	case string:
+		// `provider` refers to a provider configuration like `azurerm.west`.
+		if m.Name == "provider" {
+			if expr, diags := hclsyntax.ParseExpression([]byte(v), m.Range.Filename, m.Range.Start); !diags.HasErrors() {
+				return expr
+			}
+		}
+		return &hclsyntax.LiteralValueExpr{Val: cty.StringVal(v), SrcRange: m.Range}
+	case bool:
+		return &hclsyntax.LiteralValueExpr{Val: cty.BoolVal(v), SrcRange: m.Range}
+	}
+	return &hclsyntax.LiteralValueExpr{Val: cty.DynamicVal, SrcRange: m.Range}
+}
+
+// jsonSyntaxBlocks returns the `resource`, `variable` and `output` blocks in a `.tf.json` file, in the order they appear.
+func jsonSyntaxBlocks(doc *jsonObject) []*hclsyntax.Block {
+	var r []*hclsyntax.Block
+	for _, m := range doc.Members {
+		for _, blocks := range jsonObjects(m.Value) {
+			for _, label := range blocks.Members {
+				switch m.Name {
+				case "resource":
+					for _, resources := range jsonObjects(label.Value) {
+						for _, resource := range resources.Members {
+							for _, body := range jsonObjects(resource.Value) {
+								r = append(r, jsonSyntaxBlock(m.Name, []string{label.Name, resource.Name}, body))
+							}
+						}
+					}
+				case "variable", "output":
+					for _, body := range jsonObjects(label.Value) {
+						r = append(r, jsonSyntaxBlock(m.Name, []string{label.Name}, body))
+					}
+				}
+			}
+		}
+	}
+	return r
+}
+
+// jsonConfigBody returns the `terraform` blocks, with their `required_providers` only, and the `module` blocks in a `.tf.json` file,
+// they're what the folder reads before the files are fixed.
+func jsonConfigBody(doc *jsonObject) *hclsyntax.Body {
+	body := &hclsyntax.Body{}
+	for _, m := range doc.Members {
+		for _, o := range jsonObjects(m.Value) {
+			switch m.Name {
+			case "terraform":
+				tb := &hclsyntax.Block{Type: m.Name, Body: &hclsyntax.Body{}}
+				for _, member := range o.Members {
+					if member.Name != "required_providers" {
+						continue
+					}
+					for _, providers := range jsonObjects(member.Value) {
+						tb.Body.Blocks = append(tb.Body.Blocks, jsonRequiredProvidersBlock(providers))
+					}
+				}
+				body.Blocks = append(body.Blocks, tb)
+			case "module":
+				for _, module := range o.Members {
+					for _, mb := range jsonObjects(module.Value) {
+						body.Blocks = append(body.Blocks, jsonSyntaxBlock(m.Name, []string{module.Name}, mb))
+					}
+				}
+			}
+		}
+	}
+	return body
+}
+
+// jsonRequiredProvidersBlock converts `required_providers`, an entry is either a legacy version constraint or an object
+// whose string members, e.g. `source`, are kept as an object constructor, like requiredProviderAddress expects.
+func jsonRequiredProvidersBlock(providers *jsonObject) *hclsyntax.Block {
+	block := jsonSyntaxBlock("required_providers", nil, providers)
+	for _, m := range providers.Members {
+		entry, ok := m.Value.(*jsonObject)
+		if !ok {
+			continue
+		}
+		obj := &hclsyntax.ObjectConsExpr{SrcRange: m.Range}
+		for _, item := range entry.Members {
+			obj.Items = append(obj.Items, hclsyntax.ObjectConsItem{
+				KeyExpr:   &hclsyntax.LiteralValueExpr{Val: cty.StringVal(item.Name), SrcRange: item.Range},
+				ValueExpr: jsonSyntaxExpression(item),
+			})
+		}
+		block.Body.Attributes[m.Name].Expr = obj
+	}
+	return block
+}
@@ -0,0 +1,172 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const unsortedJSONConfig = `{
+  "resource": {
+    "azurerm_resource_group": {
+      "this": {
+        "//": "the resource group",
+        "lifecycle": {"ignore_changes": ["tags"]},
+        "tags": {"env": "${var.env > 0}"},
+        "timeouts": {"read": "5m", "create": "10m"},
+        "depends_on": ["terraform_data.a"],
+        "name": "rg",
+        "location": "eastus",
+        "count": 1,
+        "provider": "azurerm.west"
+      }
+    }
+  },
+  "variable": {
+    "b": {"default": 1.50, "type": "number"},
+    "a": {"nullable": true, "description": "a", "type": "string", "sensitive": false}
+  },
+  "output": {
+    "z": {"value": "${var.a}", "sensitive": false, "description": "z"},
+    "a": {"value": "${var.b}"}
+  }
+}`
+
+const sortedJSONConfig = `{
+  "resource": {
+    "azurerm_resource_group": {
+      "this": {
+        "//": "the resource group",
+        "provider": "azurerm.west",
+        "count": 1,
+        "location": "eastus",
+        "name": "rg",
+        "tags": {
+          "env": "${var.env > 0}"
+        },
+        "timeouts": {
+          "create": "10m",
+          "read": "5m"
+        },
+        "depends_on": [
+          "terraform_data.a"
+        ],
+        "lifecycle": {
+          "ignore_changes": [
+            "tags"
+          ]
+        }
+      }
+    }
+  },
+  "variable": {
+    "a": {
+      "type": "string",
+      "description": "a"
+    },
+    "b": {
+      "type": "number",
+      "default": 1.50
+    }
+  },
+  "output": {
+    "a": {
+      "value": "${var.b}"
+    },
+    "z": {
+      "description": "z",
+      "value": "${var.a}"
+    }
+  }
+}
+`
+
+func TestRunShouldFixJSONConfig(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf.json": unsortedJSONConfig,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf.json")
+	require.NoError(t, err)
+	assert.Equal(t, sortedJSONConfig, string(content))
+	// The variable and the output stay in the JSON file.
+	for _, name := range []string{"/module/variables.tf", "/module/outputs.tf"} {
+		exists, err := afero.Exists(mockFs, name)
+		require.NoError(t, err)
+		assert.False(t, exists, name)
+	}
+
+	rules := make(map[string][]string)
+	for _, fix := range result.Fixes {
+		rules[fix.Block] = append(rules[fix.Block], fix.Rule)
+		assert.Equal(t, "/module/main.tf.json", fix.File)
+	}
+	assert.Equal(t, map[string][]string{
+		"resource.azurerm_resource_group.this": {pkg.RuleResourceOrder},
+		"variable.a":                           {pkg.RuleVariableNullable, pkg.RuleVariableSensitive, pkg.RuleVariableOrder},
+		"variable.b":                           {pkg.RuleVariableOrder},
+		"output.a":                             {pkg.RuleOutputOrder},
+		"output.z":                             {pkg.RuleOutputSensitive, pkg.RuleOutputOrder},
+	}, rules)
+}
+
+func TestRunShouldKeepSortedJSONConfig(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf.json": sortedJSONConfig,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Changes)
+	assert.Empty(t, result.Fixes)
+}
+
+func TestRunWithDisabledRulesShouldKeepJSONObjectOrder(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf.json": `{"resource": {"azurerm_resource_group": {"this": {"name": "rg", "location": "eastus"}}}}`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{
+		DisabledRules: []string{pkg.RuleResourceOrder},
+	})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "resource": {
+    "azurerm_resource_group": {
+      "this": {
+        "name": "rg",
+        "location": "eastus"
+      }
+    }
+  }
+}
+`, string(content))
+}
+
+func TestRunWithInvalidJSONConfigShouldReturnError(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf.json": `{"resource": `,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{})
+	assert.Error(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"resource": `, string(content))
+}
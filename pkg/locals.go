@@ -19,6 +19,10 @@ func BuildLocalsBlock(block *HclBlock, file *HclFile) *LocalsBlock {
 	return r
 }
 
+func (b *LocalsBlock) rule() string {
+	return RuleLocalsOrder
+}
+
 func (b *LocalsBlock) AutoFix() error {
 	attributes := b.HclBlock.WriteBlock.Body().Attributes()
 	b.HclBlock.Clear()
@@ -3,8 +3,12 @@ package pkg
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/hashicorp/terraform-config-inspect/tfconfig"
 	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/spf13/afero"
@@ -22,13 +26,20 @@ type ModuleBlock struct {
 	RequiredArgs Args
 	OptionalArgs Args
 	dir          string
+	hclFile      *HclFile
+	// schema describes the child module's variables, it's loaded by schemaBlock.
+	schema *tfjson.SchemaBlock
+	// overriding is true for a module block in an override file, its arguments are sorted but never added or removed.
+	overriding bool
 }
 
 func BuildModuleBlock(block *HclBlock, dir string, file *HclFile) (*ModuleBlock, error) {
 	b := &ModuleBlock{
-		dir:      dir,
-		HclBlock: block,
-		File:     file.File,
+		dir:        dir,
+		HclBlock:   block,
+		File:       file.File,
+		hclFile:    file,
+		overriding: isOverrideFile(file.FileName),
 	}
 	err := buildArgs(b, block.Attributes())
 	if err != nil {
@@ -38,6 +49,19 @@ func BuildModuleBlock(block *HclBlock, dir string, file *HclFile) (*ModuleBlock,
 }
 
 func (b *ModuleBlock) AutoFix() error {
+	b.fixArguments()
+	if !b.hclFile.dir.ruleEnabled(RuleModuleOrder) {
+		return nil
+	}
+	return b.hclFile.dir.applyRule(b.HclBlock, RuleModuleOrder, func() error {
+		b.sortArguments()
+		return nil
+	})
+}
+
+// sortArguments sorts the arguments and the keys of the objects passed to the child module.
+func (b *ModuleBlock) sortArguments() {
+	b.sortObjectArgs()
 	blockToFix := b.HclBlock
 	singleLineBlock := blockToFix.isSingleLineBlock()
 	empty := true
@@ -63,7 +87,114 @@ func (b *ModuleBlock) AutoFix() error {
 	if singleLineBlock && !empty {
 		blockToFix.appendNewline()
 	}
-	return nil
+}
+
+// moduleRulesEnabled returns true if any rule fixing module blocks is enabled, the child module is loaded for them only.
+func moduleRulesEnabled(d *directory) bool {
+	return d.ruleEnabled(RuleModuleOrder) || d.ruleEnabled(RuleModuleUndeclaredArgument) ||
+		d.ruleEnabled(RuleModuleRemoveUndeclaredArgument) || d.ruleEnabled(RuleModuleRequiredVariable)
+}
+
+// fixArguments compares the arguments with the child module's variables. Arguments the child module doesn't declare are
+// reported, or removed when RuleModuleRemoveUndeclaredArgument is enabled, missing required variables are added as `null` stubs
+// when RuleModuleRequiredVariable is enabled. Override files are skipped, their arguments are merged into the original
+// module block, so a stub would replace the real value.
+func (b *ModuleBlock) fixArguments() {
+	if b.schema == nil || b.overriding {
+		return
+	}
+	d := b.hclFile.dir
+	body := b.HclBlock.WriteBlock.Body()
+	var declared Args
+	for _, arg := range b.OptionalArgs {
+		if _, ok := b.schema.Attributes[arg.Name]; ok {
+			declared = append(declared, arg)
+			continue
+		}
+		if d.ruleEnabled(RuleModuleRemoveUndeclaredArgument) {
+			body.RemoveAttribute(arg.Name)
+			d.recordFix(b.HclBlock.Block, RuleModuleRemoveUndeclaredArgument)
+			continue
+		}
+		declared = append(declared, arg)
+		if d != nil && d.ruleEnabled(RuleModuleUndeclaredArgument) {
+			b.hclFile.ruleWarning(b.HclBlock.Block, RuleModuleUndeclaredArgument, fmt.Sprintf("argument %s is not declared by the child module", arg.Name))
+		}
+	}
+	b.OptionalArgs = declared
+	if !d.ruleEnabled(RuleModuleRequiredVariable) {
+		return
+	}
+	present := make(map[string]bool)
+	for _, arg := range b.RequiredArgs {
+		present[arg.Name] = true
+	}
+	var missing []string
+	for name, variable := range b.schema.Attributes {
+		if variable.Required && !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		body.SetAttributeValue(name, cty.NullVal(cty.DynamicPseudoType))
+		b.RequiredArgs = append(b.RequiredArgs, &Arg{Name: name, File: b.File})
+		d.recordFix(b.HclBlock.Block, RuleModuleRequiredVariable)
+		if d != nil {
+			b.hclFile.ruleWarning(b.HclBlock.Block, RuleModuleRequiredVariable, fmt.Sprintf("required variable %s is missing, a null stub has been added", name))
+		}
+	}
+}
+
+// sortObjectArgs sorts the keys of the objects passed to the child module's variables by the variables' type constraints.
+func (b *ModuleBlock) sortObjectArgs() {
+	if b.schema == nil {
+		return
+	}
+	body := b.HclBlock.WriteBlock.Body()
+	for name, attr := range body.Attributes() {
+		variable, ok := b.schema.Attributes[name]
+		if !ok {
+			continue
+		}
+		body.SetAttributeRaw(name, sortObjectByType(attr.Expr().BuildTokens(hclwrite.Tokens{}), variable.AttributeType))
+	}
+}
+
+// sortObjectByType sorts the keys of the object constructors in a value of the type like the codex orders them,
+// required attributes come first, then optional ones, both sorted alphabetically. Keys unknown to the type are treated as optional.
+// Objects in attributes, lists, sets and maps are sorted recursively, the keys of maps keep their order.
+func sortObjectByType(tokens hclwrite.Tokens, ty cty.Type) hclwrite.Tokens {
+	switch {
+	case ty.IsObjectType():
+		return sortObjectTokens(tokens, func(a, b string) bool {
+			requiredA, requiredB := isRequiredObjectAttribute(ty, a), isRequiredObjectAttribute(ty, b)
+			if requiredA != requiredB {
+				return requiredA
+			}
+			return a < b
+		}, func(key string, value hclwrite.Tokens) hclwrite.Tokens {
+			if !ty.HasAttribute(key) {
+				return value
+			}
+			return sortObjectByType(value, ty.AttributeType(key))
+		})
+	case ty.IsListType() || ty.IsSetType():
+		return mapTupleObjects(tokens, func(object hclwrite.Tokens) hclwrite.Tokens {
+			return sortObjectByType(object, ty.ElementType())
+		})
+	case ty.IsMapType():
+		return sortObjectTokens(tokens, func(a, b string) bool {
+			return false
+		}, func(_ string, value hclwrite.Tokens) hclwrite.Tokens {
+			return sortObjectByType(value, ty.ElementType())
+		})
+	}
+	return tokens
+}
+
+func isRequiredObjectAttribute(ty cty.Type, name string) bool {
+	return ty.HasAttribute(name) && !ty.AttributeOptional(name)
 }
 
 func (b *ModuleBlock) addTailMetaArg(arg *Arg) {
@@ -88,7 +219,15 @@ func (b *ModuleBlock) schemaBlock() (*tfjson.SchemaBlock, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to check if module %s exists: %w", moduleName, err)
 	}
-	sourceAttr, diag := b.HclBlock.Attributes()["source"].Expr.Value(&hcl.EvalContext{})
+	source, ok := b.HclBlock.Attributes()["source"]
+	if !ok {
+		if b.overriding {
+			// An override file may set only some arguments of the module, the `source` stays in the original block.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("module %s has no `source` attribute", moduleName)
+	}
+	sourceAttr, diag := source.Expr.Value(&hcl.EvalContext{})
 	if diag.HasErrors() {
 		return nil, fmt.Errorf("failed to eval `source` attribute: %w", diag)
 	}
@@ -109,15 +248,32 @@ func (b *ModuleBlock) schemaBlock() (*tfjson.SchemaBlock, error) {
 	}
 	for _, variable := range module.Variables {
 		schemaBlock.Attributes[variable.Name] = &tfjson.SchemaAttribute{
-			AttributeType: cty.DynamicPseudoType,
+			AttributeType: variableType(variable),
 			Required:      variable.Required,
 			Optional:      !variable.Required,
 			Sensitive:     variable.Sensitive,
 		}
 	}
+	b.schema = schemaBlock
 	return schemaBlock, nil
 }
 
+// variableType parses the type constraint of a variable, a variable without a valid type constraint accepts any value.
+func variableType(variable *tfconfig.Variable) cty.Type {
+	if variable.Type == "" {
+		return cty.DynamicPseudoType
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(variable.Type), variable.Pos.Filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.DynamicPseudoType
+	}
+	ty, _, diags := typeexpr.TypeConstraintWithDefaults(expr)
+	if diags.HasErrors() {
+		return cty.DynamicPseudoType
+	}
+	return ty
+}
+
 var moduleHeadMetaArgs = map[string]int{"for_each": 0, "count": 0, "source": 1, "version": 2, "providers": 3}
 var moduleTailMetaArgs = map[string]int{"depends_on": 0}
 
@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
 )
 
 func TestLoadLocalModuleAsBlockSchema(t *testing.T) {
@@ -94,3 +95,225 @@ func TestModuleAutoFix(t *testing.T) {
 }
 `, fixed)
 }
+
+func TestModuleAutoFixShouldSortObjectArgsByVariableTypes(t *testing.T) {
+	moduleHclConfig := `module "network" {
+  source = "./child"
+
+  network = {
+    subnets = [
+      {
+        nat_gateway = {
+          id = "id"
+        }
+        name             = "a"
+        address_prefixes = ["10.0.0.0/24"]
+      },
+      {
+        address_prefixes = ["10.0.1.0/24"]
+        name             = "b"
+      }
+    ]
+    dns_servers   = []
+    unknown       = true
+    address_space = ["10.0.0.0/16"]
+    name          = "vnet"
+  }
+  role_assignments = {
+    z = {
+      description                = "z"
+      principal_id               = "p"
+      role_definition_id_or_name = "Reader"
+    }
+    a = { principal_id = "p", role_definition_id_or_name = "Owner" }
+  }
+  tags   = { z = "z", a = "a" }
+  legacy = [{ b = 1, a = 2 }]
+}
+`
+	file, diag := ParseConfig([]byte(moduleHclConfig), "test.tf")
+	require.False(t, diag.HasErrors())
+	sut, err := BuildModuleBlock(file.GetBlock(0), filepath.Join("test-fixture", "object_module"), file)
+	require.NoError(t, err)
+	err = sut.AutoFix()
+	require.NoError(t, err)
+	fixed := string(hclwrite.Format(sut.HclBlock.WriteBlock.BuildTokens(nil).Bytes()))
+	assert.Equal(t, `module "network" {
+  source = "./child"
+
+  network = {
+    address_space = ["10.0.0.0/16"]
+    name          = "vnet"
+    dns_servers   = []
+    subnets = [
+      {
+        address_prefixes = ["10.0.0.0/24"]
+        name             = "a"
+        nat_gateway = {
+          id = "id"
+        }
+      },
+      {
+        address_prefixes = ["10.0.1.0/24"]
+        name             = "b"
+      }
+    ]
+    unknown = true
+  }
+  legacy = [{ b = 1, a = 2 }]
+  role_assignments = {
+    z = {
+      principal_id               = "p"
+      role_definition_id_or_name = "Reader"
+      description                = "z"
+    }
+    a = { principal_id = "p", role_definition_id_or_name = "Owner" }
+  }
+  tags = { z = "z", a = "a" }
+}
+`, fixed)
+}
+
+func TestSortObjectByTypeShouldKeepForExpressions(t *testing.T) {
+	f, diags := hclwrite.ParseConfig([]byte("a = { for k, v in var.m : k => v }\n"), "main.tf", hcl.InitialPos)
+	require.False(t, diags.HasErrors())
+	tokens := f.Body().GetAttribute("a").Expr().BuildTokens(nil)
+	ty := cty.Object(map[string]cty.Type{"v": cty.String})
+	assert.Equal(t, " { for k, v in var.m : k => v }", string(sortObjectByType(tokens, ty).Bytes()))
+}
+
+func TestModuleAutoFixShouldKeepForExpressions(t *testing.T) {
+	moduleHclConfig := `module "network" {
+  source = "./child"
+
+  network          = { for k, v in var.network : k => v }
+  role_assignments = { for k, v in var.role_assignments : k => { role_definition_id_or_name = v.role, principal_id = v.id } }
+}
+`
+	file, diag := ParseConfig([]byte(moduleHclConfig), "test.tf")
+	require.False(t, diag.HasErrors())
+	sut, err := BuildModuleBlock(file.GetBlock(0), filepath.Join("test-fixture", "object_module"), file)
+	require.NoError(t, err)
+	require.NoError(t, sut.AutoFix())
+	fixed := string(hclwrite.Format(sut.HclBlock.WriteBlock.BuildTokens(nil).Bytes()))
+	assert.Equal(t, moduleHclConfig, fixed)
+}
+
+func TestRunShouldFixArgumentsNotMatchingChildModuleVariables(t *testing.T) {
+	dir := filepath.Join("test-fixture", "stale_module_args")
+	cases := []struct {
+		desc             string
+		enabledRules     []string
+		expected         string
+		expectedWarnings []string
+		expectedRules    []string
+	}{
+		{
+			desc:         "report undeclared argument",
+			enabledRules: []string{RuleModuleRequiredVariable},
+			expected: `module "consul" {
+  source = "../local_module/test_module"
+
+  required_variable = null
+  optional_variable = "value"
+  removed_variable  = "value"
+}
+`,
+			expectedWarnings: []string{RuleModuleUndeclaredArgument, RuleModuleRequiredVariable},
+			expectedRules:    []string{RuleModuleRequiredVariable, RuleModuleOrder},
+		},
+		{
+			desc:         "remove undeclared argument",
+			enabledRules: []string{RuleModuleRemoveUndeclaredArgument, RuleModuleRequiredVariable},
+			expected: `module "consul" {
+  source = "../local_module/test_module"
+
+  required_variable = null
+  optional_variable = "value"
+}
+`,
+			expectedWarnings: []string{RuleModuleRequiredVariable},
+			// The stub is appended to the block, the order fix moves it before the optional arguments.
+			expectedRules: []string{RuleModuleRemoveUndeclaredArgument, RuleModuleRequiredVariable, RuleModuleOrder},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			result, err := Run(dir, Options{
+				DryRun:       true,
+				EnabledRules: c.enabledRules,
+			})
+			require.NoError(t, err)
+			require.Len(t, result.Changes, 1)
+			assert.Equal(t, c.expected, string(result.Changes[0].Fixed))
+			var warnings []string
+			for _, w := range result.Warnings {
+				warnings = append(warnings, w.Rule)
+			}
+			assert.Equal(t, c.expectedWarnings, warnings)
+			var rules []string
+			for _, fix := range result.Fixes {
+				rules = append(rules, fix.Rule)
+			}
+			assert.Equal(t, c.expectedRules, rules)
+		})
+	}
+}
+
+func TestRunWithDisabledModuleOrderShouldFixArgumentsInPlace(t *testing.T) {
+	result, err := Run(filepath.Join("test-fixture", "stale_module_args"), Options{
+		DryRun:        true,
+		EnabledRules:  []string{RuleModuleRemoveUndeclaredArgument, RuleModuleRequiredVariable},
+		DisabledRules: []string{RuleModuleOrder},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, `module "consul" {
+  source = "../local_module/test_module"
+
+  optional_variable = "value"
+  required_variable = null
+}
+`, string(result.Changes[0].Fixed))
+}
+
+func TestRunShouldNotFixArgumentsOfModuleBlocksInOverrideFiles(t *testing.T) {
+	dir := filepath.Join("test-fixture", "override_module_args")
+	result, err := Run(dir, Options{
+		DryRun:       true,
+		EnabledRules: []string{RuleModuleRemoveUndeclaredArgument, RuleModuleRequiredVariable},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, filepath.Join(dir, "main_override.tf"), result.Changes[0].Path)
+	// Sorted only, neither a null stub for required_variable nor the removal of removed_variable.
+	assert.Equal(t, `module "consul" {
+  source = "../local_module/test_module"
+
+  optional_variable = "value"
+  removed_variable  = "value"
+}
+`, string(result.Changes[0].Fixed))
+	assert.Empty(t, result.Warnings)
+}
+
+func TestRunShouldSortModuleBlocksWithoutSourceInOverrideFiles(t *testing.T) {
+	dir := filepath.Join("test-fixture", "override_module_no_source")
+	result, err := Run(dir, Options{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, filepath.Join(dir, "main_override.tf"), result.Changes[0].Path)
+	assert.Equal(t, `module "consul" {
+  optional_variable = "value"
+  removed_variable  = "value"
+}
+`, string(result.Changes[0].Fixed))
+}
+
+func TestModuleBlockWithoutSourceShouldFail(t *testing.T) {
+	file, diag := ParseConfig([]byte("module \"consul\" {\n  required_variable = \"value\"\n}\n"), "main.tf")
+	require.False(t, diag.HasErrors())
+	_, err := BuildModuleBlock(file.GetBlock(0), filepath.Join("test-fixture", "local_module"), file)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "module consul has no `source` attribute")
+}
@@ -0,0 +1,386 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/afero"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// registryModuleSourceRegex matches module registry addresses like `Azure/avm-res-network-vnet/azurerm`,
+// with an optional hostname and sub folder.
+var registryModuleSourceRegex = regexp.MustCompile(`^([0-9A-Za-z.-]+\.[0-9A-Za-z-]+(:\d+)?/)?[0-9A-Za-z][0-9A-Za-z_-]*/[0-9A-Za-z][0-9A-Za-z_-]*/[0-9a-z]+(//.*)?$`)
+
+var versionConstraintRegex = regexp.MustCompile(`^(=|!=|>=|<=|>|<|~>)?\s*v?(\d+(\.\d+)*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// gitCommitRegex matches the refs which are commits already.
+var gitCommitRegex = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// isRegistryModuleSource checks whether the source is a module registry address, the shorthands go-getter
+// supports like `github.com/org/repo` are not.
+func isRegistryModuleSource(source string) bool {
+	if strings.HasPrefix(source, "github.com/") || strings.HasPrefix(source, "bitbucket.org/") {
+		return false
+	}
+	return registryModuleSourceRegex.MatchString(source)
+}
+
+// gitModuleRef returns the `ref` argument of a `git::` source, ok is false if the source isn't a `git::` source.
+func gitModuleRef(source string) (ref string, ok bool) {
+	if !strings.HasPrefix(source, "git::") {
+		return "", false
+	}
+	_, query, found := strings.Cut(source, "?")
+	if !found {
+		return "", true
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", true
+	}
+	return values.Get("ref"), true
+}
+
+// boundedVersionConstraint checks whether the constraint has an upper bound, like `1.2.3`, `~> 1.2` or `>= 1.2, < 2.0`.
+// `~> 1` is unbounded since it allows the major version to increase.
+func boundedVersionConstraint(constraint string) (bool, error) {
+	if _, err := version.NewConstraint(constraint); err != nil {
+		return false, err
+	}
+	for _, c := range strings.Split(constraint, ",") {
+		match := versionConstraintRegex.FindStringSubmatch(strings.TrimSpace(c))
+		if match == nil {
+			continue
+		}
+		switch match[1] {
+		case "", "=", "<", "<=":
+			return true, nil
+		case "~>":
+			if strings.Contains(match[2], ".") {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// checkModuleSource reports the module hygiene rules the block violates, and pins the branch ref of a `git::` source
+// when RuleModulePinGitRef is enabled. Sources and versions which aren't literal strings are not checked.
+func (f *HclFile) checkModuleSource(block *HclBlock) error {
+	if f.dir == nil || len(block.Labels) != 1 {
+		return nil
+	}
+	source := literalString(block.Body.Attributes["source"])
+	if source == "" {
+		return nil
+	}
+	versionAttr, hasVersion := block.Body.Attributes["version"]
+	if isRegistryModuleSource(source) && !hasVersion && f.dir.ruleEnabled(RuleModuleRegistryVersion) {
+		f.ruleWarning(block.Block, RuleModuleRegistryVersion, fmt.Sprintf("registry module %s has no version", source))
+	}
+	if constraint := literalString(versionAttr); constraint != "" && f.dir.ruleEnabled(RuleModuleVersionConstraint) {
+		bounded, err := boundedVersionConstraint(constraint)
+		switch {
+		case err != nil:
+			f.ruleWarning(block.Block, RuleModuleVersionConstraint, fmt.Sprintf("invalid version constraint %q: %s", constraint, err))
+		case !bounded:
+			f.ruleWarning(block.Block, RuleModuleVersionConstraint, fmt.Sprintf("version constraint %q has no upper bound", constraint))
+		}
+	}
+	ref, isGit := gitModuleRef(source)
+	if !isGit {
+		return nil
+	}
+	if ref == "" {
+		if f.dir.ruleEnabled(RuleModuleGitRef) {
+			f.ruleWarning(block.Block, RuleModuleGitRef, fmt.Sprintf("git source %s has no ref", source))
+		}
+		return nil
+	}
+	if !f.dir.ruleEnabled(RuleModulePinGitRef) || gitCommitRegex.MatchString(ref) {
+		return nil
+	}
+	pinned, err := f.dir.pinnedGitRef(block.Labels[0], source, ref)
+	if err != nil {
+		return fmt.Errorf("failed to pin ref of module %s: %w", block.Labels[0], err)
+	}
+	if pinned != "" && pinned != ref {
+		block.WriteBlock.Body().SetAttributeValue("source", cty.StringVal(replaceGitRef(source, ref, pinned)))
+		f.dir.recordFix(block.Block, RuleModulePinGitRef)
+	}
+	return nil
+}
+
+func (f *HclFile) ruleWarning(b *hclsyntax.Block, rule, reason string) {
+	f.dir.warn(Warning{
+		File:   f.FileName,
+		Line:   b.DefRange().Start.Line,
+		Block:  blockAddress(b),
+		Reason: reason,
+		Rule:   rule,
+	})
+}
+
+// replaceGitRef replaces the `ref` argument in the query of the source, the other arguments are kept as they are.
+func replaceGitRef(source, ref, pinned string) string {
+	address, query, _ := strings.Cut(source, "?")
+	args := strings.Split(query, "&")
+	for i, arg := range args {
+		if arg == "ref="+ref || arg == "ref="+url.QueryEscape(ref) {
+			args[i] = "ref=" + url.QueryEscape(pinned)
+		}
+	}
+	return address + "?" + strings.Join(args, "&")
+}
+
+// pinnedGitRef returns the tag or the commit checked out for the module in `.terraform/modules`. An empty string is returned
+// when ref isn't a branch, or the module hasn't been installed from the same source.
+func (d *directory) pinnedGitRef(moduleName, source, ref string) (string, error) {
+	manifestPath := filepath.Join(d.path, ".terraform", "modules", "modules.json")
+	exists, err := afero.Exists(d.fs, manifestPath)
+	if err != nil || !exists {
+		return "", err
+	}
+	content, err := afero.ReadFile(d.fs, manifestPath)
+	if err != nil {
+		return "", err
+	}
+	var manifest modulesManifest
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", manifestPath, err)
+	}
+	for _, m := range manifest.Modules {
+		if m.Key != moduleName || m.Source != source {
+			continue
+		}
+		repo := &gitRepository{fs: d.fs, dir: filepath.Join(d.path, m.Dir, ".git")}
+		return repo.pinnedRef(ref)
+	}
+	return "", nil
+}
+
+// gitRepository reads refs from a `.git` folder without running git, loose refs take precedence over packed refs.
+type gitRepository struct {
+	fs  afero.Fs
+	dir string
+}
+
+func (r *gitRepository) pinnedRef(ref string) (string, error) {
+	exists, err := afero.DirExists(r.fs, r.dir)
+	if err != nil || !exists {
+		return "", err
+	}
+	head, err := r.readRef("HEAD")
+	if err != nil {
+		return "", err
+	}
+	branch := false
+	if target, ok := strings.CutPrefix(head, "ref: "); ok {
+		branch = target == "refs/heads/"+ref
+		if head, err = r.readRef(target); err != nil {
+			return "", err
+		}
+	}
+	if !branch {
+		for _, name := range []string{"refs/heads/" + ref, "refs/remotes/origin/" + ref} {
+			commit, err := r.readRef(name)
+			if err != nil {
+				return "", err
+			}
+			branch = branch || commit != ""
+		}
+	}
+	if !branch || !gitCommitRegex.MatchString(head) {
+		return "", nil
+	}
+	tag, err := r.tagOf(head)
+	if err != nil || tag != "" {
+		return tag, err
+	}
+	return head, nil
+}
+
+// readRef returns the content of a loose ref, or the commit of a packed ref, an empty string is returned if there is none.
+func (r *gitRepository) readRef(name string) (string, error) {
+	path := filepath.Join(r.dir, filepath.FromSlash(name))
+	exists, err := afero.Exists(r.fs, path)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		content, err := afero.ReadFile(r.fs, path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+	refs, err := r.packedRefs()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range refs {
+		if p.name == name {
+			return p.commit, nil
+		}
+	}
+	return "", nil
+}
+
+// tagOf returns the first tag, in alphabetical order, pointing to the commit. A loose annotated tag is peeled from its tag object,
+// an annotated tag whose object is only stored in a pack file isn't recognised.
+func (r *gitRepository) tagOf(commit string) (string, error) {
+	var tags []string
+	tagsDir := filepath.Join(r.dir, "refs", "tags")
+	exists, err := afero.DirExists(r.fs, tagsDir)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		err = afero.Walk(r.fs, tagsDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			content, err := afero.ReadFile(r.fs, path)
+			if err != nil {
+				return err
+			}
+			target, err := r.peel(strings.TrimSpace(string(content)))
+			if err != nil {
+				return err
+			}
+			if target == commit {
+				rel, err := filepath.Rel(tagsDir, path)
+				if err != nil {
+					return err
+				}
+				tags = append(tags, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	refs, err := r.packedRefs()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range refs {
+		if tag, ok := strings.CutPrefix(p.name, "refs/tags/"); ok && (p.commit == commit || p.peeled == commit) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return "", nil
+	}
+	return slices.Min(tags), nil
+}
+
+// maxTagDepth limits the tags of tags followed by peel.
+const maxTagDepth = 8
+
+// peel returns the object an annotated tag points to, following tags of tags. The hash is returned as is when it isn't a loose
+// tag object, e.g. a commit, or an object stored in a pack file.
+func (r *gitRepository) peel(hash string) (string, error) {
+	for range maxTagDepth {
+		target, err := r.tagTarget(hash)
+		if err != nil || target == "" {
+			return hash, err
+		}
+		hash = target
+	}
+	return hash, nil
+}
+
+// tagTarget reads the `object` header of the loose tag object, an empty string is returned if it's not a loose tag object.
+func (r *gitRepository) tagTarget(hash string) (string, error) {
+	if len(hash) != 40 || !gitCommitRegex.MatchString(hash) {
+		return "", nil
+	}
+	path := filepath.Join(r.dir, "objects", hash[:2], hash[2:])
+	exists, err := afero.Exists(r.fs, path)
+	if err != nil || !exists {
+		return "", err
+	}
+	f, err := r.fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	z, err := zlib.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read git object %s: %w", hash, err)
+	}
+	defer func() {
+		_ = z.Close()
+	}()
+	reader := bufio.NewReader(z)
+	header, err := reader.ReadString(0)
+	if err != nil {
+		return "", fmt.Errorf("failed to read git object %s: %w", hash, err)
+	}
+	if !strings.HasPrefix(header, "tag ") {
+		return "", nil
+	}
+	// The object header is the first line of a tag object.
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read git object %s: %w", hash, err)
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(line), "object ")
+	if !ok {
+		return "", fmt.Errorf("invalid tag object %s", hash)
+	}
+	return target, nil
+}
+
+type packedRef struct {
+	name   string
+	commit string
+	// peeled is the commit an annotated tag points to.
+	peeled string
+}
+
+func (r *gitRepository) packedRefs() ([]packedRef, error) {
+	path := filepath.Join(r.dir, "packed-refs")
+	exists, err := afero.Exists(r.fs, path)
+	if err != nil || !exists {
+		return nil, err
+	}
+	content, err := afero.ReadFile(r.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	var refs []packedRef
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "^"):
+			if len(refs) > 0 {
+				refs[len(refs)-1].peeled = strings.TrimPrefix(line, "^")
+			}
+		default:
+			commit, name, ok := strings.Cut(line, " ")
+			if ok {
+				refs = append(refs, packedRef{name: name, commit: commit})
+			}
+		}
+	}
+	return refs, scanner.Err()
+}
@@ -0,0 +1,306 @@
+package pkg_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1" // #nosec G505 -- git object names are sha1 hashes
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const moduleHygieneConfig = `module "registry_without_version" {
+  source = "Azure/avm-res-network-virtualnetwork/azurerm"
+}
+
+module "registry_with_host" {
+  source = "app.terraform.io/example/network/azurerm//modules/subnet"
+}
+
+module "open_ended" {
+  source  = "Azure/avm-res-network-virtualnetwork/azurerm"
+  version = ">= 0.4.0"
+}
+
+module "major_only" {
+  source  = "Azure/avm-res-network-virtualnetwork/azurerm"
+  version = "~> 1"
+}
+
+module "invalid_version" {
+  source  = "Azure/avm-res-network-virtualnetwork/azurerm"
+  version = "latest"
+}
+
+module "pinned" {
+  source  = "Azure/avm-res-network-virtualnetwork/azurerm"
+  version = "~> 0.4"
+}
+
+module "bounded_range" {
+  source  = "Azure/avm-res-network-virtualnetwork/azurerm"
+  version = ">= 0.4.0, < 0.5.0"
+}
+
+module "git_without_ref" {
+  source = "git::https://github.com/Azure/terraform-azurerm-network.git"
+}
+
+module "git_with_ref" {
+  source = "git::https://github.com/Azure/terraform-azurerm-network.git?ref=v1.0.0"
+}
+
+module "github_shorthand" {
+  source = "github.com/Azure/terraform-azurerm-network"
+}
+
+module "local" {
+  source = "./modules/network"
+}
+`
+
+// childModuleRules are the rules loading the child modules, the modules in these tests aren't installed.
+var childModuleRules = []string{pkg.RuleModuleOrder, pkg.RuleModuleUndeclaredArgument, pkg.RuleModuleRequiredVariable}
+
+func TestRunShouldWarnModuleHygieneViolations(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": moduleHygieneConfig,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{
+		DryRun:        true,
+		DisabledRules: childModuleRules,
+	})
+	require.NoError(t, err)
+	rules := make(map[string][]string)
+	for _, w := range result.Warnings {
+		assert.Equal(t, "/module/main.tf", w.File)
+		rules[w.Block] = append(rules[w.Block], w.Rule)
+	}
+	assert.Equal(t, map[string][]string{
+		"module.registry_without_version": {pkg.RuleModuleRegistryVersion},
+		"module.registry_with_host":       {pkg.RuleModuleRegistryVersion},
+		"module.open_ended":               {pkg.RuleModuleVersionConstraint},
+		"module.major_only":               {pkg.RuleModuleVersionConstraint},
+		"module.invalid_version":          {pkg.RuleModuleVersionConstraint},
+		"module.git_without_ref":          {pkg.RuleModuleGitRef},
+	}, rules)
+	assert.Empty(t, result.Changes)
+}
+
+func TestRunWithDisabledModuleHygieneRulesShouldNotWarn(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": moduleHygieneConfig,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{
+		DryRun:        true,
+		DisabledRules: append([]string{pkg.RuleModuleRegistryVersion, pkg.RuleModuleGitRef, pkg.RuleModuleVersionConstraint}, childModuleRules...),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.Warnings)
+}
+
+const gitModuleSource = "git::https://github.com/Azure/terraform-azurerm-network.git?depth=1&ref=main"
+
+const installedCommit = "3f4c2b1a9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a"
+
+// gitTagObject returns the name and the zlib compressed content of a loose annotated tag object pointing to the commit.
+func gitTagObject(commit, tag string) (string, string) {
+	body := fmt.Sprintf("object %s\ntype commit\ntag %s\ntagger avmfix <avmfix@example.com> 1700000000 +0000\n\nRelease %s\n", commit, tag, tag)
+	object := fmt.Sprintf("tag %d\x00%s", len(body), body)
+	hash := sha1.Sum([]byte(object)) // #nosec G401
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	_, _ = w.Write([]byte(object))
+	_ = w.Close()
+	return hex.EncodeToString(hash[:]), compressed.String()
+}
+
+func TestRunWithPinGitRefShouldPinBranchRefs(t *testing.T) {
+	annotatedTag, annotatedTagObject := gitTagObject(installedCommit, "v1.3.0")
+	cases := []struct {
+		desc           string
+		enabled        bool
+		gitFiles       map[string]string
+		expectedSource string
+	}{
+		{
+			desc:    "tag of the checked out installedCommit",
+			enabled: true,
+			gitFiles: map[string]string{
+				"HEAD":        "ref: refs/heads/main\n",
+				"packed-refs": "# pack-refs with: peeled fully-peeled sorted\n" + installedCommit + " refs/heads/main\n0123456789abcdef0123456789abcdef01234567 refs/tags/v1.2.0\n^" + installedCommit + "\n",
+			},
+			expectedSource: "git::https://github.com/Azure/terraform-azurerm-network.git?depth=1&ref=v1.2.0",
+		},
+		{
+			desc:    "loose tag",
+			enabled: true,
+			gitFiles: map[string]string{
+				"HEAD":                "ref: refs/heads/main\n",
+				"refs/heads/main":     installedCommit + "\n",
+				"refs/tags/v1.1.0":    "0123456789abcdef0123456789abcdef01234567\n",
+				"refs/tags/v1.2.0":    installedCommit + "\n",
+				"refs/tags/release/1": installedCommit + "\n",
+			},
+			expectedSource: "git::https://github.com/Azure/terraform-azurerm-network.git?depth=1&ref=release%2F1",
+		},
+		{
+			desc:    "loose annotated tag",
+			enabled: true,
+			gitFiles: map[string]string{
+				"HEAD":             "ref: refs/heads/main\n",
+				"refs/heads/main":  installedCommit + "\n",
+				"refs/tags/v1.3.0": annotatedTag + "\n",
+				"objects/" + annotatedTag[:2] + "/" + annotatedTag[2:]: annotatedTagObject,
+			},
+			expectedSource: "git::https://github.com/Azure/terraform-azurerm-network.git?depth=1&ref=v1.3.0",
+		},
+		{
+			desc:    "installedCommit without tag",
+			enabled: true,
+			gitFiles: map[string]string{
+				"HEAD":            "ref: refs/heads/main\n",
+				"refs/heads/main": installedCommit + "\n",
+			},
+			expectedSource: "git::https://github.com/Azure/terraform-azurerm-network.git?depth=1&ref=" + installedCommit,
+		},
+		{
+			desc:    "detached head",
+			enabled: true,
+			gitFiles: map[string]string{
+				"HEAD":                     installedCommit + "\n",
+				"refs/remotes/origin/main": installedCommit + "\n",
+			},
+			expectedSource: "git::https://github.com/Azure/terraform-azurerm-network.git?depth=1&ref=" + installedCommit,
+		},
+		{
+			desc: "disabled by default",
+			gitFiles: map[string]string{
+				"HEAD":            "ref: refs/heads/main\n",
+				"refs/heads/main": installedCommit + "\n",
+			},
+			expectedSource: gitModuleSource,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			files := map[string]string{
+				"/module/main.tf": `module "network" {
+  source = "` + gitModuleSource + `"
+}
+`,
+				"/module/.terraform/modules/modules.json": `{"Modules":[{"Key":"","Source":"","Dir":"."},{"Key":"network","Source":"` + gitModuleSource + `","Dir":".terraform/modules/network"}]}`,
+			}
+			for name, content := range c.gitFiles {
+				files["/module/.terraform/modules/network/.git/"+name] = content
+			}
+			mockFs := fakeFs(files)
+			stub := gostub.Stub(&pkg.Fs, mockFs)
+			defer stub.Reset()
+
+			opts := pkg.Options{
+				DisabledRules: childModuleRules,
+			}
+			if c.enabled {
+				opts.EnabledRules = []string{pkg.RuleModulePinGitRef}
+			}
+			result, err := pkg.Run("/module", opts)
+			require.NoError(t, err)
+			content, err := afero.ReadFile(mockFs, "/module/main.tf")
+			require.NoError(t, err)
+			assert.Equal(t, `module "network" {
+  source = "`+c.expectedSource+`"
+}
+`, string(content))
+			if c.expectedSource == gitModuleSource {
+				assert.Empty(t, result.Fixes)
+				return
+			}
+			require.Len(t, result.Fixes, 1)
+			assert.Equal(t, pkg.RuleModulePinGitRef, result.Fixes[0].Rule)
+		})
+	}
+}
+
+func TestRunWithPinGitRefShouldKeepTagsAndStaleModules(t *testing.T) {
+	cases := []struct {
+		desc      string
+		source    string
+		installed string
+	}{
+		{
+			desc:      "ref is a tag",
+			source:    "git::https://github.com/Azure/terraform-azurerm-network.git?ref=v1.2.0",
+			installed: "git::https://github.com/Azure/terraform-azurerm-network.git?ref=v1.2.0",
+		},
+		{
+			desc:      "installed from another source",
+			source:    gitModuleSource,
+			installed: "git::https://github.com/Azure/terraform-azurerm-network.git?ref=dev",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			config := `module "network" {
+  source = "` + c.source + `"
+}
+`
+			mockFs := fakeFs(map[string]string{
+				"/module/main.tf":                                             config,
+				"/module/.terraform/modules/modules.json":                     `{"Modules":[{"Key":"network","Source":"` + c.installed + `","Dir":".terraform/modules/network"}]}`,
+				"/module/.terraform/modules/network/.git/HEAD":                installedCommit + "\n",
+				"/module/.terraform/modules/network/.git/refs/tags/v1.2.0":    installedCommit + "\n",
+				"/module/.terraform/modules/network/.git/refs/heads/dev":      installedCommit + "\n",
+				"/module/.terraform/modules/network/.git/refs/remotes/x/main": installedCommit + "\n",
+			})
+			stub := gostub.Stub(&pkg.Fs, mockFs)
+			defer stub.Reset()
+
+			_, err := pkg.Run("/module", pkg.Options{
+				EnabledRules:  []string{pkg.RuleModulePinGitRef},
+				DisabledRules: childModuleRules,
+			})
+			require.NoError(t, err)
+			content, err := afero.ReadFile(mockFs, "/module/main.tf")
+			require.NoError(t, err)
+			assert.Equal(t, config, string(content))
+		})
+	}
+}
+
+func TestRunWithConfigFileShouldEnableOptionalRule(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": `module "network" {
+  source = "` + gitModuleSource + `"
+}
+`,
+		"/module/.terraform/modules/modules.json":                 `{"Modules":[{"Key":"network","Source":"` + gitModuleSource + `","Dir":".terraform/modules/network"}]}`,
+		"/module/.terraform/modules/network/.git/HEAD":            "ref: refs/heads/main\n",
+		"/module/.terraform/modules/network/.git/refs/heads/main": installedCommit + "\n",
+		"/module/.avmfix.yaml": `rules:
+  module-order: false
+  module-undeclared-argument: false
+  module-required-variable: false
+  module-pin-git-ref: true
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, result.Fixes, 1)
+	assert.Equal(t, pkg.RuleModulePinGitRef, result.Fixes[0].Rule)
+}
@@ -14,6 +14,10 @@ func BuildMovedBlock(block *HclBlock, file *HclFile) *MovedBlock {
 	}
 }
 
+func (b *MovedBlock) rule() string {
+	return RuleMovedOrder
+}
+
 func (b *MovedBlock) AutoFix() error {
 	if !b.isComplete() {
 		return nil
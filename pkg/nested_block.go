@@ -22,8 +22,9 @@ func buildNestedBlock(parent blockWithSchema, index int, nestedBlock *HclBlock)
 		Index:         index,
 	}
 	if pb, ok := parent.(providerBlock); ok {
-		nb.providerNamespace = pb.getProviderNamespace()
+		nb.provider = pb.getProvider()
 		nb.providerVersion = pb.getProviderVersion()
+		nb.schemas = pb.getSchemaGetter()
 	}
 	attributes := nestedBlock.Attributes()
 	blocks := nestedBlock.NestedBlocks()
@@ -45,27 +46,32 @@ var _ blockWithSchema = &NestedBlock{}
 // NestedBlock is a wrapper of the nested Block
 type NestedBlock struct {
 	*resourceBlock
-	providerNamespace string
-	providerVersion   string
-	SortField         string
-	Index             int
+	provider        providerAddress
+	providerVersion string
+	schemas         SchemaGetter
+	SortField       string
+	Index           int
 }
 
-func (b *NestedBlock) getProviderNamespace() string {
-	return b.providerNamespace
+func (b *NestedBlock) getProvider() providerAddress {
+	return b.provider
 }
 
 func (b *NestedBlock) getProviderVersion() string {
 	return b.providerVersion
 }
 
+func (b *NestedBlock) getSchemaGetter() SchemaGetter {
+	return b.schemas
+}
+
 // DefRange gets the definition range of the nested Block
 func (b *NestedBlock) DefRange() hcl.Range {
 	return b.HclBlock.DefRange()
 }
 
 func (b *NestedBlock) schemaBlock() (*tfjson.SchemaBlock, error) {
-	return queryBlockSchema(b.Path, b.providerNamespace, b.providerVersion)
+	return queryProviderBlockSchema(b.schemas, b.Path, b.provider, b.providerVersion)
 }
 
 // NestedBlocks is the collection of nestedBlocks with the same type
@@ -0,0 +1,235 @@
+package pkg
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// objectItem is an item of an object constructor expression like `{ a = 1 }`, tokens include the lead comments.
+type objectItem struct {
+	key    string
+	tokens hclwrite.Tokens
+	// value is the index of the first token of the value in tokens.
+	value int
+}
+
+// objectTokens is an object constructor expression split into its items.
+type objectTokens struct {
+	items     []*objectItem
+	multiline bool
+	// trailing are the comments after the last item.
+	trailing hclwrite.Tokens
+	open     *hclwrite.Token
+	close    *hclwrite.Token
+}
+
+// sortObjectTokens sorts the items of an object constructor expression with a stable sort, then sortValue, if not nil,
+// is called on the value of every item so nested objects can be sorted too.
+// The tokens are returned as they are if they aren't a single object constructor expression.
+func sortObjectTokens(tokens hclwrite.Tokens, less func(a, b string) bool, sortValue func(key string, value hclwrite.Tokens) hclwrite.Tokens) hclwrite.Tokens {
+	object, ok := splitObjectTokens(tokens)
+	if !ok {
+		return tokens
+	}
+	sort.SliceStable(object.items, func(i, j int) bool {
+		return less(object.items[i].key, object.items[j].key)
+	})
+	if sortValue != nil {
+		for _, item := range object.items {
+			item.setValue(sortValue(item.key, item.valueTokens()))
+		}
+	}
+	return object.build()
+}
+
+// mapTupleObjects calls f on every object constructor expression in a tuple constructor expression like `[{ a = 1 }, { b = 2 }]`.
+// The tokens are returned as they are if they aren't a tuple constructor expression.
+func mapTupleObjects(tokens hclwrite.Tokens, f func(object hclwrite.Tokens) hclwrite.Tokens) hclwrite.Tokens {
+	if len(tokens) < 2 || tokens[0].Type != hclsyntax.TokenOBrack || tokens[len(tokens)-1].Type != hclsyntax.TokenCBrack {
+		return tokens
+	}
+	r := hclwrite.Tokens{tokens[0]}
+	depth := 0
+	start := -1
+	for i := 1; i < len(tokens)-1; i++ {
+		t := tokens[i]
+		if start < 0 && depth == 0 && t.Type == hclsyntax.TokenOBrace {
+			start = i
+		}
+		depth += tokenDepth(t)
+		if depth < 0 {
+			return tokens
+		}
+		if start < 0 {
+			r = append(r, t)
+			continue
+		}
+		if depth == 0 {
+			r = append(r, f(tokens[start:i+1])...)
+			start = -1
+		}
+	}
+	if depth != 0 || start >= 0 {
+		return tokens
+	}
+	return append(r, tokens[len(tokens)-1])
+}
+
+func splitObjectTokens(tokens hclwrite.Tokens) (*objectTokens, bool) {
+	if len(tokens) < 2 || tokens[0].Type != hclsyntax.TokenOBrace || tokens[len(tokens)-1].Type != hclsyntax.TokenCBrace {
+		return nil, false
+	}
+	if isForExpression(tokens[1 : len(tokens)-1]) {
+		return nil, false
+	}
+	r := &objectTokens{
+		open:  tokens[0],
+		close: tokens[len(tokens)-1],
+	}
+	var current hclwrite.Tokens
+	flush := func() {
+		r.items = append(r.items, newObjectItem(current))
+		current = nil
+	}
+	depth := 0
+	for _, t := range tokens[1 : len(tokens)-1] {
+		depth += tokenDepth(t)
+		if depth < 0 {
+			// The closing brace doesn't match the opening one, e.g. `{ a = 1 }.a == { b = 2 }`.
+			return nil, false
+		}
+		if depth > 0 || tokenDepth(t) < 0 {
+			current = append(current, t)
+			continue
+		}
+		switch {
+		case t.Type == hclsyntax.TokenNewline || t.Type == hclsyntax.TokenComma:
+			r.multiline = r.multiline || t.Type == hclsyntax.TokenNewline
+			if hasObjectKey(current) {
+				flush()
+			}
+		case t.Type == hclsyntax.TokenComment && bytes.HasSuffix(t.Bytes, []byte("\n")):
+			r.multiline = true
+			current = append(current, t)
+			// A line comment after an item ends the item, a comment on its own line is a lead comment of the next item.
+			if hasObjectKey(current) {
+				flush()
+			}
+		default:
+			current = append(current, t)
+		}
+	}
+	if depth != 0 {
+		return nil, false
+	}
+	if hasObjectKey(current) {
+		flush()
+	} else {
+		r.trailing = current
+	}
+	return r, true
+}
+
+// tokenDepth returns 1 if the token opens a nested structure, -1 if it closes one.
+func tokenDepth(t *hclwrite.Token) int {
+	switch t.Type {
+	case hclsyntax.TokenOBrace, hclsyntax.TokenOBrack, hclsyntax.TokenOParen,
+		hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl, hclsyntax.TokenOHeredoc, hclsyntax.TokenOQuote:
+		return 1
+	case hclsyntax.TokenCBrace, hclsyntax.TokenCBrack, hclsyntax.TokenCParen,
+		hclsyntax.TokenTemplateSeqEnd, hclsyntax.TokenCHeredoc, hclsyntax.TokenCQuote:
+		return -1
+	}
+	return 0
+}
+
+func hasObjectKey(tokens hclwrite.Tokens) bool {
+	for _, t := range tokens {
+		if t.Type != hclsyntax.TokenComment && t.Type != hclsyntax.TokenNewline {
+			return true
+		}
+	}
+	return false
+}
+
+func newObjectItem(tokens hclwrite.Tokens) *objectItem {
+	item := &objectItem{tokens: tokens, value: len(tokens)}
+	first := -1
+	for i, t := range tokens {
+		if t.Type != hclsyntax.TokenComment {
+			first = i
+			break
+		}
+	}
+	switch {
+	case tokens[first].Type == hclsyntax.TokenIdent:
+		item.key = string(tokens[first].Bytes)
+	case tokens[first].Type == hclsyntax.TokenOQuote && first+2 < len(tokens) &&
+		tokens[first+1].Type == hclsyntax.TokenQuotedLit && tokens[first+2].Type == hclsyntax.TokenCQuote:
+		item.key = string(tokens[first+1].Bytes)
+	}
+	depth := 0
+	for i := first; i < len(tokens); i++ {
+		t := tokens[i]
+		depth += tokenDepth(t)
+		if depth == 0 && (t.Type == hclsyntax.TokenEqual || t.Type == hclsyntax.TokenColon) {
+			item.value = i + 1
+			break
+		}
+	}
+	return item
+}
+
+// valueTokens returns the value of the item, the comment after it is excluded.
+func (i *objectItem) valueTokens() hclwrite.Tokens {
+	end := len(i.tokens)
+	for end > i.value && i.tokens[end-1].Type == hclsyntax.TokenComment {
+		end--
+	}
+	return i.tokens[i.value:end]
+}
+
+func (i *objectItem) setValue(value hclwrite.Tokens) {
+	end := i.value + len(i.valueTokens())
+	tokens := append(hclwrite.Tokens{}, i.tokens[:i.value]...)
+	tokens = append(tokens, value...)
+	i.tokens = append(tokens, i.tokens[end:]...)
+}
+
+func (o *objectTokens) build() hclwrite.Tokens {
+	r := hclwrite.Tokens{o.open}
+	if o.multiline {
+		r = append(r, newLineToken())
+	}
+	for i, item := range o.items {
+		if !o.multiline && i > 0 {
+			r = append(r, &hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")})
+		}
+		r = append(r, item.tokens...)
+		last := item.tokens[len(item.tokens)-1]
+		if o.multiline && !(last.Type == hclsyntax.TokenComment && bytes.HasSuffix(last.Bytes, []byte("\n"))) {
+			r = append(r, newLineToken())
+		}
+	}
+	r = append(r, o.trailing...)
+	return append(r, o.close)
+}
+
+func newLineToken() *hclwrite.Token {
+	return &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")}
+}
+
+// isForExpression checks whether the tokens inside the braces are a `for` expression, e.g. `for k, v in var.m : k => v`,
+// which is not a list of keys and values.
+func isForExpression(tokens hclwrite.Tokens) bool {
+	for _, t := range tokens {
+		if t.Type == hclsyntax.TokenNewline || t.Type == hclsyntax.TokenComment {
+			continue
+		}
+		return t.Type == hclsyntax.TokenIdent && string(t.Bytes) == "for"
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sortAttributeValue(t *testing.T, src string) string {
+	f, diags := hclwrite.ParseConfig([]byte(src), "main.tf", hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+	attr := f.Body().GetAttribute("a")
+	tokens := attr.Expr().BuildTokens(nil)
+	f.Body().SetAttributeRaw("a", sortObjectTokens(tokens, func(a, b string) bool {
+		return a < b
+	}, nil))
+	return string(f.Bytes())
+}
+
+func TestSortObjectTokens(t *testing.T) {
+	cases := []struct {
+		desc     string
+		src      string
+		expected string
+	}{
+		{
+			desc: "lead and line comments move with their items",
+			src: `a = {
+  # lead of c
+  c = 3 # line of c
+  "b" = <<EOT
+b
+EOT
+  a = { z = 1, y = 2 }
+}
+`,
+			expected: `a = {
+  a   = { z = 1, y = 2 }
+  "b" = <<EOT
+b
+EOT
+  # lead of c
+  c = 3 # line of c
+}
+`,
+		},
+		{
+			desc:     "single line object",
+			src:      "a = { c = \"${var.c}\", b = [1, 2], a = f(1, 2) }\n",
+			expected: "a = { a = f(1, 2), b = [1, 2], c = \"${var.c}\" }\n",
+		},
+		{
+			desc:     "not an object",
+			src:      "a = merge({ c = 1 }, { b = 2 })\n",
+			expected: "a = merge({ c = 1 }, { b = 2 })\n",
+		},
+		{
+			desc:     "for expression",
+			src:      "a = { for k, v in var.m : k => v }\n",
+			expected: "a = { for k, v in var.m : k => v }\n",
+		},
+		{
+			desc: "multiline for expression",
+			src: `a = {
+  for k, v in var.m :
+  k => { z = v, y = k }
+}
+`,
+			expected: `a = {
+  for k, v in var.m :
+  k => { z = v, y = k }
+}
+`,
+		},
+		{
+			desc:     "objects in expression",
+			src:      "a = { c = 1 }.c == { b = 2 }.b\n",
+			expected: "a = { c = 1 }.c == { b = 2 }.b\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.Equal(t, c.expected, sortAttributeValue(t, c.src))
+		})
+	}
+}
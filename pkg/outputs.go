@@ -1,12 +1,17 @@
 package pkg
 
 import (
+	"slices"
+
 	"github.com/ahmetb/go-linq/v3"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 )
 
 type OutputBlock struct {
+	dir *directory
+	// overriding is true for an output in an override file, its arguments are sorted but never removed.
+	overriding bool
 	Block      *HclBlock
 	Attributes Args
 }
@@ -22,20 +27,43 @@ func BuildOutputBlock(f *hcl.File, b *HclBlock) *OutputBlock {
 }
 
 func (b *OutputBlock) AutoFix() error {
-	b.removeUnnecessarySensitive()
-	b.sortArguments()
+	var applied []string
+	if b.dir.ruleEnabled(RuleOutputSensitive) && !b.overriding && b.removeUnnecessarySensitive() {
+		applied = append(applied, RuleOutputSensitive)
+	}
+	if b.dir.ruleEnabled(RuleOutputOrder) && b.sortArguments() {
+		applied = append(applied, RuleOutputOrder)
+	}
+	// Arguments already in order might still be rewritten in a new layout, e.g. without blank lines between them.
+	if len(applied) == 0 && b.dir.ruleEnabled(RuleOutputOrder) {
+		return b.dir.applyRule(b.Block, RuleOutputOrder, func() error {
+			b.write()
+			return nil
+		})
+	}
 	b.write()
+	for _, rule := range applied {
+		b.dir.recordFix(b.Block.Block, rule)
+	}
 	return nil
 }
 
 func (b *OutputBlock) write() {
 	attributes := b.Block.WriteBlock.Body().Attributes()
+	blocks := b.Block.WriteBlock.Body().Blocks()
 	b.Block.Clear()
 	b.Block.appendNewline()
 	b.Block.writeArgs(b.Attributes, attributes)
+	if len(blocks) > 0 {
+		b.Block.appendNewline()
+	}
+	for _, nb := range blocks {
+		b.Block.appendBlock(nb)
+	}
 }
 
-func (b *OutputBlock) removeUnnecessarySensitive() {
+// removeUnnecessarySensitive returns true if `sensitive = false` has been removed.
+func (b *OutputBlock) removeUnnecessarySensitive() bool {
 	for i := 0; i < len(b.Attributes); i++ {
 		attr := b.Attributes[i]
 		if attr.Name != "sensitive" {
@@ -43,15 +71,19 @@ func (b *OutputBlock) removeUnnecessarySensitive() {
 		}
 		literal, ok := attr.Expr.(*hclsyntax.LiteralValueExpr)
 		if !ok || !literal.Val.False() {
-			return
+			return false
 		}
 		b.Attributes = removeIndex(b.Attributes, i)
-		return
+		return true
 	}
+	return false
 }
 
-func (b *OutputBlock) sortArguments() {
+// sortArguments returns true if the order of the arguments has been changed.
+func (b *OutputBlock) sortArguments() bool {
+	original := b.Attributes
 	b.Attributes = b.Attributes.SortByName()
+	return !slices.Equal(original, b.Attributes)
 }
 
 type OutputsFile struct {
@@ -68,22 +100,54 @@ func BuildOutputsFile(f *HclFile) *OutputsFile {
 
 func (f *OutputsFile) AutoFix() error {
 	var blocks []*OutputBlock
+	// layout keeps the blocks in the order of the file, nil marks the place of an output.
+	var layout []*HclBlock
 	for i := 0; i < len(f.File.WriteFile.Body().Blocks()); i++ {
 		block := f.File.GetBlock(i)
 		if block.Type != "output" {
-			f.dir.AppendBlockToFile("main.tf", block)
+			if f.dir.ruleEnabled(RuleOutputFilePlacement) {
+				f.dir.recordFix(block.Block, RuleOutputFilePlacement)
+				f.dir.AppendBlockToFile("main.tf", block)
+			} else {
+				layout = append(layout, block)
+			}
 			continue
 		}
 		b := BuildOutputBlock(f.File.File, block)
-		if err := b.AutoFix(); err != nil {
+		b.dir = f.dir
+		if err := f.File.autoFixBlock(b, block); err != nil {
 			return err
 		}
 		blocks = append(blocks, b)
+		layout = append(layout, nil)
 	}
 
-	linq.From(blocks).OrderBy(func(i interface{}) interface{} {
-		return i.(*OutputBlock).Block.Labels[0]
-	}).ToSlice(&blocks)
+	if f.dir.ruleEnabled(RuleOutputOrder) {
+		original := slices.Clone(blocks)
+		linq.From(blocks).OrderBy(func(i interface{}) interface{} {
+			return i.(*OutputBlock).Block.Labels[0]
+		}).ToSlice(&blocks)
+		for i, b := range blocks {
+			if b != original[i] {
+				f.dir.recordFix(b.Block.Block, RuleOutputOrder)
+			}
+		}
+	}
+	return f.write(blocks, layout)
+}
+
+// write rewrites the file with the outputs in the places of the outputs in layout, the other blocks kept
+// when output-file-placement is disabled stay where they were.
+func (f *OutputsFile) write(outputBlocks []*OutputBlock, layout []*HclBlock) error {
+	blocks := make([]*HclBlock, 0, len(layout))
+	next := 0
+	for _, block := range layout {
+		if block == nil {
+			block = outputBlocks[next].Block
+			next++
+		}
+		blocks = append(blocks, block)
+	}
 
 	f.File.ClearWriteFile()
 
@@ -91,8 +155,8 @@ func (f *OutputsFile) AutoFix() error {
 		if i != 0 {
 			f.File.appendNewline()
 		}
-		f.File.appendBlock(block.Block)
-		if !endWithNewLine(block.Block.WriteBlock) {
+		f.File.appendBlock(block)
+		if !endWithNewLine(block.WriteBlock) {
 			f.File.appendNewline()
 		}
 	}
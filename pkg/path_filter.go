@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// pathFilter decides which files and folders are processed, paths are slash separated and relative to the target folder.
+//
+// Exclude patterns work like `.gitignore`: they're evaluated in order, the last matching one wins, a pattern starting with `!`
+// re-includes what an earlier pattern excluded, and a pattern without `/` matches the base name at any depth.
+// A file inside an excluded folder is always excluded. If there are include patterns, only files matching any of them are processed.
+type pathFilter struct {
+	excludes []filterPattern
+	includes []filterPattern
+	// excludeBase and includeBase are the target folder relative to the folder of the config file the patterns come from,
+	// empty if the patterns are relative to the target folder.
+	excludeBase string
+	includeBase string
+}
+
+type filterPattern struct {
+	glob   glob.Glob
+	negate bool
+	// baseName is true for patterns without `/`, they're matched against the base name of every path segment.
+	baseName bool
+	// anyDepth is true for patterns starting with `**/`, they match paths at the root too, e.g. `**/test_*.tf` matches `test_a.tf`.
+	anyDepth bool
+}
+
+func newPathFilter(excludes, includes []string) (*pathFilter, error) {
+	f := &pathFilter{}
+	for _, pattern := range excludes {
+		p, err := compileFilterPattern(pattern, true)
+		if err != nil {
+			return nil, err
+		}
+		f.excludes = append(f.excludes, p)
+	}
+	for _, pattern := range includes {
+		p, err := compileFilterPattern(pattern, false)
+		if err != nil {
+			return nil, err
+		}
+		f.includes = append(f.includes, p)
+	}
+	return f, nil
+}
+
+func compileFilterPattern(pattern string, allowNegation bool) (filterPattern, error) {
+	p := filterPattern{}
+	expr := pattern
+	if allowNegation && strings.HasPrefix(expr, "!") {
+		p.negate = true
+		expr = expr[1:]
+	}
+	expr = strings.TrimSuffix(expr, "/")
+	if strings.HasPrefix(expr, "/") {
+		expr = expr[1:]
+	} else {
+		p.baseName = !strings.Contains(expr, "/")
+	}
+	if expr == "" {
+		return p, fmt.Errorf("invalid glob pattern %q: empty pattern", pattern)
+	}
+	p.anyDepth = strings.HasPrefix(expr, "**/")
+	g, err := glob.Compile(expr, '/')
+	if err != nil {
+		return p, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	p.glob = g
+	return p, nil
+}
+
+func (p filterPattern) match(rel string) bool {
+	if p.baseName {
+		return p.glob.Match(path.Base(rel))
+	}
+	// `**` matches the empty string, so a path at the root matches `**/` once it's prefixed with `/`.
+	return p.glob.Match(rel) || p.anyDepth && p.glob.Match("/"+rel)
+}
+
+// excluded checks whether the path, or any folder containing it, is excluded.
+func (f *pathFilter) excluded(rel string) bool {
+	if f == nil || len(f.excludes) == 0 {
+		return false
+	}
+	for _, p := range parentPaths(path.Join(f.excludeBase, rel)) {
+		if f.excludedItself(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *pathFilter) excludedItself(rel string) bool {
+	excluded := false
+	for _, p := range f.excludes {
+		if p.match(rel) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// included checks whether the file, or any folder containing it, matches an include pattern, all files are included if there is none.
+func (f *pathFilter) included(rel string) bool {
+	if f == nil || len(f.includes) == 0 {
+		return true
+	}
+	for _, p := range parentPaths(path.Join(f.includeBase, rel)) {
+		for _, include := range f.includes {
+			if include.match(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipFile checks whether the file should be left untouched.
+func (f *pathFilter) skipFile(rel string) bool {
+	return f.excluded(rel) || !f.included(rel)
+}
+
+// parentPaths returns the path and all its parent folders, outermost first, e.g. `a`, `a/b`, `a/b/c.tf`.
+func parentPaths(rel string) []string {
+	segments := strings.Split(rel, "/")
+	r := make([]string, 0, len(segments))
+	for i := range segments {
+		r = append(r, strings.Join(segments[:i+1], "/"))
+	}
+	return r
+}
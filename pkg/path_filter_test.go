@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathFilter(t *testing.T) {
+	cases := []struct {
+		desc     string
+		excludes []string
+		includes []string
+		skipped  []string
+		kept     []string
+	}{
+		{
+			desc:     "base name pattern matches at any depth",
+			excludes: []string{"legacy_*.tf"},
+			skipped:  []string{"legacy_a.tf", "modules/a/legacy_b.tf"},
+			kept:     []string{"main.tf", "modules/a/main.tf"},
+		},
+		{
+			desc:     "pattern with slash matches relative path",
+			excludes: []string{"generated/**"},
+			skipped:  []string{"generated/a.tf", "generated/sub/b.tf"},
+			kept:     []string{"main.tf", "modules/generated/a.tf"},
+		},
+		{
+			desc:     "leading double star matches at the root too",
+			excludes: []string{"**/test_*.tf"},
+			skipped:  []string{"test_a.tf", "modules/a/test_b.tf"},
+			kept:     []string{"main.tf", "modules/a/main.tf"},
+		},
+		{
+			desc:     "leading double star includes at the root too",
+			includes: []string{"**/main.tf"},
+			skipped:  []string{"variables.tf", "modules/a/variables.tf"},
+			kept:     []string{"main.tf", "modules/a/main.tf"},
+		},
+		{
+			desc:     "star doesn't cross folders",
+			excludes: []string{"modules/*.tf"},
+			skipped:  []string{"modules/a.tf"},
+			kept:     []string{"modules/a/main.tf"},
+		},
+		{
+			desc:     "excluded folder excludes its files",
+			excludes: []string{"examples/legacy"},
+			skipped:  []string{"examples/legacy", "examples/legacy/main.tf"},
+			kept:     []string{"examples/basic/main.tf"},
+		},
+		{
+			desc:     "negation re-includes",
+			excludes: []string{"legacy_*.tf", "!legacy_keep.tf"},
+			skipped:  []string{"legacy_a.tf"},
+			kept:     []string{"legacy_keep.tf", "modules/legacy_keep.tf"},
+		},
+		{
+			desc:     "later pattern wins",
+			excludes: []string{"!legacy_keep.tf", "legacy_*.tf"},
+			skipped:  []string{"legacy_a.tf", "legacy_keep.tf"},
+		},
+		{
+			desc:     "include limits processed files",
+			includes: []string{"generated/**", "main.tf"},
+			skipped:  []string{"variables.tf", "modules/a/variables.tf"},
+			kept:     []string{"main.tf", "modules/a/main.tf", "generated/a.tf"},
+		},
+		{
+			desc:     "exclude wins over include",
+			excludes: []string{"generated/skip.tf"},
+			includes: []string{"generated/**"},
+			skipped:  []string{"generated/skip.tf"},
+			kept:     []string{"generated/a.tf"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			f, err := newPathFilter(c.excludes, c.includes)
+			require.NoError(t, err)
+			for _, p := range c.skipped {
+				assert.True(t, f.skipFile(p), p)
+			}
+			for _, p := range c.kept {
+				assert.False(t, f.skipFile(p), p)
+			}
+		})
+	}
+}
+
+func TestPathFilter_InvalidPatternShouldReturnError(t *testing.T) {
+	_, err := newPathFilter([]string{"[a-"}, nil)
+	assert.ErrorContains(t, err, `invalid glob pattern "[a-"`)
+	_, err = newPathFilter(nil, []string{"[]"})
+	assert.ErrorContains(t, err, `invalid glob pattern "[]"`)
+	_, err = newPathFilter([]string{"!"}, nil)
+	assert.ErrorContains(t, err, "empty pattern")
+}
+
+func TestPathFilter_NilFilterKeepsEverything(t *testing.T) {
+	var f *pathFilter
+	assert.False(t, f.skipFile("main.tf"))
+	assert.False(t, f.excluded("modules/a"))
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// newPluginClient launches the provider binary, it's a variable so tests could replace the plugin process.
+var newPluginClient = newGrpcClient
+
+// plugin returns the running plugin process of the provider, it's launched on first use and kept alive until Cleanup.
+// Plugins are keyed by the provider binary, so the modules whose lock files match the same binary share one process.
+// A plugin whose process has exited is launched again.
+func (s *Server) plugin(request Request) (universalProvider, error) {
+	if err := s.Get(request); err != nil {
+		return nil, fmt.Errorf("failed to download provider: %w", err)
+	}
+	providerPath, exists := s.providerPath(request)
+	if !exists {
+		return nil, fmt.Errorf("provider not found in cache: %s", request.String())
+	}
+	if p, ok := s.runningPlugin(providerPath); ok {
+		return p, nil
+	}
+	v, err, _ := s.state.launches.Do(providerPath, func() (any, error) {
+		if p, ok := s.runningPlugin(providerPath); ok {
+			return p, nil
+		}
+		s.l.Info("Launching provider plugin", "path", providerPath)
+		p, err := newPluginClient(providerPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+		}
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		if s.state.plugins == nil {
+			s.state.plugins = make(map[string]universalProvider)
+		}
+		s.state.plugins[providerPath] = p
+		return p, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(universalProvider), nil
+}
+
+func (s *Server) runningPlugin(providerPath string) (universalProvider, bool) {
+	s.state.mu.RLock()
+	p, ok := s.state.plugins[providerPath]
+	s.state.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if !p.exited() {
+		return p, true
+	}
+	s.l.Warn("Provider plugin has exited, it will be launched again", "path", providerPath)
+	s.closePlugin(providerPath)
+	return nil, false
+}
+
+// closePlugin stops the plugin process of the provider binary, if there is one.
+func (s *Server) closePlugin(providerPath string) {
+	s.state.mu.Lock()
+	p, ok := s.state.plugins[providerPath]
+	delete(s.state.plugins, providerPath)
+	s.state.mu.Unlock()
+	if ok {
+		p.close()
+	}
+}
+
+// closeAllPlugins stops all plugin processes in a stable order, it's called by Cleanup with s.state.mu held.
+func (s *Server) closeAllPlugins() {
+	plugins := s.state.plugins
+	for _, providerPath := range slices.Sorted(maps.Keys(plugins)) {
+		s.l.Info("Stopping provider plugin", "path", providerPath)
+		plugins[providerPath].close()
+		delete(plugins, providerPath)
+	}
+}
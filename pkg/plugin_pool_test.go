@@ -0,0 +1,185 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/matt-FFFFFF/tfpluginschema/tfplugin5"
+	"github.com/matt-FFFFFF/tfpluginschema/tfplugin6"
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePlugin struct {
+	v6Err       error
+	schema      *tfplugin6.GetProviderSchema_Response
+	identities  *tfplugin6.GetResourceIdentitySchemas_Response
+	identityErr error
+	isExited    atomic.Bool
+	closed      atomic.Bool
+}
+
+func (p *fakePlugin) v5Schema() (*tfplugin5.GetProviderSchema_Response, error) {
+	return nil, errors.New("v5 protocol not supported by this provider")
+}
+
+func (p *fakePlugin) v6Schema() (*tfplugin6.GetProviderSchema_Response, error) {
+	if p.v6Err != nil {
+		return nil, p.v6Err
+	}
+	if p.schema != nil {
+		return p.schema, nil
+	}
+	return &tfplugin6.GetProviderSchema_Response{}, nil
+}
+
+func (p *fakePlugin) v5IdentitySchemas() (*tfplugin5.GetResourceIdentitySchemas_Response, error) {
+	return nil, errors.New("v5 protocol not supported by this provider")
+}
+
+func (p *fakePlugin) v6IdentitySchemas() (*tfplugin6.GetResourceIdentitySchemas_Response, error) {
+	return p.identities, p.identityErr
+}
+
+func (p *fakePlugin) exited() bool {
+	return p.isExited.Load()
+}
+
+func (p *fakePlugin) close() {
+	p.closed.Store(true)
+}
+
+// fakePluginLauncher replaces the plugin processes with fakePlugins, and records every launch.
+type fakePluginLauncher struct {
+	mu          sync.Mutex
+	launched    []*fakePlugin
+	v6Err       error
+	schema      *tfplugin6.GetProviderSchema_Response
+	identities  *tfplugin6.GetResourceIdentitySchemas_Response
+	identityErr error
+}
+
+func (l *fakePluginLauncher) launch(string) (universalProvider, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p := &fakePlugin{v6Err: l.v6Err, schema: l.schema, identities: l.identities, identityErr: l.identityErr}
+	l.launched = append(l.launched, p)
+	return p, nil
+}
+
+func (l *fakePluginLauncher) launches() []*fakePlugin {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*fakePlugin(nil), l.launched...)
+}
+
+func newLocalProviderServer(t *testing.T, requests ...Request) *Server {
+	providersDir := t.TempDir()
+	for _, r := range requests {
+		binaryDir := filepath.Join(providersDir, "registry.terraform.io", r.Namespace, r.Name, r.Version, testPlatform)
+		require.NoError(t, os.MkdirAll(binaryDir, 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(binaryDir, "terraform-provider-"+r.Name+"_v"+r.Version), []byte("binary"), 0600))
+	}
+	s := NewServer(nil)
+	s.SetOffline(true)
+	s.AddProviderDir(providersDir)
+	return s
+}
+
+func TestServerPlugin_ShouldLaunchEachProviderOnce(t *testing.T) {
+	launcher := &fakePluginLauncher{}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	azurerm := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	random := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	s := newLocalProviderServer(t, azurerm, random)
+	defer s.Cleanup()
+
+	var wg sync.WaitGroup
+	for range 16 {
+		for _, r := range []Request{azurerm, random} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.plugin(r)
+				assert.NoError(t, err)
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Len(t, launcher.launches(), 2)
+
+	// The schema is read again from the running plugin once the in-memory schema is gone.
+	_, err := s.GetProviderSchema(azurerm)
+	require.NoError(t, err)
+	s.state.mu.Lock()
+	s.state.sc = make(schemaCache)
+	s.state.mu.Unlock()
+	_, err = s.GetProviderSchema(azurerm)
+	require.NoError(t, err)
+	assert.Len(t, launcher.launches(), 2)
+}
+
+func TestServerCleanup_ShouldStopAllPlugins(t *testing.T) {
+	launcher := &fakePluginLauncher{}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	azurerm := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	random := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	s := newLocalProviderServer(t, azurerm, random)
+
+	for _, r := range []Request{azurerm, random} {
+		_, err := s.plugin(r)
+		require.NoError(t, err)
+	}
+	s.Cleanup()
+	for _, p := range launcher.launches() {
+		assert.True(t, p.closed.Load())
+	}
+	assert.Empty(t, s.state.plugins)
+
+	// The Server is still usable, the plugin is launched again.
+	_, err := s.plugin(azurerm)
+	require.NoError(t, err)
+	assert.Len(t, launcher.launches(), 3)
+	s.Cleanup()
+}
+
+func TestServerPlugin_ExitedPluginShouldBeLaunchedAgain(t *testing.T) {
+	launcher := &fakePluginLauncher{}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	s := newLocalProviderServer(t, request)
+	defer s.Cleanup()
+
+	first, err := s.plugin(request)
+	require.NoError(t, err)
+	first.(*fakePlugin).isExited.Store(true)
+	second, err := s.plugin(request)
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+	assert.True(t, first.(*fakePlugin).closed.Load())
+	assert.Len(t, launcher.launches(), 2)
+}
+
+func TestServerLoadSchema_BrokenPluginShouldBeStopped(t *testing.T) {
+	launcher := &fakePluginLauncher{v6Err: errors.New("broken")}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	s := newLocalProviderServer(t, request)
+	defer s.Cleanup()
+
+	_, err := s.GetProviderSchema(request)
+	require.Error(t, err)
+	launched := launcher.launches()
+	require.Len(t, launched, 1)
+	assert.True(t, launched[0].closed.Load())
+	assert.Empty(t, s.state.plugins)
+}
@@ -0,0 +1,233 @@
+package pkg
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const defaultProviderHostname = "registry.terraform.io"
+
+// providerAddress is the fully qualified source address of a provider, e.g. `registry.terraform.io/hashicorp/azurerm`.
+type providerAddress struct {
+	Hostname  string
+	Namespace string
+	Type      string
+}
+
+func (a providerAddress) String() string {
+	return fmt.Sprintf("%s/%s/%s", a.Hostname, a.Namespace, a.Type)
+}
+
+// parseProviderSource parses the `source` argument in `required_providers`,
+// the hostname defaults to `registry.terraform.io` and the namespace defaults to `hashicorp`, just like Terraform does.
+func parseProviderSource(source string) (providerAddress, error) {
+	parts := strings.Split(source, "/")
+	for _, part := range parts {
+		if part == "" {
+			return providerAddress{}, fmt.Errorf("invalid provider source %q", source)
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return providerAddress{Hostname: defaultProviderHostname, Namespace: "hashicorp", Type: parts[0]}, nil
+	case 2:
+		return providerAddress{Hostname: defaultProviderHostname, Namespace: parts[0], Type: parts[1]}, nil
+	case 3:
+		return providerAddress{Hostname: parts[0], Namespace: parts[1], Type: parts[2]}, nil
+	}
+	return providerAddress{}, fmt.Errorf("invalid provider source %q", source)
+}
+
+// loadRequiredProviders reads `terraform { required_providers { ... } }` in all files and maps the local names to the source addresses.
+func (d *directory) loadRequiredProviders() error {
+	bodies, err := d.configBodies()
+	if err != nil {
+		return err
+	}
+	d.requiredProviders = make(map[string]providerAddress)
+	for _, body := range bodies {
+		for _, tb := range body.Blocks {
+			if tb.Type != "terraform" {
+				continue
+			}
+			for _, rp := range tb.Body.Blocks {
+				if rp.Type != "required_providers" {
+					continue
+				}
+				for localName, attr := range rp.Body.Attributes {
+					addr, err := requiredProviderAddress(localName, attr)
+					if err != nil {
+						return fmt.Errorf("%s: %w", attr.SrcRange, err)
+					}
+					d.requiredProviders[localName] = addr
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// requiredProviderAddress reads the `source` of a `required_providers` entry.
+// A legacy entry containing a version constraint only, or an entry without `source`, refers to `hashicorp/<local name>`.
+func requiredProviderAddress(localName string, attr *hclsyntax.Attribute) (providerAddress, error) {
+	source := localName
+	// Don't evaluate the whole object, `configuration_aliases` contains references that cannot be evaluated without context.
+	if obj, ok := attr.Expr.(*hclsyntax.ObjectConsExpr); ok {
+		for _, item := range obj.Items {
+			if objectKey(item.KeyExpr) != "source" {
+				continue
+			}
+			v, diags := item.ValueExpr.Value(nil)
+			if diags.HasErrors() || !v.IsKnown() || v.IsNull() || !v.Type().Equals(cty.String) {
+				return providerAddress{}, fmt.Errorf("`source` of provider %s must be a literal string", localName)
+			}
+			source = v.AsString()
+		}
+	}
+	return parseProviderSource(source)
+}
+
+// objectKey returns the key of an object item, both `key` and `"key"` are supported.
+func objectKey(expr hclsyntax.Expression) string {
+	if keyword := hcl.ExprAsKeyword(expr); keyword != "" {
+		return keyword
+	}
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() || !v.IsKnown() || v.IsNull() || !v.Type().Equals(cty.String) {
+		return ""
+	}
+	return v.AsString()
+}
+
+// providerLocalName returns the local name of the provider serving the block,
+// it's read from the `provider` meta-argument when present, e.g. `azurerm` in `provider = azurerm.west`,
+// otherwise it's the prefix of the resource type, just like Terraform does.
+func providerLocalName(block *HclBlock) string {
+	if attr, ok := block.Body.Attributes["provider"]; ok {
+		if traversal, diags := hcl.AbsTraversalForExpr(attr.Expr); !diags.HasErrors() {
+			return traversal.RootName()
+		}
+	}
+	return providerName(blockResourceType(block))
+}
+
+// blockResourceType returns the first label of the block, or the type of the resource imported into for an `import` block.
+func blockResourceType(block *HclBlock) string {
+	if block.Type == "import" {
+		return importResourceType(block)
+	}
+	return block.Labels[0]
+}
+
+// resolveProvider returns the source address of the provider serving the block.
+// The local name is looked up in `required_providers` first, then the providers recorded in `.terraform.lock.hcl`.
+func (d *directory) resolveProvider(block *HclBlock) (providerAddress, error) {
+	localName := providerLocalName(block)
+	if addr, ok := d.requiredProviders[localName]; ok {
+		return addr, nil
+	}
+	var namespaces []string
+	for namespace, providers := range d.providerVersions {
+		if _, ok := providers[localName]; ok {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	if len(namespaces) == 0 {
+		return providerAddress{}, fmt.Errorf("provider %s for %s %s not found", localName, block.Type, blockResourceType(block))
+	}
+	sort.Strings(namespaces)
+	namespace := namespaces[0]
+	// An undeclared provider is implied to be `hashicorp/<local name>`.
+	for _, n := range namespaces {
+		if n == "hashicorp" {
+			namespace = n
+		}
+	}
+	return providerAddress{Hostname: defaultProviderHostname, Namespace: namespace, Type: localName}, nil
+}
+
+// resolveProviderVersion returns the version of the provider locked in `.terraform.lock.hcl`.
+func (d *directory) resolveProviderVersion(addr providerAddress) (string, error) {
+	for namespace, providers := range d.providerVersions {
+		if !strings.EqualFold(namespace, addr.Namespace) {
+			continue
+		}
+		if version, ok := providers[addr.Type]; ok {
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("version for provider %s not found in .terraform.lock.hcl", addr)
+}
+
+// schemaPrefetcher is implemented by schema getters that could fetch provider schemas in parallel, e.g. Server.
+type schemaPrefetcher interface {
+	Prefetch(requests ...Request) error
+}
+
+// prefetchProviders fetches the schemas of all providers the folder needs in parallel before the blocks are fixed one by one.
+// Errors are ignored here, they're reported by the fixing pass along with the blocks they belong to.
+func (d *directory) prefetchProviders() {
+	p, ok := d.schemaGetter().(schemaPrefetcher)
+	if !ok {
+		return
+	}
+	requests, err := d.providerRequests()
+	if err != nil || len(requests) == 0 {
+		return
+	}
+	_ = p.Prefetch(requests...)
+}
+
+// providerRequests returns the providers serving the resource, data and ephemeral blocks in the folder,
+// blocks whose provider or version cannot be resolved are skipped.
+func (d *directory) providerRequests() ([]Request, error) {
+	if err := d.loadTfFiles(); err != nil {
+		return nil, err
+	}
+	seen := make(map[Request]bool)
+	var requests []Request
+	for _, name := range slices.Sorted(maps.Keys(d.tfFiles)) {
+		f := d.tfFiles[name]
+		var blocks []*HclBlock
+		if f.json != nil {
+			for _, b := range jsonSyntaxBlocks(f.json) {
+				blocks = append(blocks, NewHclBlock(b, nil))
+			}
+		} else {
+			for i := range f.Body.(*hclsyntax.Body).Blocks {
+				blocks = append(blocks, f.GetBlock(i))
+			}
+		}
+		for _, b := range blocks {
+			if !slices.Contains([]string{"resource", "data", "ephemeral"}, b.Type) || len(b.Labels) != 2 || b.Labels[0] == "terraform_data" {
+				continue
+			}
+			provider, err := resolveProvider(b, f)
+			if err != nil {
+				continue
+			}
+			version, err := resolveProviderVersion(provider, f)
+			if err != nil || version == "" {
+				continue
+			}
+			request := Request{
+				Namespace: nameSpaceOrDefault(provider.Namespace, provider.Type),
+				Name:      provider.Type,
+				Version:   strings.TrimPrefix(version, "v"),
+				Hostname:  provider.Hostname,
+			}
+			if !seen[request] {
+				seen[request] = true
+				requests = append(requests, request)
+			}
+		}
+	}
+	return requests, nil
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// getLocal looks for the requested provider in the local provider directory.
+// An unpacked binary is used in place, a packed zip archive is extracted into the temporary directory first.
+func (s *Server) getLocal(dir string, request Request) (bool, error) {
+	typeDirs, err := providerTypeDirs(dir, request)
+	if err != nil {
+		return false, err
+	}
+	for _, typeDir := range typeDirs {
+		platform := fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH)
+		unpacked := filepath.Join(typeDir, request.Version, platform)
+		providerPath, err := findProviderBinary(unpacked, request.Name)
+		if err != nil {
+			return false, err
+		}
+		if providerPath != "" {
+			if err := s.verifyUnpacked(request, unpacked); err != nil {
+				return false, err
+			}
+			s.l.Info("Found local provider binary", "path", providerPath)
+			s.setProviderPath(request, providerPath)
+			return true, nil
+		}
+		packed := filepath.Join(typeDir, fmt.Sprintf("%s%s_%s_%s.zip", providerFileNamePrefix, request.Name, request.Version, platform))
+		if _, err := os.Stat(packed); err != nil {
+			continue
+		}
+		if err := s.verifyArchive(request, packed, ""); err != nil {
+			return false, err
+		}
+		s.l.Info("Found local provider archive", "path", packed)
+		tmpDir, err := s.ensureTmpDir()
+		if err != nil {
+			return false, err
+		}
+		return true, s.extract(request, tmpDir, packed)
+	}
+	return false, nil
+}
+
+// providerTypeDirs returns every {dir}/{hostname}/{namespace}/{name} folder matching the request.
+// Namespaces are compared case-insensitively since Terraform stores them in lower case while registries don't.
+func providerTypeDirs(dir string, request Request) ([]string, error) {
+	hosts, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider directory %s: %w", dir, err)
+	}
+	var r []string
+	for _, host := range hosts {
+		if !host.IsDir() {
+			continue
+		}
+		namespaces, err := os.ReadDir(filepath.Join(dir, host.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read provider directory %s: %w", dir, err)
+		}
+		for _, ns := range namespaces {
+			if !ns.IsDir() || !strings.EqualFold(ns.Name(), request.Namespace) {
+				continue
+			}
+			typeDir := filepath.Join(dir, host.Name(), ns.Name(), request.Name)
+			if info, err := os.Stat(typeDir); err == nil && info.IsDir() {
+				r = append(r, typeDir)
+			}
+		}
+	}
+	return r, nil
+}
+
+// findProviderBinary returns the path of the `terraform-provider-{name}` file directly under dir, or an empty string if there is none.
+func findProviderBinary(dir, name string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading directory (%s): %w", dir, err)
+	}
+	wantProviderFileName := fmt.Sprintf("%s%s", providerFileNamePrefix, name)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), wantProviderFileName) {
+			continue
+		}
+		return filepath.Join(dir, entry.Name()), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,232 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/afero"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+const (
+	// zipHashPrefix is the scheme of the SHA-256 of a provider zip archive, as reported by the registry.
+	zipHashPrefix = "zh:"
+	// h1HashPrefix is the scheme of the hash of the files in a provider package, the same for the zip and the unpacked folder.
+	h1HashPrefix = "h1:"
+)
+
+// AddProviderHashes adds the hashes recorded in `.terraform.lock.hcl` for the provider, e.g. "h1:..." and "zh:...".
+// Once a provider has hashes, its archives and unpacked folders must match one of them or the plugin is never launched.
+// A provider located before its hashes changed is located and verified again.
+func (s *Server) AddProviderHashes(request Request, hashes ...string) {
+	key := hashKey(request)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hashes == nil {
+		s.hashes = make(map[Request][]string)
+	}
+	for _, hash := range hashes {
+		if !slices.Contains(s.hashes[key], hash) {
+			s.hashes[key] = append(s.hashes[key], hash)
+		}
+	}
+}
+
+// setLockedHashes replaces all provider hashes with the ones of a lock file, so the providers of a module are verified against
+// its own lock file only.
+func (s *Server) setLockedHashes(locked map[Request][]string) {
+	hashes := make(map[Request][]string)
+	for request, h := range locked {
+		key := hashKey(request)
+		for _, hash := range h {
+			if !slices.Contains(hashes[key], hash) {
+				hashes[key] = append(hashes[key], hash)
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes = hashes
+}
+
+// providerKey identifies a provider version verified against a set of locked hashes. The binaries and schemas found for a
+// provider are kept per hash set, so every module is verified against its own lock file while the modules sharing the same
+// hashes share the binary, the schema and the plugin.
+type providerKey struct {
+	Request
+	hashes string
+}
+
+func (s *Server) providerKey(request Request) providerKey {
+	hashes := s.providerHashes(request)
+	slices.Sort(hashes)
+	return providerKey{Request: request, hashes: strings.Join(hashes, ",")}
+}
+
+// key identifies the provider in the singleflight groups.
+func (k providerKey) key() string {
+	return k.Request.key() + " " + k.hashes
+}
+
+// SetAllowUnlockedProviders allows downloading providers without hashes in `.terraform.lock.hcl` from the registry.
+// Such a download is only checked against the shasum reported by the registry itself, so it's refused by default.
+func (s *Server) SetAllowUnlockedProviders(allow bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowUnlocked = allow
+}
+
+func (s *Server) allowUnlockedProviders() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.allowUnlocked
+}
+
+func (s *Server) providerHashes(request Request) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.hashes[hashKey(request)])
+}
+
+// hashKey ignores the case of the namespace, Terraform stores it in lower case while registries don't.
+func hashKey(request Request) Request {
+	request.Namespace = strings.ToLower(request.Namespace)
+	// Terraform and OpenTofu record the same provider under different registries, the hashes are matched regardless of the hostname.
+	request.Hostname = ""
+	return request
+}
+
+// verifyArchive checks the provider zip archive against the shasum reported by the registry, if any,
+// and against the hashes locked for the provider, if any.
+func (s *Server) verifyArchive(request Request, archive, shasum string) error {
+	zh, err := fileSha256(archive)
+	if err != nil {
+		return err
+	}
+	if shasum != "" && !strings.EqualFold(zh, shasum) {
+		return fmt.Errorf("%w: %s has sha256 %s while the registry reports %s", ErrChecksumMismatch, filepath.Base(archive), zh, shasum)
+	}
+	locked := s.providerHashes(request)
+	if len(locked) == 0 {
+		return nil
+	}
+	if slices.Contains(locked, zipHashPrefix+zh) {
+		return nil
+	}
+	h1, err := dirhash.HashZip(archive, dirhash.Hash1)
+	if err != nil {
+		return fmt.Errorf("failed to hash provider archive %s: %w", archive, err)
+	}
+	if slices.Contains(locked, h1) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s matches none of the hashes of %s/%s %s in .terraform.lock.hcl", ErrChecksumMismatch, filepath.Base(archive), request.Namespace, request.Name, request.Version)
+}
+
+// verifyUnpacked checks the unpacked provider folder against the `h1:` hashes locked for the provider.
+// Only `h1:` hashes apply to folders, a folder is accepted with a warning if the lock file has none of them.
+func (s *Server) verifyUnpacked(request Request, dir string) error {
+	all := s.providerHashes(request)
+	var locked []string
+	for _, hash := range all {
+		if strings.HasPrefix(hash, h1HashPrefix) {
+			locked = append(locked, hash)
+		}
+	}
+	if len(locked) == 0 {
+		if len(all) > 0 {
+			s.l.Warn("No h1 hash locked to verify the unpacked provider", "request", request, "dir", dir)
+		}
+		return nil
+	}
+	h1, err := dirhash.HashDir(dir, "", dirhash.Hash1)
+	if err != nil {
+		return fmt.Errorf("failed to hash provider folder %s: %w", dir, err)
+	}
+	if slices.Contains(locked, h1) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s matches none of the hashes of %s/%s %s in .terraform.lock.hcl", ErrChecksumMismatch, dir, request.Namespace, request.Name, request.Version)
+}
+
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to open provider archive: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash provider archive: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseLockFileHashes returns the `hashes` of every provider version in the lock file, nothing if the lock file doesn't exist.
+func parseLockFileHashes(lockFilePath string) (map[Request][]string, error) {
+	content, err := afero.ReadFile(Fs, lockFilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(content, lockFilePath, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	r := make(map[Request][]string)
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "provider" || len(block.Labels) == 0 {
+			continue
+		}
+		parts := strings.Split(block.Labels[0], "/")
+		versionAttr, hasVersion := block.Body.Attributes["version"]
+		hashesAttr, hasHashes := block.Body.Attributes["hashes"]
+		if len(parts) < 3 || !hasVersion || !hasHashes {
+			continue
+		}
+		version, diags := versionAttr.Expr.Value(nil)
+		if diags.HasErrors() || version.Type() != cty.String || version.IsNull() {
+			continue
+		}
+		hashes, diags := hashesAttr.Expr.Value(nil)
+		if diags.HasErrors() || !hashes.CanIterateElements() {
+			return nil, fmt.Errorf("invalid hashes of provider %s", block.Labels[0])
+		}
+		request := Request{Namespace: parts[len(parts)-2], Name: parts[len(parts)-1], Version: version.AsString()}
+		for it := hashes.ElementIterator(); it.Next(); {
+			_, hash := it.Element()
+			if hash.Type() != cty.String || hash.IsNull() {
+				return nil, fmt.Errorf("invalid hashes of provider %s", block.Labels[0])
+			}
+			r[request] = append(r[request], hash.AsString())
+		}
+	}
+	return r, nil
+}
+
+// addProviderHashes lets the plugin server verify the provider binaries against the hashes in `.terraform.lock.hcl`.
+func (d *directory) addProviderHashes() error {
+	s, ok := d.schemaGetter().(*Server)
+	if !ok {
+		return nil
+	}
+	hashes, err := parseLockFileHashes(filepath.Join(d.path, ".terraform.lock.hcl"))
+	if err != nil {
+		return err
+	}
+	s.setLockedHashes(hashes)
+	return nil
+}
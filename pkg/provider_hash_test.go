@@ -0,0 +1,266 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+const mismatchedHash = "zh:0000000000000000000000000000000000000000000000000000000000000000"
+
+func TestServerGet_RegistryShasumMismatchShouldBeRefused(t *testing.T) {
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	cases := []struct {
+		desc   string
+		shasum string
+	}{
+		{
+			desc:   "mismatch",
+			shasum: "0000000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			desc: "missing",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			registry := newStandInRegistry(t, request)
+			registry.setShasum(providerZipName(request), c.shasum)
+			s := NewServer(nil)
+			defer s.Cleanup()
+			s.SetRegistryURL(registry.URL + "/v1/providers")
+			s.SetAllowUnlockedProviders(true)
+
+			err := s.Get(request)
+			require.ErrorIs(t, err, ErrChecksumMismatch)
+			_, ok := s.providerPath(request)
+			assert.False(t, ok)
+			if s.state.tmpDir != "" {
+				_, err = os.Stat(filepath.Join(s.state.tmpDir, providerZipName(request)))
+				assert.True(t, os.IsNotExist(err))
+			}
+		})
+	}
+}
+
+func TestServerGet_RegistryArchiveShouldMatchLockedHashes(t *testing.T) {
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	zipPath := filepath.Join(t.TempDir(), providerZipName(request))
+	writeProviderZip(t, zipPath, "terraform-provider-random_v3.6.0_x5")
+	zh, err := fileSha256(zipPath)
+	require.NoError(t, err)
+	h1, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+	require.NoError(t, err)
+
+	cases := []struct {
+		desc     string
+		hashes   []string
+		mismatch bool
+	}{
+		{
+			desc:   "zh",
+			hashes: []string{mismatchedHash, "zh:" + zh},
+		},
+		{
+			desc:   "h1",
+			hashes: []string{h1},
+		},
+		{
+			desc:     "mismatch",
+			hashes:   []string{mismatchedHash, "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+			mismatch: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			registry := newStandInRegistry(t, request)
+			s := NewServer(nil)
+			defer s.Cleanup()
+			s.SetRegistryURL(registry.URL + "/v1/providers")
+			// Hashes from `.terraform.lock.hcl` are keyed by the lower case namespace.
+			s.AddProviderHashes(Request{Namespace: "HashiCorp", Name: request.Name, Version: request.Version}, c.hashes...)
+
+			err := s.Get(request)
+			if c.mismatch {
+				require.ErrorIs(t, err, ErrChecksumMismatch)
+				assert.Contains(t, err.Error(), ".terraform.lock.hcl")
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestServerGet_UnlockedRegistryProviderShouldBeRefused(t *testing.T) {
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	registry := newStandInRegistry(t, request)
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetRegistryURL(registry.URL + "/v1/providers")
+	s.AddProviderHashes(Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}, mismatchedHash)
+
+	err := s.Get(request)
+	require.ErrorIs(t, err, ErrProviderNotLocked)
+	assert.Equal(t, int32(0), registry.hits.Load())
+
+	s.SetAllowUnlockedProviders(true)
+	require.NoError(t, s.Get(request))
+}
+
+func TestServerGet_ProviderShouldBeVerifiedAgainWhenLockedHashesChange(t *testing.T) {
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	dir := t.TempDir()
+	binary := writeLocalProvider(t, dir, request)
+	h1, err := dirhash.HashDir(filepath.Dir(binary), "", dirhash.Hash1)
+	require.NoError(t, err)
+	launcher := &fakePluginLauncher{}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetOffline(true)
+	s.AddProviderDir(dir)
+
+	s.setLockedHashes(map[Request][]string{request: {h1}})
+	_, err = s.GetProviderSchema(request)
+	require.NoError(t, err)
+
+	// The lock file of the next module locks the same provider version with other hashes.
+	s.setLockedHashes(map[Request][]string{request: {"h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}})
+	_, ok := s.cachedProviderSchema(request)
+	assert.False(t, ok)
+	_, err = s.GetProviderSchema(request)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+
+	// A module without the provider in its lock file doesn't inherit the hashes of another one.
+	s.setLockedHashes(nil)
+	assert.Empty(t, s.providerHashes(request))
+	_, err = s.GetProviderSchema(request)
+	require.NoError(t, err)
+
+	// A module with the first lock file again reuses what has been verified for it, the same binary runs in one plugin.
+	s.setLockedHashes(map[Request][]string{request: {h1}})
+	_, ok = s.cachedProviderSchema(request)
+	assert.True(t, ok)
+	launched := launcher.launches()
+	require.Len(t, launched, 1)
+	assert.False(t, launched[0].closed.Load())
+}
+
+func TestServerGet_LocalProviderShouldMatchLockedHashes(t *testing.T) {
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	unpackedDir := t.TempDir()
+	binary := writeLocalProvider(t, unpackedDir, request)
+	unpackedH1, err := dirhash.HashDir(filepath.Dir(binary), "", dirhash.Hash1)
+	require.NoError(t, err)
+	packedDir := t.TempDir()
+	typeDir := filepath.Join(packedDir, "registry.terraform.io", "hashicorp", "random")
+	require.NoError(t, os.MkdirAll(typeDir, 0750))
+	zipPath := filepath.Join(typeDir, providerZipName(request))
+	writeProviderZip(t, zipPath, "terraform-provider-random_v3.6.0_x5")
+	zh, err := fileSha256(zipPath)
+	require.NoError(t, err)
+
+	cases := []struct {
+		desc     string
+		dir      string
+		hashes   []string
+		mismatch bool
+	}{
+		{
+			desc:   "unpacked",
+			dir:    unpackedDir,
+			hashes: []string{unpackedH1},
+		},
+		{
+			desc:     "unpacked mismatch",
+			dir:      unpackedDir,
+			hashes:   []string{"h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+			mismatch: true,
+		},
+		{
+			desc:   "unpacked without h1",
+			dir:    unpackedDir,
+			hashes: []string{mismatchedHash},
+		},
+		{
+			desc:   "packed",
+			dir:    packedDir,
+			hashes: []string{"zh:" + zh},
+		},
+		{
+			desc:     "packed mismatch",
+			dir:      packedDir,
+			hashes:   []string{mismatchedHash},
+			mismatch: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			s := NewServer(nil)
+			defer s.Cleanup()
+			s.SetOffline(true)
+			s.AddProviderDir(c.dir)
+			s.AddProviderHashes(request, c.hashes...)
+
+			err := s.Get(request)
+			if c.mismatch {
+				require.ErrorIs(t, err, ErrChecksumMismatch)
+				_, ok := s.providerPath(request)
+				assert.False(t, ok)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestServerLoadSchema_MismatchedProviderShouldNotBeLaunched(t *testing.T) {
+	launcher := &fakePluginLauncher{}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	s := newLocalProviderServer(t, request)
+	defer s.Cleanup()
+	s.AddProviderHashes(request, "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+
+	_, err := s.GetProviderSchema(request)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Empty(t, launcher.launches())
+}
+
+func TestParseLockFileHashes(t *testing.T) {
+	mockFs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(mockFs, "/module/.terraform.lock.hcl", []byte(fmt.Sprintf(`provider "registry.terraform.io/hashicorp/azurerm" {
+  version     = "4.37.0"
+  constraints = "~> 4.0"
+  hashes = [
+    "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=",
+    %q,
+  ]
+}
+
+provider "registry.terraform.io/azure/azapi" {
+  version = "2.5.0"
+}
+`, mismatchedHash)), 0644))
+	stub := gostub.Stub(&Fs, mockFs)
+	defer stub.Reset()
+
+	hashes, err := parseLockFileHashes("/module/.terraform.lock.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, map[Request][]string{
+		{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}: {"h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", mismatchedHash},
+	}, hashes)
+
+	hashes, err = parseLockFileHashes("/other/.terraform.lock.hcl")
+	require.NoError(t, err)
+	assert.Empty(t, hashes)
+}
@@ -0,0 +1,206 @@
+package pkg
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProviderSource(t *testing.T) {
+	cases := []struct {
+		source   string
+		expected providerAddress
+	}{
+		{
+			source:   "azurerm",
+			expected: providerAddress{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "azurerm"},
+		},
+		{
+			source:   "Azure/azapi",
+			expected: providerAddress{Hostname: "registry.terraform.io", Namespace: "Azure", Type: "azapi"},
+		},
+		{
+			source:   "registry.opentofu.org/hashicorp/random",
+			expected: providerAddress{Hostname: "registry.opentofu.org", Namespace: "hashicorp", Type: "random"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.source, func(t *testing.T) {
+			addr, err := parseProviderSource(c.source)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, addr)
+		})
+	}
+	for _, invalid := range []string{"", "hashicorp/", "a/b/c/d"} {
+		_, err := parseProviderSource(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+const requiredProvidersConfig = `terraform {
+  required_providers {
+    azurerm = {
+      source                = "hashicorp/azurerm"
+      version               = "~> 4.0"
+      configuration_aliases = [azurerm.west]
+    }
+    az = {
+      source = "contoso/azurerm"
+    }
+    random = "~> 3.0"
+  }
+}
+`
+
+func newProviderTestDirectory(t *testing.T, config string) *directory {
+	mockFs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(mockFs, "/tmp/terraform.tf", []byte(config), 0644))
+	stub := gostub.Stub(&Fs, mockFs)
+	t.Cleanup(stub.Reset)
+	d := newDirectory("/tmp", nil)
+	d.providerVersions = map[string]map[string]string{
+		"hashicorp": {
+			"azurerm": "4.37.0",
+			"random":  "3.6.0",
+		},
+		"contoso": {
+			"azurerm": "1.0.0",
+		},
+		"azure": {
+			"azapi": "2.5.0",
+		},
+	}
+	require.NoError(t, d.loadRequiredProviders())
+	return d
+}
+
+func parseBlock(t *testing.T, code string) *HclBlock {
+	f, diags := ParseConfig([]byte(code), "main.tf")
+	require.False(t, diags.HasErrors(), diags.Error())
+	return f.GetBlock(0)
+}
+
+func TestResolveProvider(t *testing.T) {
+	d := newProviderTestDirectory(t, requiredProvidersConfig)
+	cases := []struct {
+		desc     string
+		code     string
+		expected providerAddress
+		version  string
+	}{
+		{
+			desc:     "resource type prefix",
+			code:     `resource "azurerm_resource_group" "this" {}`,
+			expected: providerAddress{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "azurerm"},
+			version:  "4.37.0",
+		},
+		{
+			desc: "provider meta-argument with alias",
+			code: `resource "azurerm_resource_group" "this" {
+  provider = az.west
+}`,
+			expected: providerAddress{Hostname: "registry.terraform.io", Namespace: "contoso", Type: "azurerm"},
+			version:  "1.0.0",
+		},
+		{
+			desc:     "legacy version-only entry",
+			code:     `data "random_string" "this" {}`,
+			expected: providerAddress{Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "random"},
+			version:  "3.6.0",
+		},
+		{
+			desc:     "undeclared provider falls back to lock file",
+			code:     `resource "azapi_resource" "this" {}`,
+			expected: providerAddress{Hostname: "registry.terraform.io", Namespace: "azure", Type: "azapi"},
+			version:  "2.5.0",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			addr, err := d.resolveProvider(parseBlock(t, c.code))
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, addr)
+			version, err := d.resolveProviderVersion(addr)
+			require.NoError(t, err)
+			assert.Equal(t, c.version, version)
+		})
+	}
+}
+
+func TestLoadRequiredProviders_ShouldReadJSONConfig(t *testing.T) {
+	mockFs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(mockFs, "/tmp/terraform.tf.json", []byte(`{
+  "terraform": {
+    "required_providers": {
+      "az": {
+        "source": "app.terraform.io/contoso/azurerm",
+        "version": "~> 1.0",
+        "configuration_aliases": ["az.west"]
+      },
+      "random": "~> 3.0"
+    }
+  }
+}`), 0644))
+	stub := gostub.Stub(&Fs, mockFs)
+	defer stub.Reset()
+	d := newDirectory("/tmp", nil)
+
+	require.NoError(t, d.loadRequiredProviders())
+	assert.Equal(t, map[string]providerAddress{
+		"az":     {Hostname: "app.terraform.io", Namespace: "contoso", Type: "azurerm"},
+		"random": {Hostname: "registry.terraform.io", Namespace: "hashicorp", Type: "random"},
+	}, d.requiredProviders)
+	addr, err := d.resolveProvider(parseBlock(t, `resource "azurerm_resource_group" "this" {
+  provider = az.west
+}`))
+	require.NoError(t, err)
+	assert.Equal(t, providerAddress{Hostname: "app.terraform.io", Namespace: "contoso", Type: "azurerm"}, addr)
+}
+
+func TestResolveProvider_UnknownProviderShouldReturnError(t *testing.T) {
+	d := newProviderTestDirectory(t, requiredProvidersConfig)
+	_, err := d.resolveProvider(parseBlock(t, `resource "aws_vpc" "this" {}`))
+	assert.ErrorContains(t, err, "provider aws for resource aws_vpc not found")
+}
+
+type recordingSchemaGetter struct {
+	dummySchemaGetter
+	requests []Request
+}
+
+func (g *recordingSchemaGetter) GetResourceSchema(request Request, resource string) (*tfjson.Schema, error) {
+	g.requests = append(g.requests, request)
+	return g.dummySchemaGetter.GetResourceSchema(request, resource)
+}
+
+func TestBuildBlockWithSchema_ShouldQuerySchemaFromResolvedProvider(t *testing.T) {
+	d := newProviderTestDirectory(t, `terraform {
+  required_providers {
+    cloud = {
+      source = "contoso/azurerm"
+    }
+  }
+}
+`)
+	getter := &recordingSchemaGetter{}
+	stub := gostub.Stub(&tfPluginServer, getter).Stub(&resolveProvider, func(block *HclBlock, file *HclFile) (providerAddress, error) {
+		return d.resolveProvider(block)
+	}).Stub(&resolveProviderVersion, func(provider providerAddress, file *HclFile) (string, error) {
+		return d.resolveProviderVersion(provider)
+	})
+	defer stub.Reset()
+	f, diags := ParseConfig([]byte(`resource "azurerm_resource_group" "this" {
+  provider = cloud
+  name     = "rg"
+  location = "eastus"
+}`), "main.tf")
+	require.False(t, diags.HasErrors())
+	_, err := BuildBlockWithSchema(f.GetBlock(0), f)
+	require.NoError(t, err)
+	require.NotEmpty(t, getter.requests)
+	assert.Equal(t, Request{Namespace: "contoso", Name: "azurerm", Version: "1.0.0", Hostname: "registry.terraform.io"}, getter.requests[0])
+}
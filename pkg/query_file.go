@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// isQueryFile checks whether the file is a Terraform query file, e.g. `main.tfquery.hcl`, query files are only read from the module folder.
+func isQueryFile(fileName string) bool {
+	return strings.HasSuffix(fileName, ".tfquery.hcl")
+}
+
+// QueryFile is the wrapper of a query file, its `list` blocks are validated but never rewritten.
+type QueryFile struct {
+	dir  *directory
+	File *HclFile
+}
+
+func BuildQueryFile(f *HclFile) *QueryFile {
+	return &QueryFile{
+		dir:  f.dir,
+		File: f,
+	}
+}
+
+func (f *QueryFile) AutoFix() error {
+	if !f.dir.ruleEnabled(RuleQueryListSchema) {
+		return nil
+	}
+	for i, b := range f.File.Body.(*hclsyntax.Body).Blocks {
+		if b.Type != "list" || len(b.Labels) != 2 {
+			continue
+		}
+		if err := f.checkListBlock(f.File.GetBlock(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkListBlock reports the arguments and nested blocks in the `config` block the list resource doesn't declare,
+// and the required arguments it misses. Nothing is reported if the provider's list resources are unknown.
+func (f *QueryFile) checkListBlock(block *HclBlock) error {
+	schema, err := f.listResourceSchema(block)
+	if errors.Is(err, errListResourceSchemaNotFound) {
+		f.File.ruleWarning(block.Block, RuleQueryListSchema, fmt.Sprintf("list resource %s is not declared by the provider", block.Labels[0]))
+		return nil
+	}
+	if err != nil {
+		if f.File.skipBlock(block.Block, err) {
+			return nil
+		}
+		return err
+	}
+	if schema == nil || schema.Block == nil {
+		return nil
+	}
+	var config *hclsyntax.Body
+	for _, nb := range block.Body.Blocks {
+		if nb.Type == "config" {
+			config = nb.Body
+		}
+	}
+	if config == nil {
+		config = &hclsyntax.Body{}
+	}
+	if problems := checkBodyBySchema(config, schema.Block, "config"); len(problems) > 0 {
+		// A block gets one warning per rule, so the problems are reported together.
+		f.File.ruleWarning(block.Block, RuleQueryListSchema, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (f *QueryFile) listResourceSchema(block *HclBlock) (*tfjson.Schema, error) {
+	provider, err := resolveProvider(block, f.File)
+	if err != nil {
+		return nil, err
+	}
+	version, err := resolveProviderVersion(provider, f.File)
+	if err != nil {
+		return nil, err
+	}
+	return queryListResourceSchema(f.dir.schemaGetter(), block.Labels[0], provider, version)
+}
+
+// checkBodyBySchema returns the problems of the body against the schema, nested blocks are checked recursively.
+// Dynamic blocks are checked by their labels only since their content is generated.
+func checkBodyBySchema(body *hclsyntax.Body, schema *tfjson.SchemaBlock, path string) []string {
+	var problems []string
+	for _, name := range slices.Sorted(maps.Keys(body.Attributes)) {
+		attr, ok := schema.Attributes[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unsupported argument %s.%s", path, name))
+			continue
+		}
+		if attr.Computed && !attr.Optional && !attr.Required {
+			problems = append(problems, fmt.Sprintf("computed attribute %s.%s cannot be set", path, name))
+		}
+	}
+	for _, nb := range body.Blocks {
+		name := nb.Type
+		if nb.Type == "dynamic" && len(nb.Labels) == 1 {
+			name = nb.Labels[0]
+		}
+		nbSchema, ok := schema.NestedBlocks[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unsupported block %s.%s", path, name))
+			continue
+		}
+		if nb.Type != "dynamic" && nbSchema.Block != nil {
+			problems = append(problems, checkBodyBySchema(nb.Body, nbSchema.Block, path+"."+name)...)
+		}
+	}
+	var required []string
+	for name, attr := range schema.Attributes {
+		if _, ok := body.Attributes[name]; attr.Required && !ok {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	for _, name := range required {
+		problems = append(problems, fmt.Sprintf("missing required argument %s.%s", path, name))
+	}
+	return problems
+}
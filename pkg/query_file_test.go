@@ -0,0 +1,97 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const queryFile = `list "azurerm_resource_group" "valid" {
+  provider = azurerm
+
+  config {
+    subscription_id = var.subscription_id
+    filter {
+      tag = "env"
+    }
+  }
+}
+
+list "azurerm_resource_group" "invalid" {
+  provider = azurerm
+  limit    = 10
+
+  config {
+    id          = "x"
+    location    = "eastus"
+    name_prefix = "rg-"
+    filter {
+      owner = "me"
+    }
+    dynamic "scope" {
+      for_each = []
+      content {}
+    }
+  }
+}
+
+list "azurerm_resource_group" "without_config" {
+  provider = azurerm
+}
+
+list "azurerm_virtual_network" "undeclared" {
+  provider = azurerm
+}
+`
+
+func TestRunShouldValidateListBlocksInQueryFiles(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/schemas.json":              identitySchemasJson,
+		"/module/main.tf":            "",
+		"/module/search.tfquery.hcl": queryFile,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{
+		SchemaFile: "/schemas.json",
+	})
+	require.NoError(t, err)
+	reasons := make(map[string]string)
+	for _, w := range result.Warnings {
+		assert.Equal(t, "/module/search.tfquery.hcl", w.File)
+		assert.Equal(t, pkg.RuleQueryListSchema, w.Rule)
+		reasons[w.Block] = w.Reason
+	}
+	assert.Equal(t, map[string]string{
+		"list.azurerm_resource_group.invalid":        "computed attribute config.id cannot be set; unsupported argument config.location; unsupported argument config.filter.owner; unsupported block config.scope; missing required argument config.subscription_id",
+		"list.azurerm_resource_group.without_config": "missing required argument config.subscription_id",
+		"list.azurerm_virtual_network.undeclared":    "list resource azurerm_virtual_network is not declared by the provider",
+	}, reasons)
+	// List blocks are never rewritten.
+	content, err := afero.ReadFile(mockFs, "/module/search.tfquery.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, queryFile, string(content))
+	assert.Empty(t, result.Changes)
+}
+
+func TestRunWithDisabledQueryListSchemaShouldNotWarn(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/schemas.json":              identitySchemasJson,
+		"/module/main.tf":            "",
+		"/module/search.tfquery.hcl": queryFile,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{
+		SchemaFile:    "/schemas.json",
+		DisabledRules: []string{pkg.RuleQueryListSchema},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.Warnings)
+}
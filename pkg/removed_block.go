@@ -16,6 +16,10 @@ func BuildRemovedBlock(b *HclBlock, f *HclFile) AutoFixBlock {
 	}
 }
 
+func (r *RemovedBlock) rule() string {
+	return RuleRemovedOrder
+}
+
 func (r *RemovedBlock) AutoFix() error {
 	from, ok := r.HclBlock.Attributes()["from"]
 	if !ok {
@@ -0,0 +1,428 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// ReportFormat is the format of the machine-readable report of the fixes.
+type ReportFormat string
+
+const (
+	ReportJSON  ReportFormat = "json"
+	ReportSARIF ReportFormat = "sarif"
+)
+
+// ParseReportFormat converts a string into ReportFormat.
+func ParseReportFormat(format string) (ReportFormat, error) {
+	switch f := ReportFormat(format); f {
+	case ReportJSON, ReportSARIF:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown report format %q, valid formats are %s and %s", format, ReportJSON, ReportSARIF)
+}
+
+// Location is a range in a file, lines and columns are 1-based.
+type Location struct {
+	File        string `json:"file"`
+	StartLine   int    `json:"start_line"`
+	StartColumn int    `json:"start_column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+}
+
+func newLocation(file string, r hcl.Range) Location {
+	return Location{
+		File:        file,
+		StartLine:   r.Start.Line,
+		StartColumn: r.Start.Column,
+		EndLine:     r.End.Line,
+		EndColumn:   r.End.Column,
+	}
+}
+
+// Fix is a change avmfix made, or would make in DryRun mode, to a block.
+// Before is the range of the block before the fix, After is the range after it, they're in different files if the block has been moved.
+type Fix struct {
+	File   string   `json:"file"`
+	Block  string   `json:"block"`
+	Rule   string   `json:"rule"`
+	Before Location `json:"before"`
+	After  Location `json:"after"`
+}
+
+type reportBlock struct {
+	file    string
+	address string
+	// index is the position among the blocks with the same address in the file, e.g. the second `locals` block.
+	index int
+	block *hclsyntax.Block
+}
+
+func (b *reportBlock) key() fixKey {
+	return fixKey{file: b.file, address: b.address, index: b.index}
+}
+
+// fixKey identifies a block by its file, address and position among the blocks with the same address in the file.
+type fixKey struct {
+	file    string
+	address string
+	index   int
+}
+
+// recordFix records that the rule has been applied to the block, the fixes in the report are built from these records.
+func (d *directory) recordFix(b *hclsyntax.Block, rule string) {
+	if d == nil {
+		return
+	}
+	key := fixKey{file: b.Range().Filename, address: blockAddress(b), index: d.blockIndex(b)}
+	if d.fixes == nil {
+		d.fixes = make(map[fixKey][]string)
+	}
+	if !slices.Contains(d.fixes[key], rule) {
+		d.fixes[key] = append(d.fixes[key], rule)
+	}
+}
+
+// applyRule runs the fix of the rule on the block and records the rule if the fix has changed the block.
+func (d *directory) applyRule(block *HclBlock, rule string, fix func() error) error {
+	before := block.WriteBlock.BuildTokens(nil).Bytes()
+	if err := fix(); err != nil {
+		return err
+	}
+	if !bytes.Equal(before, block.WriteBlock.BuildTokens(nil).Bytes()) {
+		d.recordFix(block.Block, rule)
+	}
+	return nil
+}
+
+// blockIndex returns the position of the block among the blocks with the same address in its file. The blocks in a
+// `.tf.json` file always have unique addresses.
+func (d *directory) blockIndex(b *hclsyntax.Block) int {
+	address := blockAddress(b)
+	for _, f := range d.tfFiles {
+		if f.FileName != b.Range().Filename || f.json != nil {
+			continue
+		}
+		index := 0
+		for _, other := range f.Body.(*hclsyntax.Body).Blocks {
+			if other == b {
+				return index
+			}
+			if blockAddress(other) == address {
+				index++
+			}
+		}
+	}
+	return 0
+}
+
+// fixesOf pairs the blocks before and after the changes and returns the fixes recorded for them.
+func (d *directory) fixesOf(changes []FileChange) ([]Fix, error) {
+	var before, after []*reportBlock
+	for _, change := range changes {
+		b, err := reportBlocks(change.Path, change.Original)
+		if err != nil {
+			return nil, err
+		}
+		before = append(before, b...)
+		a, err := reportBlocks(change.Path, change.Fixed)
+		if err != nil {
+			return nil, err
+		}
+		after = append(after, a...)
+	}
+	pairs := matchBlocks(before, after)
+	var fixes []Fix
+	for _, p := range pairs {
+		for _, rule := range d.appliedRules(p[0], p[1]) {
+			fixes = append(fixes, Fix{
+				File:   p[1].file,
+				Block:  p[1].address,
+				Rule:   rule,
+				Before: newLocation(p[0].file, p[0].block.Range()),
+				After:  newLocation(p[1].file, p[1].block.Range()),
+			})
+		}
+	}
+	sort.SliceStable(fixes, func(i, j int) bool {
+		if fixes[i].Before.File != fixes[j].Before.File {
+			return fixes[i].Before.File < fixes[j].Before.File
+		}
+		return fixes[i].Before.StartLine < fixes[j].Before.StartLine
+	})
+	return fixes, nil
+}
+
+func reportBlocks(path string, content []byte) ([]*reportBlock, error) {
+	if len(content) == 0 {
+		return nil, nil
+	}
+	var blocks []*hclsyntax.Block
+	if isJSONConfigFile(path) {
+		doc, err := parseJSONObject(content, path)
+		if err != nil {
+			return nil, err
+		}
+		blocks = jsonSyntaxBlocks(doc)
+	} else {
+		f, diags := hclsyntax.ParseConfig(content, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		blocks = f.Body.(*hclsyntax.Body).Blocks
+	}
+	seen := make(map[string]int)
+	var r []*reportBlock
+	for _, b := range blocks {
+		address := blockAddress(b)
+		r = append(r, &reportBlock{
+			file:    path,
+			address: address,
+			index:   seen[address],
+			block:   b,
+		})
+		seen[address]++
+	}
+	return r, nil
+}
+
+// matchBlocks pairs the blocks before and after the changes. Blocks staying in the same file are matched first,
+// the rest are matched by address in order, they've been moved into another file.
+func matchBlocks(before, after []*reportBlock) [][2]*reportBlock {
+	var pairs [][2]*reportBlock
+	matched := make(map[*reportBlock]bool)
+	inFile := make(map[string]*reportBlock)
+	for _, a := range after {
+		inFile[fmt.Sprintf("%s\x00%s\x00%d", a.file, a.address, a.index)] = a
+	}
+	for _, b := range before {
+		if a, ok := inFile[fmt.Sprintf("%s\x00%s\x00%d", b.file, b.address, b.index)]; ok {
+			pairs = append(pairs, [2]*reportBlock{b, a})
+			matched[a] = true
+			matched[b] = true
+		}
+	}
+	rest := make(map[string][]*reportBlock)
+	for _, a := range after {
+		if !matched[a] {
+			rest[a.address] = append(rest[a.address], a)
+		}
+	}
+	for _, b := range before {
+		if matched[b] || len(rest[b.address]) == 0 {
+			continue
+		}
+		pairs = append(pairs, [2]*reportBlock{b, rest[b.address][0]})
+		rest[b.address] = rest[b.address][1:]
+	}
+	return pairs
+}
+
+// appliedRules returns the rules recorded for the block, the block might have been fixed before and after it has been moved.
+// File placement comes first and the order rules last, like the fixes are applied.
+func (d *directory) appliedRules(before, after *reportBlock) []string {
+	rules := slices.Clone(d.fixes[before.key()])
+	for _, rule := range d.fixes[after.key()] {
+		if !slices.Contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return fixRulePriority(rules[i]) < fixRulePriority(rules[j])
+	})
+	return rules
+}
+
+func fixRulePriority(rule string) int {
+	switch {
+	case rule == RuleVariableFilePlacement || rule == RuleOutputFilePlacement:
+		return 0
+	case slices.Contains(slices.Collect(maps.Values(orderRules)), rule):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// WriteReport writes the fixes and warnings in the result to w, file paths in a SARIF report are relative to root.
+func WriteReport(w io.Writer, format ReportFormat, result *Result, root string) error {
+	var report any
+	switch format {
+	case ReportJSON:
+		report = jsonReport{
+			Fixes:    emptyIfNil(result.Fixes),
+			Warnings: emptyIfNil(result.Warnings),
+		}
+	case ReportSARIF:
+		report = newSarifReport(result, root)
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func emptyIfNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+type jsonReport struct {
+	Fixes    []Fix     `json:"fixes"`
+	Warnings []Warning `json:"warnings"`
+}
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifReport struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations"`
+	Properties map[string]any  `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// newSarifReport reports every fix as a result located at the block before the fix, that's where the code violates the rule.
+// Warnings of rules avmfix cannot fix are reported at the line of the block.
+func newSarifReport(result *Result, root string) sarifReport {
+	var rules []sarifRule
+	for _, rule := range Rules() {
+		rules = append(rules, sarifRule{
+			ID:               rule.ID,
+			ShortDescription: sarifMessage{Text: rule.Description},
+		})
+	}
+	results := []sarifResult{}
+	for _, fix := range result.Fixes {
+		results = append(results, sarifResult{
+			RuleID:  fix.Rule,
+			Level:   "warning",
+			Message: sarifMessage{Text: fmt.Sprintf("%s violates %s", fix.Block, fix.Rule)},
+			Locations: []sarifLocation{
+				{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: relativeURI(root, fix.Before.File)},
+						Region: sarifRegion{
+							StartLine:   fix.Before.StartLine,
+							StartColumn: fix.Before.StartColumn,
+							EndLine:     fix.Before.EndLine,
+							EndColumn:   fix.Before.EndColumn,
+						},
+					},
+				},
+			},
+			Properties: map[string]any{
+				"after": fix.After,
+			},
+		})
+	}
+	for _, w := range result.Warnings {
+		// Skipped blocks don't violate any rule.
+		if w.Rule == "" {
+			continue
+		}
+		results = append(results, sarifResult{
+			RuleID:  w.Rule,
+			Level:   "warning",
+			Message: sarifMessage{Text: fmt.Sprintf("%s: %s", w.Block, w.Reason)},
+			Locations: []sarifLocation{
+				{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: relativeURI(root, w.File)},
+						Region: sarifRegion{
+							StartLine: w.Line,
+							EndLine:   w.Line,
+						},
+					},
+				},
+			},
+		})
+	}
+	return sarifReport{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name:           "avmfix",
+						InformationURI: "https://github.com/lonegunmanb/avmfix",
+						Rules:          rules,
+					},
+				},
+				Results: results,
+			},
+		},
+	}
+}
+
+func relativeURI(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,165 @@
+package pkg_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runReportFixture(t *testing.T) *pkg.Result {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": `resource "azurerm_resource_group" "this" {
+  location = "eastus"
+  name     = "rg"
+  tags     = {}
+}
+
+resource "azurerm_resource_group" "unsorted" {
+  tags     = {}
+  name     = "rg"
+  location = "eastus"
+}
+
+variable "moved" {
+  type     = string
+  nullable = true
+}
+`,
+		"/module/variables.tf": `variable "b" {
+  type = string
+}
+
+variable "a" {
+  type = string
+}
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	t.Cleanup(stub.Reset)
+	result, err := pkg.Run("/module", pkg.Options{
+		DryRun: true,
+	})
+	require.NoError(t, err)
+	return result
+}
+
+func TestRunShouldReportFixes(t *testing.T) {
+	result := runReportFixture(t)
+
+	rules := make(map[string][]string)
+	for _, fix := range result.Fixes {
+		rules[fix.Block] = append(rules[fix.Block], fix.Rule)
+	}
+	assert.Equal(t, map[string][]string{
+		"resource.azurerm_resource_group.unsorted": {pkg.RuleResourceOrder},
+		"variable.moved": {pkg.RuleVariableFilePlacement, pkg.RuleVariableNullable},
+		"variable.a":     {pkg.RuleVariableOrder},
+		"variable.b":     {pkg.RuleVariableOrder},
+	}, rules)
+	for _, fix := range result.Fixes {
+		if fix.Block != "variable.moved" {
+			continue
+		}
+		assert.Equal(t, pkg.Location{File: "/module/main.tf", StartLine: 13, StartColumn: 1, EndLine: 16, EndColumn: 2}, fix.Before)
+		assert.Equal(t, "/module/variables.tf", fix.After.File)
+		assert.Equal(t, "/module/variables.tf", fix.File)
+	}
+}
+
+func TestWriteReport_JSON(t *testing.T) {
+	result := runReportFixture(t)
+	buf := &bytes.Buffer{}
+	require.NoError(t, pkg.WriteReport(buf, pkg.ReportJSON, result, "/module"))
+	var report struct {
+		Fixes    []pkg.Fix     `json:"fixes"`
+		Warnings []pkg.Warning `json:"warnings"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, result.Fixes, report.Fixes)
+	assert.Empty(t, report.Warnings)
+}
+
+func TestWriteReport_SARIF(t *testing.T) {
+	result := runReportFixture(t)
+	buf := &bytes.Buffer{}
+	require.NoError(t, pkg.WriteReport(buf, pkg.ReportSARIF, result, "/module"))
+	var report struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, "2.1.0", report.Version)
+	require.Len(t, report.Runs, 1)
+	assert.Len(t, report.Runs[0].Tool.Driver.Rules, len(pkg.Rules()))
+	require.Len(t, report.Runs[0].Results, len(result.Fixes))
+	first := report.Runs[0].Results[0]
+	assert.Equal(t, pkg.RuleResourceOrder, first.RuleID)
+	assert.Equal(t, "main.tf", first.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, 7, first.Locations[0].PhysicalLocation.Region.StartLine)
+}
+
+func TestParseReportFormat(t *testing.T) {
+	format, err := pkg.ParseReportFormat("sarif")
+	require.NoError(t, err)
+	assert.Equal(t, pkg.ReportSARIF, format)
+	_, err = pkg.ParseReportFormat("xml")
+	assert.ErrorContains(t, err, "unknown report format")
+}
+
+func TestRunShouldReportTheRulesTheFixesApplied(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/variables.tf": `variable "a" {
+  type = string
+
+  default = "a"
+}
+`,
+		"/module/outputs.tf": `output "a" {
+  sensitive = false
+  value     = "a"
+}
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+	result, err := pkg.Run("/module", pkg.Options{
+		DryRun: true,
+	})
+	require.NoError(t, err)
+
+	rules := make(map[string][]string)
+	for _, fix := range result.Fixes {
+		rules[fix.Block] = append(rules[fix.Block], fix.Rule)
+	}
+	assert.Equal(t, map[string][]string{
+		// The arguments are in order already, only the layout has been rewritten.
+		"variable.a": {pkg.RuleVariableOrder},
+		"output.a":   {pkg.RuleOutputSensitive},
+	}, rules)
+}
@@ -10,46 +10,53 @@ var _ rootBlock = &ResourceBlock{}
 // ResourceBlock is the wrapper of a resource Block
 type ResourceBlock struct {
 	*resourceBlock
-	namespace            string
+	provider             providerAddress
 	version              string
 	Type                 string
 	TailMetaArgs         Args
 	TailMetaNestedBlocks *NestedBlocks
+	// schemas resolves the provider schema of the block, see directory.schemaGetter.
+	schemas SchemaGetter
 }
 
-func (b *ResourceBlock) getProviderNamespace() string {
-	return b.namespace
+func (b *ResourceBlock) getProvider() providerAddress {
+	return b.provider
 }
 
 func (b *ResourceBlock) getProviderVersion() string {
 	return b.version
 }
 
+func (b *ResourceBlock) getSchemaGetter() SchemaGetter {
+	return b.schemas
+}
+
 func (b *ResourceBlock) schemaBlock() (*tfjson.SchemaBlock, error) {
-	return queryBlockSchema(b.path(), b.namespace, b.version)
+	return queryProviderBlockSchema(b.schemas, b.path(), b.provider, b.version)
 }
 
-var resolveNamespace = func(resourceType string, file *HclFile) (string, error) {
-	return file.dir.resolveNamespace(resourceType)
+var resolveProvider = func(block *HclBlock, file *HclFile) (providerAddress, error) {
+	return file.dir.resolveProvider(block)
 }
-var resolveProviderVersion = func(namespace, resourceType string, file *HclFile) (string, error) {
-	return file.dir.resolveProviderVersion(namespace, resourceType)
+var resolveProviderVersion = func(provider providerAddress, file *HclFile) (string, error) {
+	return file.dir.resolveProviderVersion(provider)
 }
 
 // BuildBlockWithSchema Build the root Block wrapper using hclsyntax.Block
 func BuildBlockWithSchema(block *HclBlock, file *HclFile) (*ResourceBlock, error) {
 	resourceType, resourceName := block.Labels[0], block.Labels[1]
 
-	var namespace, version string
+	var provider providerAddress
+	var version string
 	var err error
 
 	// Special handling for builtin resources like terraform_data
 	if resourceType != "terraform_data" {
-		namespace, err = resolveNamespace(resourceType, file)
+		provider, err = resolveProvider(block, file)
 		if err != nil {
 			return nil, err
 		}
-		version, err = resolveProviderVersion(namespace, resourceType, file)
+		version, err = resolveProviderVersion(provider, file)
 		if err != nil {
 			return nil, err
 		}
@@ -57,8 +64,9 @@ func BuildBlockWithSchema(block *HclBlock, file *HclFile) (*ResourceBlock, error
 
 	b := &ResourceBlock{
 		resourceBlock: newBlock(resourceName, block, file.File, []string{block.Type, resourceType}),
-		namespace:     namespace,
+		provider:      provider,
 		version:       version,
+		schemas:       file.dir.schemaGetter(),
 		Type:          resourceType,
 	}
 	err = buildArgs(b, block.Attributes())
@@ -72,6 +80,10 @@ func BuildBlockWithSchema(block *HclBlock, file *HclFile) (*ResourceBlock, error
 	return b, nil
 }
 
+func (b *ResourceBlock) rule() string {
+	return RuleResourceOrder
+}
+
 func (b *ResourceBlock) AutoFix() error {
 	for _, nestedBlock := range b.nestedBlocks() {
 		if err := nestedBlock.AutoFix(); err != nil {
@@ -37,15 +37,19 @@ type providerGRPCPlugin struct {
 // Must be exported for the plugin framework to use it.
 func (p providerGRPCPlugin) GRPCClient(_ context.Context, _ *plugin.GRPCBroker, c *grpc.ClientConn) (interface{}, error) {
 	if p.protocolVersion == 5 {
+		client := tfplugin5.NewProviderClient(c)
 		return &providerGRPCClientV5{
+			client: client,
 			providerGRPCClient: &providerGRPCClient[*tfplugin5.GetProviderSchema_Request, *tfplugin5.GetProviderSchema_Response]{
-				grpcClient: v5SchemaClient{client: tfplugin5.NewProviderClient(c)},
+				grpcClient: v5SchemaClient{client: client},
 			},
 		}, nil
 	}
+	client := tfplugin6.NewProviderClient(c)
 	return &providerGRPCClientV6{
+		client: client,
 		providerGRPCClient: &providerGRPCClient[*tfplugin6.GetProviderSchema_Request, *tfplugin6.GetProviderSchema_Response]{
-			grpcClient: v6SchemaClient{client: tfplugin6.NewProviderClient(c)},
+			grpcClient: v6SchemaClient{client: client},
 		},
 	}, nil
 }
@@ -99,6 +103,7 @@ func (c *providerGRPCClient[TReq, TResp]) Schema(req TReq) (TResp, error) {
 // providerGRPCClientV5 wraps the gRPC client for protocol v5
 type providerGRPCClientV5 struct {
 	*providerGRPCClient[*tfplugin5.GetProviderSchema_Request, *tfplugin5.GetProviderSchema_Response]
+	client tfplugin5.ProviderClient
 }
 
 // v5Schema calls GetSchema on the provider and returns the protobuf response
@@ -107,9 +112,19 @@ func (c *providerGRPCClientV5) v5Schema() (*tfplugin5.GetProviderSchema_Response
 	return c.Schema(protoReq)
 }
 
+// v5IdentitySchemas calls GetResourceIdentitySchemas on the provider and returns the protobuf response
+func (c *providerGRPCClientV5) v5IdentitySchemas() (*tfplugin5.GetResourceIdentitySchemas_Response, error) {
+	resp, err := c.client.GetResourceIdentitySchemas(context.Background(), &tfplugin5.GetResourceIdentitySchemas_Request{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource identity schemas: %w", err)
+	}
+	return resp, nil
+}
+
 // providerGRPCClientV6 wraps the gRPC client for protocol v6
 type providerGRPCClientV6 struct {
 	*providerGRPCClient[*tfplugin6.GetProviderSchema_Request, *tfplugin6.GetProviderSchema_Response]
+	client tfplugin6.ProviderClient
 }
 
 // v6Schema calls GetProviderSchema on the provider and returns the protobuf response
@@ -118,10 +133,25 @@ func (c *providerGRPCClientV6) v6Schema() (*tfplugin6.GetProviderSchema_Response
 	return c.Schema(protoReq)
 }
 
+// v6IdentitySchemas calls GetResourceIdentitySchemas on the provider and returns the protobuf response
+func (c *providerGRPCClientV6) v6IdentitySchemas() (*tfplugin6.GetResourceIdentitySchemas_Response, error) {
+	resp, err := c.client.GetResourceIdentitySchemas(context.Background(), &tfplugin6.GetResourceIdentitySchemas_Request{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource identity schemas: %w", err)
+	}
+	return resp, nil
+}
+
 // universalProvider provides a unified interface that works with both V5 and V6 protocols
 type universalProvider interface {
 	v5Schema() (*tfplugin5.GetProviderSchema_Response, error)
 	v6Schema() (*tfplugin6.GetProviderSchema_Response, error)
+	// v5IdentitySchemas and v6IdentitySchemas return the resource identity schemas, providers built with older SDKs
+	// return an Unimplemented error.
+	v5IdentitySchemas() (*tfplugin5.GetResourceIdentitySchemas_Response, error)
+	v6IdentitySchemas() (*tfplugin6.GetResourceIdentitySchemas_Response, error)
+	// exited reports whether the plugin process has exited.
+	exited() bool
 	close()
 }
 
@@ -162,14 +192,16 @@ func newGrpcClient(providerPath string) (universalProvider, error) {
 	// We need to wrap it in a universal client that supports both interfaces
 	if v5Client, ok := raw.(*providerGRPCClientV5); ok {
 		return &universalProviderClient{
-			v5:        v5Client,
-			closeFunc: client.Kill,
+			v5:         v5Client,
+			closeFunc:  client.Kill,
+			exitedFunc: client.Exited,
 		}, nil
 	}
 	if v6Client, ok := raw.(*providerGRPCClientV6); ok {
 		return &universalProviderClient{
-			v6:        v6Client,
-			closeFunc: client.Kill,
+			v6:         v6Client,
+			closeFunc:  client.Kill,
+			exitedFunc: client.Exited,
 		}, nil
 	}
 
@@ -179,9 +211,10 @@ func newGrpcClient(providerPath string) (universalProvider, error) {
 
 // universalProviderClient implements UniversalProvider and wraps either V5 or V6 clients
 type universalProviderClient struct {
-	v5        *providerGRPCClientV5
-	v6        *providerGRPCClientV6
-	closeFunc func()
+	v5         *providerGRPCClientV5
+	v6         *providerGRPCClientV6
+	closeFunc  func()
+	exitedFunc func() bool
 }
 
 func (c *universalProviderClient) v5Schema() (*tfplugin5.GetProviderSchema_Response, error) {
@@ -198,6 +231,24 @@ func (c *universalProviderClient) v6Schema() (*tfplugin6.GetProviderSchema_Respo
 	return nil, errors.New("v6 protocol not supported by this provider")
 }
 
+func (c *universalProviderClient) v5IdentitySchemas() (*tfplugin5.GetResourceIdentitySchemas_Response, error) {
+	if c.v5 != nil {
+		return c.v5.v5IdentitySchemas()
+	}
+	return nil, errors.New("v5 protocol not supported by this provider")
+}
+
+func (c *universalProviderClient) v6IdentitySchemas() (*tfplugin6.GetResourceIdentitySchemas_Response, error) {
+	if c.v6 != nil {
+		return c.v6.v6IdentitySchemas()
+	}
+	return nil, errors.New("v6 protocol not supported by this provider")
+}
+
+func (c *universalProviderClient) exited() bool {
+	return c.exitedFunc != nil && c.exitedFunc()
+}
+
 func (c *universalProviderClient) close() {
 	if c.closeFunc != nil {
 		c.closeFunc()
@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Rule is a fix avmfix applies according to the Azure Verified Modules Codex.
+type Rule struct {
+	ID          string
+	Description string
+	// Optional rules are disabled unless they're enabled by the config file or the CLI flags.
+	Optional bool
+}
+
+const (
+	RuleResourceOrder                  = "resource-order"
+	RuleModuleOrder                    = "module-order"
+	RuleLocalsOrder                    = "locals-order"
+	RuleRequiredProvidersOrder         = "required-providers-order"
+	RuleMovedOrder                     = "moved-order"
+	RuleRemovedOrder                   = "removed-order"
+	RuleVariableOrder                  = "variable-order"
+	RuleVariableNullable               = "variable-nullable"
+	RuleVariableSensitive              = "variable-sensitive"
+	RuleVariableFilePlacement          = "variable-file-placement"
+	RuleOutputOrder                    = "output-order"
+	RuleOutputSensitive                = "output-sensitive"
+	RuleOutputFilePlacement            = "output-file-placement"
+	RuleTestRunOrder                   = "test-run-order"
+	RuleTestVariablesOrder             = "test-variables-order"
+	RuleTestMockDefaultsOrder          = "test-mock-defaults-order"
+	RuleModuleRegistryVersion          = "module-registry-version"
+	RuleModuleGitRef                   = "module-git-ref"
+	RuleModuleVersionConstraint        = "module-version-constraint"
+	RuleModulePinGitRef                = "module-pin-git-ref"
+	RuleModuleUndeclaredArgument       = "module-undeclared-argument"
+	RuleModuleRemoveUndeclaredArgument = "module-remove-undeclared-argument"
+	RuleModuleRequiredVariable         = "module-required-variable"
+	RuleImportIdentityOrder            = "import-identity-order"
+	RuleQueryListSchema                = "query-list-schema"
+)
+
+// Rules returns all rules avmfix knows, sorted by the order they're documented in.
+func Rules() []Rule {
+	return []Rule{
+		{ID: RuleResourceOrder, Description: "Arguments and nested blocks in resource, data and ephemeral blocks are sorted by their schema"},
+		{ID: RuleModuleOrder, Description: "Arguments in module blocks are sorted by the child module's variables"},
+		{ID: RuleLocalsOrder, Description: "Local values are sorted by name"},
+		{ID: RuleRequiredProvidersOrder, Description: "Providers in required_providers are sorted by name"},
+		{ID: RuleMovedOrder, Description: "Arguments in moved blocks are sorted"},
+		{ID: RuleRemovedOrder, Description: "Arguments in removed blocks are sorted"},
+		{ID: RuleVariableOrder, Description: "Variable arguments are sorted, required variables come first, then optional ones, both sorted by name"},
+		{ID: RuleVariableNullable, Description: "Redundant nullable = true is removed from variables"},
+		{ID: RuleVariableSensitive, Description: "Redundant sensitive = false is removed from variables"},
+		{ID: RuleVariableFilePlacement, Description: "Variables are declared in variables.tf, which contains variables only"},
+		{ID: RuleOutputOrder, Description: "Output arguments are sorted, outputs are sorted by name"},
+		{ID: RuleOutputSensitive, Description: "Redundant sensitive = false is removed from outputs"},
+		{ID: RuleOutputFilePlacement, Description: "Outputs are declared in outputs.tf, which contains outputs only"},
+		{ID: RuleTestRunOrder, Description: "Arguments and nested blocks in run blocks of test files are sorted: command, module, providers, variables, assert, expect_failures"},
+		{ID: RuleTestVariablesOrder, Description: "Variables in variables blocks of test files are sorted by name"},
+		{ID: RuleTestMockDefaultsOrder, Description: "Defaults of mock_resource and mock_data blocks in test files are sorted by the provider schema"},
+		{ID: RuleModuleRegistryVersion, Description: "Modules from a registry must set version, violations are reported as warnings"},
+		{ID: RuleModuleGitRef, Description: "Modules from git:: sources must set ref, violations are reported as warnings"},
+		{ID: RuleModuleVersionConstraint, Description: "Module version constraints must have an upper bound, like 1.2.3 or ~> 1.2, violations are reported as warnings"},
+		{ID: RuleModulePinGitRef, Description: "Branch refs in git:: module sources are replaced by the tag or commit installed in .terraform/modules, disabled by default", Optional: true},
+		{ID: RuleModuleUndeclaredArgument, Description: "Module arguments not declared as variables by the child module are reported as warnings"},
+		{ID: RuleModuleRemoveUndeclaredArgument, Description: "Module arguments not declared as variables by the child module are removed, disabled by default", Optional: true},
+		{ID: RuleModuleRequiredVariable, Description: "Missing required variables of the child module are added to module blocks as null stubs and reported as warnings, disabled by default", Optional: true},
+		{ID: RuleImportIdentityOrder, Description: "Attributes in the identity of import blocks are sorted by the resource identity schema, required ones first"},
+		{ID: RuleQueryListSchema, Description: "Config blocks of list blocks in .tfquery.hcl files are checked against the list resource schema, violations are reported as warnings"},
+	}
+}
+
+var orderRules = map[string]string{
+	"resource":  RuleResourceOrder,
+	"data":      RuleResourceOrder,
+	"ephemeral": RuleResourceOrder,
+	"module":    RuleModuleOrder,
+	"locals":    RuleLocalsOrder,
+	"terraform": RuleRequiredProvidersOrder,
+	"moved":     RuleMovedOrder,
+	"removed":   RuleRemovedOrder,
+	"import":    RuleImportIdentityOrder,
+	"variable":  RuleVariableOrder,
+	"output":    RuleOutputOrder,
+	// Blocks in test files.
+	"run":           RuleTestRunOrder,
+	"variables":     RuleTestVariablesOrder,
+	"mock_provider": RuleTestMockDefaultsOrder,
+}
+
+// ruleEnabled returns true if the rule hasn't been disabled. When there is no directory, e.g. in unit tests,
+// all rules except the optional ones are enabled.
+func (d *directory) ruleEnabled(id string) bool {
+	if d == nil {
+		return !slices.ContainsFunc(Rules(), func(r Rule) bool { return r.ID == id && r.Optional })
+	}
+	return !d.disabledRules[id]
+}
+
+// checkRuleIDs returns an error listing the ids that don't match any rule.
+func checkRuleIDs(ids []string) error {
+	var unknown []string
+	for _, id := range ids {
+		if !slices.ContainsFunc(Rules(), func(r Rule) bool { return r.ID == id }) {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown rule(s): %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// disabledRules merges the rule toggles, optional rules are disabled by default, then the config file is applied, then the CLI flags.
+func disabledRules(config *Config, enabled, disabled []string) (map[string]bool, error) {
+	r := make(map[string]bool)
+	for _, rule := range Rules() {
+		if rule.Optional {
+			r[rule.ID] = true
+		}
+	}
+	if config != nil {
+		for _, rule := range config.Rules {
+			if err := checkRuleIDs([]string{rule.ID}); err != nil {
+				return nil, err
+			}
+			if rule.Enabled != nil {
+				r[rule.ID] = !*rule.Enabled
+			}
+		}
+	}
+	if err := checkRuleIDs(append(slices.Clone(enabled), disabled...)); err != nil {
+		return nil, err
+	}
+	for _, id := range enabled {
+		r[id] = false
+	}
+	for _, id := range disabled {
+		r[id] = true
+	}
+	return r, nil
+}
@@ -0,0 +1,202 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const nullableVariable = `variable "name" {
+  type     = string
+  nullable = true
+}
+`
+
+func TestRunWithDisabledFilePlacementShouldKeepVariableInPlace(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": unsortedLocals + `
+variable "name" {
+  nullable    = true
+  description = "name"
+  type        = string
+}
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{
+		DisabledRules: []string{pkg.RuleVariableFilePlacement},
+	})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf")
+	require.NoError(t, err)
+	// The variable is kept in place but still fixed by the other rules.
+	assert.Equal(t, formatHcl(sortedLocals+`
+variable "name" {
+  type        = string
+  description = "name"
+}
+`), formatHcl(string(content)))
+	exists, err := afero.Exists(mockFs, "/module/variables.tf")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestRunWithDisabledFilePlacementShouldKeepBlocksInOrder(t *testing.T) {
+	cases := []struct {
+		desc     string
+		file     string
+		rule     string
+		content  string
+		expected string
+	}{
+		{
+			desc: "variables",
+			file: "variables.tf",
+			rule: pkg.RuleVariableFilePlacement,
+			content: `variable "b" {
+  type = string
+}
+
+locals {
+  a = 1
+}
+
+variable "a" {
+  type = string
+}
+`,
+			expected: `variable "a" {
+  type = string
+}
+
+locals {
+  a = 1
+}
+
+variable "b" {
+  type = string
+}
+`,
+		},
+		{
+			desc: "outputs",
+			file: "outputs.tf",
+			rule: pkg.RuleOutputFilePlacement,
+			content: `locals {
+  a = 1
+}
+
+output "b" {
+  value = 1
+}
+
+output "a" {
+  value = 2
+}
+`,
+			expected: `locals {
+  a = 1
+}
+
+output "a" {
+  value = 2
+}
+
+output "b" {
+  value = 1
+}
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			mockFs := fakeFs(map[string]string{
+				"/module/" + c.file: c.content,
+			})
+			stub := gostub.Stub(&pkg.Fs, mockFs)
+			defer stub.Reset()
+
+			_, err := pkg.Run("/module", pkg.Options{
+				DisabledRules: []string{c.rule},
+			})
+			require.NoError(t, err)
+			content, err := afero.ReadFile(mockFs, "/module/"+c.file)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, string(content))
+		})
+	}
+}
+
+func TestRunWithConfigFileShouldToggleRules(t *testing.T) {
+	config := `rule "variable-nullable" {
+  enabled = false
+}
+
+rule "locals-order" {
+  enabled = false
+}
+`
+	cases := []struct {
+		desc              string
+		enabledRules      []string
+		expectedVariables string
+		expectedMain      string
+	}{
+		{
+			desc:              "config only",
+			expectedVariables: nullableVariable,
+			expectedMain:      unsortedLocals,
+		},
+		{
+			desc:         "cli overrides config",
+			enabledRules: []string{pkg.RuleVariableNullable},
+			expectedVariables: `variable "name" {
+  type = string
+}
+`,
+			expectedMain: unsortedLocals,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			mockFs := fakeFs(map[string]string{
+				"/module/main.tf":      unsortedLocals,
+				"/module/variables.tf": nullableVariable,
+				"/avmfix.hcl":          config,
+			})
+			stub := gostub.Stub(&pkg.Fs, mockFs)
+			defer stub.Reset()
+
+			_, err := pkg.Run("/module", pkg.Options{
+				ConfigFile:   "/avmfix.hcl",
+				EnabledRules: c.enabledRules,
+			})
+			require.NoError(t, err)
+			content, err := afero.ReadFile(mockFs, "/module/variables.tf")
+			require.NoError(t, err)
+			assert.Equal(t, formatHcl(c.expectedVariables), formatHcl(string(content)))
+			content, err = afero.ReadFile(mockFs, "/module/main.tf")
+			require.NoError(t, err)
+			assert.Equal(t, c.expectedMain, string(content))
+		})
+	}
+}
+
+func TestRunWithUnknownRuleShouldReturnError(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{
+		DisabledRules: []string{"no-such-rule"},
+	})
+	assert.ErrorContains(t, err, "unknown rule(s): no-such-rule")
+}
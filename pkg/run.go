@@ -0,0 +1,381 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/afero"
+)
+
+// Options controls how Run processes a folder.
+type Options struct {
+	// ExcludePattern is a glob matched against paths relative to the target folder.
+	ExcludePattern string
+	// ExcludePatterns are more globs like ExcludePattern. They work like `.gitignore`, the last matching pattern wins,
+	// a pattern starting with `!` re-includes the paths excluded by the earlier ones, and a pattern without `/` matches base names.
+	ExcludePatterns []string
+	// IncludePatterns limits the processed files to the ones matching any of the globs.
+	IncludePatterns []string
+	// Recursive walks the folder tree and processes every folder containing `.tf` files as a separated module.
+	Recursive bool
+	// DryRun runs all fixes in memory, the fixed files are not written to disk. The changes are reported in Result.Changes.
+	// Unless Init is set, `init` only runs when the modules or the lock file are missing or stale, like InitAuto.
+	DryRun bool
+	// Offline forbids all network calls, provider binaries are resolved from `.terraform/providers` and ProviderMirror only.
+	// `init` never runs in offline mode, modules and the lock file must have been installed already.
+	Offline bool
+	// ProviderMirror is a filesystem mirror folder searched for provider binaries, e.g. one populated by `terraform providers mirror`.
+	ProviderMirror string
+	// SchemaCacheDir enables the persistent provider schema cache in this folder.
+	SchemaCacheDir string
+	// SchemaSources is the order the provider schemas are resolved in, e.g. `[]string{"cache", "mirror"}`,
+	// sources not listed are never used. The zero value means DefaultSchemaSources.
+	SchemaSources []string
+	// AllowUnlockedProviders allows downloading providers without hashes in `.terraform.lock.hcl` from the registry,
+	// they're only checked against the shasum reported by the registry.
+	AllowUnlockedProviders bool
+	// RegistryURL is the base URL of the provider registry download API, e.g. an Artifactory remote repository. The latest version
+	// of a provider missing in `.terraform.lock.hcl` is queried from it too. The zero value means "https://registry.opentofu.org/v1/providers".
+	RegistryURL string
+	// SchemaFile is the output of `terraform providers schema -json`, all schemas are read from it when it's set.
+	SchemaFile string
+	// Init decides whether `init` runs before a folder is fixed, the zero value means InitAlways, or InitAuto in DryRun mode.
+	// It's ignored in Offline mode.
+	Init InitMode
+	// InitBinary is the executable running `init`, e.g. `tofu`. The zero value means `terraform`.
+	InitBinary string
+	// EnabledRules and DisabledRules toggle rules by id, they take precedence over the rules in ConfigFile.
+	EnabledRules  []string
+	DisabledRules []string
+	// ConfigFile is the avmfix config file. When it's empty, `.avmfix.hcl` or `.avmfix.yaml` is discovered in the target folder or its parents.
+	// The options set by the caller take precedence over the config file.
+	ConfigFile string
+	// VariablesFile is the file variables are moved into, `variables.tf` by default.
+	VariablesFile string
+	// OutputsFile is the file outputs are moved into, `outputs.tf` by default.
+	OutputsFile string
+	// FailSoft leaves the blocks whose schema cannot be resolved untouched instead of failing the folder, they're reported in Result.Warnings.
+	FailSoft bool
+	// cleanup runs the folders on a plugin server of its own that is cleaned up once Run returns, so one-shot calls never leak
+	// plugin processes nor stop the plugins of concurrent Runs.
+	cleanup bool
+	// excludeBase and includeBase are the target folder relative to the config file's folder when the patterns come from the config file.
+	excludeBase string
+	includeBase string
+}
+
+// Result is the aggregated outcome of Run.
+type Result struct {
+	Directories []DirectoryResult
+	// Changes contains the files that have been changed, or would be changed in DryRun mode.
+	Changes []FileChange
+	// ConfigFile is the config file that has been loaded, it's empty if there is none.
+	ConfigFile string
+	// Fixes contains the fixes applied to every block, or would be applied in DryRun mode.
+	Fixes []Fix
+	// Warnings contains the blocks skipped in FailSoft mode.
+	Warnings []Warning
+}
+
+// DirectoryResult is the outcome of a single folder, Err is nil when the folder has been processed successfully.
+type DirectoryResult struct {
+	Path string
+	// Init describes how `init` has been handled, e.g. "terraform init" or "skipped, modules are up to date".
+	Init     string
+	Fixes    []Fix
+	Warnings []Warning
+	Err      error
+}
+
+// Failed returns the folders that could not be processed.
+func (r *Result) Failed() []DirectoryResult {
+	var failed []DirectoryResult
+	for _, d := range r.Directories {
+		if d.Err != nil {
+			failed = append(failed, d)
+		}
+	}
+	return failed
+}
+
+// Run applies the fixes to the folder according to opts.
+// A failed folder doesn't stop the others in recursive mode, all errors are joined into the returned error.
+// Run is safe for concurrent use, every call has its own settings while the providers are downloaded and launched once.
+func Run(dirPath string, opts Options) (*Result, error) {
+	configFile := opts.ConfigFile
+	if configFile == "" {
+		var err error
+		if configFile, err = FindConfig(dirPath); err != nil {
+			return nil, err
+		}
+	}
+	var config *Config
+	var base string
+	if configFile != "" {
+		var err error
+		if config, err = LoadConfig(configFile); err != nil {
+			return nil, err
+		}
+		if base, err = configBase(configFile, dirPath); err != nil {
+			return nil, err
+		}
+	}
+	opts, err := opts.applyConfig(config, base)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Init == "" && opts.DryRun {
+		opts.Init = InitAuto
+	}
+	if err = checkFileName("variables", opts.VariablesFile); err != nil {
+		return nil, err
+	}
+	if err = checkFileName("outputs", opts.OutputsFile); err != nil {
+		return nil, err
+	}
+	disabled, err := disabledRules(config, opts.EnabledRules, opts.DisabledRules)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newPathFilter(opts.excludePatterns(), opts.IncludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	filter.excludeBase, filter.includeBase = opts.excludeBase, opts.includeBase
+	dirs := []string{dirPath}
+	if opts.Recursive {
+		dirs, err = findTfDirectories(dirPath, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	schemas := tfPluginServer
+	if server, ok := tfPluginServer.(*Server); ok {
+		if opts.cleanup {
+			server = server.isolated()
+			defer server.Cleanup()
+		}
+		if schemas, err = configuredServer(server, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.SchemaFile != "" {
+		if schemas, err = LoadProviderSchemasFile(opts.SchemaFile); err != nil {
+			return nil, err
+		}
+	}
+	result := &Result{
+		ConfigFile: configFile,
+	}
+	var errs []error
+	for _, dir := range dirs {
+		dr, changes := runDirectory(dirPath, dir, opts, filter, disabled, schemas)
+		result.Directories = append(result.Directories, dr)
+		result.Fixes = append(result.Fixes, dr.Fixes...)
+		result.Warnings = append(result.Warnings, dr.Warnings...)
+		if dr.Err != nil {
+			err := dr.Err
+			if opts.Recursive {
+				err = fmt.Errorf("%s: %w", dir, err)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		result.Changes = append(result.Changes, changes...)
+	}
+	return result, errors.Join(errs...)
+}
+
+func runDirectory(root, dirPath string, opts Options, filter *pathFilter, disabledRules map[string]bool, schemas SchemaGetter) (DirectoryResult, []FileChange) {
+	d := newDirectory(dirPath, filter)
+	d.root = root
+	d.variablesFile = opts.VariablesFile
+	d.outputsFile = opts.OutputsFile
+	d.initMode = opts.Init
+	d.initBinary = opts.InitBinary
+	d.offline = opts.Offline
+	d.failSoft = opts.FailSoft
+	d.disabledRules = disabledRules
+	d.schemas = schemas
+	// All writes are staged in an in-memory layer, the files on disk are only touched once the whole folder has been fixed.
+	d.fs = afero.NewCopyOnWriteFs(afero.NewReadOnlyFs(Fs), afero.NewMemMapFs())
+	r := DirectoryResult{
+		Path: dirPath,
+	}
+	r.Err = d.run()
+	r.Init = d.initReport
+	r.Warnings = d.warnings
+	if r.Err != nil {
+		return r, nil
+	}
+	changes, err := d.changes()
+	if err == nil {
+		r.Fixes, err = d.fixesOf(changes)
+	}
+	if err == nil && !opts.DryRun {
+		err = d.commit(changes)
+	}
+	if err != nil {
+		r.Err = err
+		return r, nil
+	}
+	return r, changes
+}
+
+func (opts Options) excludePatterns() []string {
+	var patterns []string
+	if opts.ExcludePattern != "" {
+		patterns = append(patterns, opts.ExcludePattern)
+	}
+	return append(patterns, opts.ExcludePatterns...)
+}
+
+// configuredServer returns a fork of the plugin server configured by opts, the settings of concurrent Runs never mix
+// while they still share the downloaded providers, the schemas and the running plugins.
+func configuredServer(server *Server, opts Options) (*Server, error) {
+	s := server.fork()
+	if err := s.SetSchemaSources(opts.SchemaSources...); err != nil {
+		return nil, err
+	}
+	s.SetRegistryURL(opts.RegistryURL)
+	s.SetOffline(opts.Offline)
+	s.SetAllowUnlockedProviders(opts.AllowUnlockedProviders)
+	if opts.ProviderMirror != "" {
+		s.AddProviderDir(opts.ProviderMirror)
+	}
+	s.SetCacheDir(opts.SchemaCacheDir)
+	return s, nil
+}
+
+// Cleanup stops the provider plugin processes launched by Run and removes the downloaded providers. It should be called
+// once the program is done with Run, the plugins are kept running between calls so each provider is launched only once.
+func Cleanup() {
+	if s, ok := tfPluginServer.(*Server); ok {
+		s.Cleanup()
+	}
+}
+
+// DefaultSchemaCacheDir returns the schema cache folder under the user cache directory, or an empty string if there is none.
+func DefaultSchemaCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "avmfix", "schemas")
+}
+
+// findTfDirectories walks the tree under root and returns every folder that contains `.tf` or `.tf.json` files, sorted by path.
+// Hidden folders like `.terraform` and `.git` are skipped, so are excluded folders and folders without any processed `.tf` file.
+func findTfDirectories(root string, filter *pathFilter) ([]string, error) {
+	found := make(map[string]struct{})
+	err := afero.Walk(Fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if strings.HasPrefix(info.Name(), ".") || filter.excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isConfigFile(info.Name()) && !filter.skipFile(rel) {
+			found[filepath.Dir(path)] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for dir := range found {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// DirectoryAutoFix applies the fixes to the folder, the provider plugins launched by the call are stopped before it returns.
+func DirectoryAutoFix(dirPath string, excludePatterns ...string) error {
+	_, err := Run(dirPath, Options{
+		ExcludePatterns: excludePatterns,
+		cleanup:         true,
+	})
+	return err
+}
+
+// FileChange describes a file whose content would be changed by the fixes.
+// Original is nil when the file would be created.
+type FileChange struct {
+	Path     string
+	Original []byte
+	Fixed    []byte
+	// root is the target folder of Run, the paths in the diff are relative to it.
+	root string
+}
+
+// DirectoryCheck runs the same fixes as DirectoryAutoFix in memory and returns every file whose content would change.
+// Nothing is written to disk, a compliant folder returns an empty slice. Like DirectoryAutoFix, the provider plugins launched
+// by the call are stopped before it returns.
+func DirectoryCheck(dirPath string, excludePatterns ...string) ([]FileChange, error) {
+	result, err := Run(dirPath, Options{
+		ExcludePatterns: excludePatterns,
+		DryRun:          true,
+		cleanup:         true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Changes, nil
+}
+
+// UnifiedDiff renders the change as a unified diff, a created file is compared with /dev/null.
+// The paths are relative to the target folder of Run, so the diff can be applied by `git apply` or `patch -p1` there.
+func (c FileChange) UnifiedDiff() (string, error) {
+	path := c.relPath()
+	fromFile := "a/" + path
+	if c.Original == nil {
+		fromFile = "/dev/null"
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(c.Original),
+		B:        splitLines(c.Fixed),
+		FromFile: fromFile,
+		ToFile:   "b/" + path,
+		Context:  3,
+	})
+}
+
+func (c FileChange) relPath() string {
+	rel, err := filepath.Rel(c.root, c.Path)
+	if err != nil {
+		return filepath.ToSlash(c.Path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// splitLines splits the content into lines, a last line without newline is marked like `diff -u` does,
+// so it's different from the same line with a newline.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n\\ No newline at end of file\n"
+	return lines
+}
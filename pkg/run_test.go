@@ -0,0 +1,275 @@
+package pkg_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const unsortedLocals = `locals {
+  b = "b"
+  a = "a"
+}
+`
+
+const sortedLocals = `locals {
+  a = "a"
+  b = "b"
+}
+`
+
+func TestRunRecursiveShouldFixEveryNestedModule(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/main.tf":                           unsortedLocals,
+		"/repo/modules/a/main.tf":                 unsortedLocals,
+		"/repo/examples/default/main.tf":          unsortedLocals,
+		"/repo/examples/legacy/main.tf":           unsortedLocals,
+		"/repo/modules/a/skip.tf":                 unsortedLocals,
+		"/repo/.terraform/modules/remote/main.tf": unsortedLocals,
+		"/repo/modules/a/.terraform/x/main.tf":    unsortedLocals,
+		"/repo/docs/readme.md":                    "# readme",
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/repo", pkg.Options{
+		Recursive:      true,
+		ExcludePattern: "{examples/legacy,modules/a/skip.tf}",
+	})
+	require.NoError(t, err)
+	var dirs []string
+	for _, d := range result.Directories {
+		assert.NoError(t, d.Err)
+		dirs = append(dirs, d.Path)
+	}
+	assert.Equal(t, []string{"/repo", "/repo/examples/default", "/repo/modules/a"}, dirs)
+	for _, fixed := range []string{"/repo/main.tf", "/repo/modules/a/main.tf", "/repo/examples/default/main.tf"} {
+		content, err := afero.ReadFile(mockFs, fixed)
+		require.NoError(t, err)
+		assert.Equal(t, formatHcl(sortedLocals), formatHcl(string(content)), fixed)
+	}
+	for _, untouched := range []string{"/repo/examples/legacy/main.tf", "/repo/modules/a/skip.tf", "/repo/.terraform/modules/remote/main.tf", "/repo/modules/a/.terraform/x/main.tf"} {
+		content, err := afero.ReadFile(mockFs, untouched)
+		require.NoError(t, err)
+		assert.Equal(t, unsortedLocals, string(content), untouched)
+	}
+}
+
+func TestRunRecursiveShouldReportAllFailedFolders(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/modules/a/main.tf": `locals {`,
+		"/repo/modules/b/main.tf": unsortedLocals,
+		"/repo/modules/c/main.tf": `resource {`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/repo", pkg.Options{
+		Recursive: true,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/repo/modules/a")
+	assert.Contains(t, err.Error(), "/repo/modules/c")
+	require.Len(t, result.Directories, 3)
+	failed := result.Failed()
+	require.Len(t, failed, 2)
+	assert.Equal(t, "/repo/modules/a", failed[0].Path)
+	assert.Equal(t, "/repo/modules/c", failed[1].Path)
+	content, err := afero.ReadFile(mockFs, "/repo/modules/b/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, formatHcl(sortedLocals), formatHcl(string(content)))
+}
+
+func TestRunRecursiveDryRunShouldCollectChangesFromAllFolders(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/main.tf":           sortedLocals,
+		"/repo/modules/a/main.tf": unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/repo", pkg.Options{
+		Recursive: true,
+		DryRun:    true,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, "/repo/modules/a/main.tf", result.Changes[0].Path)
+	content, err := afero.ReadFile(mockFs, "/repo/modules/a/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, unsortedLocals, string(content))
+}
+
+func TestRunFailSoftShouldSkipBlocksWithUnresolvedSchema(t *testing.T) {
+	unknown := `resource "unknown_thing" "this" {
+  b = 1
+  a = 2
+}
+`
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": unsortedLocals + "\n" + unknown,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{})
+	require.Error(t, err)
+
+	result, err := pkg.Run("/module", pkg.Options{
+		FailSoft: true,
+	})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, formatHcl(sortedLocals+"\n"+unknown), formatHcl(string(content)))
+	require.Len(t, result.Warnings, 1)
+	w := result.Warnings[0]
+	assert.Equal(t, "/module/main.tf", w.File)
+	assert.Equal(t, 6, w.Line)
+	assert.Equal(t, "resource.unknown_thing.this", w.Block)
+	assert.Contains(t, w.Reason, "unknown_thing")
+}
+
+func TestRunShouldNotTouchAnyFileWhenFolderFails(t *testing.T) {
+	files := map[string]string{
+		"/module/main.tf": unsortedLocals + `
+variable "name" {
+  type = string
+}
+`,
+		"/module/unknown.tf": `resource "unknown_thing" "this" {}
+`,
+	}
+	mockFs := fakeFs(files)
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{})
+	require.Error(t, err)
+	entries, err := afero.ReadDir(mockFs, "/module")
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"main.tf", "unknown.tf"}, names)
+	for path, expected := range files {
+		content, err := afero.ReadFile(mockFs, path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content), path)
+	}
+}
+
+// renameFailingFs fails the renames onto target, like a file locked by another process.
+type renameFailingFs struct {
+	afero.Fs
+	target string
+}
+
+func (fs renameFailingFs) Rename(oldname, newname string) error {
+	if newname == fs.target {
+		return errors.New("file is locked")
+	}
+	return fs.Fs.Rename(oldname, newname)
+}
+
+func TestRunShouldRestoreCommittedFilesWhenRenameFails(t *testing.T) {
+	files := map[string]string{
+		"/module/main.tf": unsortedLocals + `
+variable "name" {
+  type = string
+}
+`,
+	}
+	mockFs := fakeFs(files)
+	stub := gostub.Stub(&pkg.Fs, renameFailingFs{Fs: mockFs, target: "/module/variables.tf"})
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "file is locked")
+	entries, err := afero.ReadDir(mockFs, "/module")
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// main.tf has been renamed before variables.tf failed, it's restored.
+	assert.Equal(t, []string{"main.tf"}, names)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, files["/module/main.tf"], string(content))
+}
+
+func TestRunShouldLeaveNoTempFileAfterCommit(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": unsortedLocals + `
+variable "name" {
+  type = string
+}
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{})
+	require.NoError(t, err)
+	entries, err := afero.ReadDir(mockFs, "/module")
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"main.tf", "variables.tf"}, names)
+	assert.Len(t, result.Changes, 2)
+	content, err := afero.ReadFile(mockFs, "/module/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(sortedLocals), strings.TrimSpace(string(content)))
+}
+
+func TestRunRecursiveWithIncludePatternsShouldOnlyFixMatchingFiles(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/repo/main.tf":               unsortedLocals,
+		"/repo/generated/main.tf":     unsortedLocals,
+		"/repo/generated/legacy_a.tf": unsortedLocals,
+		"/repo/modules/a/main.tf":     unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/repo", pkg.Options{
+		Recursive:       true,
+		IncludePatterns: []string{"generated/**"},
+		ExcludePatterns: []string{"legacy_*.tf"},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Directories, 1)
+	assert.Equal(t, "/repo/generated", result.Directories[0].Path)
+	content, err := afero.ReadFile(mockFs, "/repo/generated/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, formatHcl(sortedLocals), formatHcl(string(content)))
+	for _, untouched := range []string{"/repo/main.tf", "/repo/generated/legacy_a.tf", "/repo/modules/a/main.tf"} {
+		content, err := afero.ReadFile(mockFs, untouched)
+		require.NoError(t, err)
+		assert.Equal(t, unsortedLocals, string(content), untouched)
+	}
+}
+
+func TestRunWithInvalidExcludePatternShouldReturnError(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf": unsortedLocals,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	assert.NotPanics(t, func() {
+		err := pkg.DirectoryAutoFix("/module", "[a-")
+		assert.ErrorContains(t, err, "invalid glob pattern")
+	})
+}
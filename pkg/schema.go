@@ -2,10 +2,13 @@ package pkg
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"strings"
 
+	"github.com/hashicorp/go-version"
 	tfjson "github.com/hashicorp/terraform-json"
 )
 
@@ -17,7 +20,22 @@ type SchemaGetter interface {
 
 var tfPluginServer SchemaGetter = NewServer(nil)
 
+// identitySchemaGetter is implemented by schema getters that know the resource identity schemas, e.g. Server.
+type identitySchemaGetter interface {
+	GetResourceIdentitySchema(request Request, resource string) (*tfjson.IdentitySchema, error)
+}
+
+// listResourceSchemaGetter is implemented by schema getters that know the list resource schemas used by `.tfquery.hcl` files.
+type listResourceSchemaGetter interface {
+	GetListResourceSchema(request Request, listResource string) (*tfjson.Schema, error)
+}
+
 func queryBlockSchema(path []string, namespace string, version string) (*tfjson.SchemaBlock, error) {
+	return queryProviderBlockSchema(tfPluginServer, path, providerAddress{Namespace: namespace}, version)
+}
+
+// queryProviderBlockSchema queries the schema from the given provider, the provider type is derived from the block type when it's empty.
+func queryProviderBlockSchema(schemas SchemaGetter, path []string, provider providerAddress, version string) (*tfjson.SchemaBlock, error) {
 	if len(path) < 2 {
 		return nil, fmt.Errorf("invalid path:%v", path)
 	}
@@ -25,7 +43,7 @@ func queryBlockSchema(path []string, namespace string, version string) (*tfjson.
 	blockType := path[1]
 
 	// Special handling for terraform_data builtin resource
-	if blockType == "terraform_data" && namespace == "" && version == "" {
+	if blockType == "terraform_data" && provider.Namespace == "" && version == "" {
 		return &tfjson.SchemaBlock{
 			Attributes: map[string]*tfjson.SchemaAttribute{
 				"input": {
@@ -49,34 +67,28 @@ func queryBlockSchema(path []string, namespace string, version string) (*tfjson.
 		}, nil
 	}
 
-	providerType := strings.Split(blockType, "_")[0]
 	var getter func(Request, string) (*tfjson.Schema, error)
 	switch blockCategory {
 	case "resource":
-		getter = tfPluginServer.GetResourceSchema
+		getter = schemas.GetResourceSchema
 	case "data":
-		getter = tfPluginServer.GetDataSourceSchema
+		getter = schemas.GetDataSourceSchema
 	case "ephemeral":
-		getter = tfPluginServer.GetEphemeralResourceSchema
+		getter = schemas.GetEphemeralResourceSchema
 	default:
 		return nil, fmt.Errorf("unsupport block category: %s", blockCategory)
 	}
-	namespace = nameSpaceOrDefault(namespace, providerType)
-	version, err := versionOrLatest(namespace, providerType, version)
+	request, err := providerRequest(schemas, blockType, provider, version)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get version for %s: %w", providerType, err)
+		return nil, err
 	}
-	schema, err := getter(Request{
-		Namespace: namespace,
-		Name:      providerType,
-		Version:   version,
-	}, blockType)
+	schema, err := getter(request, blockType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get schema for %s: %w", blockType, err)
 	}
 	r := schema.Block
 	if postProcessor, ok := schemaPostProcessors[blockType]; ok {
-		postProcessor(r)
+		r = postProcessor(r)
 	}
 	for i := 2; i < len(path); i++ {
 		nb, ok := r.NestedBlocks[path[i]]
@@ -88,6 +100,72 @@ func queryBlockSchema(path []string, namespace string, version string) (*tfjson.
 	return r, nil
 }
 
+// providerRequest returns the request of the provider serving the block type, the provider type is derived from the block type when it's empty.
+func providerRequest(schemas SchemaGetter, blockType string, provider providerAddress, version string) (Request, error) {
+	providerType := provider.Type
+	if providerType == "" {
+		providerType = providerName(blockType)
+	}
+	namespace := nameSpaceOrDefault(provider.Namespace, providerType)
+	version, err := versionOrLatest(schemas, namespace, providerType, version)
+	if err != nil {
+		return Request{}, fmt.Errorf("failed to get version for %s: %w", providerType, err)
+	}
+	return Request{
+		Namespace: namespace,
+		Name:      providerType,
+		Version:   version,
+		Hostname:  provider.Hostname,
+	}, nil
+}
+
+// queryIdentitySchema queries the identity schema of the managed resource from the given provider. Nil is returned if the resource
+// has no identity, or the schema getter doesn't know resource identities.
+func queryIdentitySchema(schemas SchemaGetter, resourceType string, provider providerAddress, version string) (*tfjson.IdentitySchema, error) {
+	getter, ok := schemas.(identitySchemaGetter)
+	if !ok {
+		return nil, nil
+	}
+	request, err := providerRequest(schemas, resourceType, provider, version)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := getter.GetResourceIdentitySchema(request, resourceType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity schema for %s: %w", resourceType, err)
+	}
+	return schema, nil
+}
+
+// queryListResourceSchema queries the schema of the list resource from the given provider. Nil is returned if the provider's
+// list resources are unknown, e.g. the schema getter doesn't know list resources.
+func queryListResourceSchema(schemas SchemaGetter, listType string, provider providerAddress, version string) (*tfjson.Schema, error) {
+	getter, ok := schemas.(listResourceSchemaGetter)
+	if !ok {
+		return nil, nil
+	}
+	request, err := providerRequest(schemas, listType, provider, version)
+	if err != nil {
+		return nil, err
+	}
+	return getter.GetListResourceSchema(request, listType)
+}
+
+var errListResourceSchemaNotFound = errors.New("list resource schema not found")
+
+// listResourceSchema returns the schema of the list resource, nil is returned if the provider schema has no list resources at all,
+// since it might come from a source which doesn't carry them.
+func listResourceSchema(ps *tfjson.ProviderSchema, listResource string) (*tfjson.Schema, error) {
+	if len(ps.ListResourceSchemas) == 0 {
+		return nil, nil
+	}
+	schema, ok := ps.ListResourceSchemas[listResource]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errListResourceSchemaNotFound, listResource)
+	}
+	return schema, nil
+}
+
 func nameSpaceOrDefault(namespace string, providerType string) string {
 	if namespace == "" {
 		switch providerType {
@@ -102,12 +180,13 @@ func nameSpaceOrDefault(namespace string, providerType string) string {
 	return namespace
 }
 
-func getLatestVersion(namespace string, providerType string) (string, error) {
-	url := fmt.Sprintf("https://registry.terraform.io/v1/providers/%s/%s", namespace, providerType)
+// getLatestVersion returns the latest stable version of the provider listed by the registry's `{registryURL}/{namespace}/{type}/versions` endpoint.
+func getLatestVersion(registryURL, namespace, providerType string) (string, error) {
+	url := fmt.Sprintf("%s/%s/%s/versions", strings.TrimSuffix(registryURL, string(urlPathSeparator)), namespace, providerType)
 
 	resp, err := http.Get(url) // #nosec G107
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch provider info from registry: %w", err)
+		return "", fmt.Errorf("failed to fetch provider versions from registry: %w", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -117,24 +196,53 @@ func getLatestVersion(namespace string, providerType string) (string, error) {
 		return "", fmt.Errorf("registry API returned status %d for provider %s/%s", resp.StatusCode, namespace, providerType)
 	}
 
-	var providerInfo struct {
-		Tag string `json:"tag"`
+	var providerVersions struct {
+		Versions []struct {
+			Version string `json:"version"`
+		} `json:"versions"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&providerInfo); err != nil {
-		return "", fmt.Errorf("failed to decode provider info response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(&providerVersions); err != nil {
+		return "", fmt.Errorf("failed to decode provider versions response: %w", err)
 	}
 
-	if providerInfo.Tag == "" {
-		return "", fmt.Errorf("no tag found in provider info for %s/%s", namespace, providerType)
+	var latest *version.Version
+	for _, v := range providerVersions.Versions {
+		parsed, err := version.NewVersion(v.Version)
+		if err != nil || parsed.Prerelease() != "" {
+			continue
+		}
+		if latest == nil || parsed.GreaterThan(latest) {
+			latest = parsed
+		}
 	}
+	if latest == nil {
+		return "", fmt.Errorf("no version found in provider versions for %s/%s", namespace, providerType)
+	}
+
+	return latest.Original(), nil
+}
+
+// registryGetter is implemented by schema getters with a configured provider registry, e.g. Server.
+type registryGetter interface {
+	registryURL() string
+}
 
-	return providerInfo.Tag, nil
+// offlineGetter is implemented by schema getters that could forbid network calls.
+type offlineGetter interface {
+	Offline() bool
 }
 
-func versionOrLatest(namespace, providerType, version string) (string, error) {
+func versionOrLatest(schemas SchemaGetter, namespace, providerType, version string) (string, error) {
 	if version == "" {
-		v, err := getLatestVersion(namespace, providerType)
+		if og, ok := schemas.(offlineGetter); ok && og.Offline() {
+			return "", fmt.Errorf("cannot query latest version of %s/%s in offline mode, please pin it in .terraform.lock.hcl", namespace, providerType)
+		}
+		registryURL := pluginApi
+		if rg, ok := schemas.(registryGetter); ok {
+			registryURL = rg.registryURL()
+		}
+		v, err := getLatestVersion(registryURL, namespace, providerType)
 		if err != nil {
 			return "", err
 		}
@@ -143,13 +251,16 @@ func versionOrLatest(namespace, providerType, version string) (string, error) {
 	return strings.TrimPrefix(version, "v"), nil
 }
 
-var schemaPostProcessors = map[string]func(*tfjson.SchemaBlock){
+// schemaPostProcessors adjust the schemas of some blocks, they return a modified copy since the schemas are shared by concurrent queries.
+var schemaPostProcessors = map[string]func(*tfjson.SchemaBlock) *tfjson.SchemaBlock{
 	"azapi_resource":        azapiResourceSchemaPostProcessor,
 	"azapi_update_resource": azapiResourceSchemaPostProcessor,
 	"azapi_resource_action": azapiResourceSchemaPostProcessor,
 }
 
-func azapiResourceSchemaPostProcessor(b *tfjson.SchemaBlock) {
+func azapiResourceSchemaPostProcessor(b *tfjson.SchemaBlock) *tfjson.SchemaBlock {
+	r := *b
+	r.Attributes = maps.Clone(b.Attributes)
 	// `name` and `parent_id` and `location` are optional, but obviously they're more important than body and other attributes.
 	for _, key := range []string{
 		"name",
@@ -161,8 +272,11 @@ func azapiResourceSchemaPostProcessor(b *tfjson.SchemaBlock) {
 		"query_parameters",
 	} {
 		if attr, ok := b.Attributes[key]; ok {
-			attr.Optional = false
-			attr.Required = true
+			required := *attr
+			required.Optional = false
+			required.Required = true
+			r.Attributes[key] = &required
 		}
 	}
+	return &r
 }
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// schemaCacheFormatVersion is bumped when the cached schemas carry more data, version 2 added the resource identity schemas.
+const schemaCacheFormatVersion = 2
+
+// cachedSchema is the envelope persisted in the schema cache, Checksum is the hex encoded sha256 of Schema.
+type cachedSchema struct {
+	FormatVersion int             `json:"format_version"`
+	Checksum      string          `json:"checksum"`
+	Schema        json.RawMessage `json:"schema"`
+}
+
+// SetCacheDir enables the persistent schema cache, converted provider schemas are stored under dir and reused by later runs.
+func (s *Server) SetCacheDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheDir = dir
+}
+
+func (s *Server) schemaCacheDir() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cacheDir
+}
+
+// cachePath returns {cacheDir}/{hostname}/{namespace}/{name}/{version}/schema.json, keyed by the provider's source address so the
+// schemas of providers with the same namespace and name from different hosts never mix, whichever registry or mirror served them.
+// The port of the hostname is separated by `_` since `:` isn't allowed on Windows.
+func (s *Server) cachePath(request Request) (string, error) {
+	host := strings.ReplaceAll(request.hostname(), ":", "_")
+	for _, segment := range []string{host, request.Namespace, request.Name, request.Version} {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsAny(segment, `/\`) {
+			return "", fmt.Errorf("invalid request for schema cache: %s/%s/%s %s", request.hostname(), request.Namespace, request.Name, request.Version)
+		}
+	}
+	return filepath.Join(s.schemaCacheDir(), host, strings.ToLower(request.Namespace), request.Name, request.Version, "schema.json"), nil
+}
+
+// loadCachedSchema reads the schema from the cache, a missing, outdated or corrupted entry is reported as a miss.
+func (s *Server) loadCachedSchema(request Request) (*tfjson.ProviderSchema, bool) {
+	if s.schemaCacheDir() == "" {
+		return nil, false
+	}
+	l := s.l.With("request_namespace", request.Namespace, "request_name", request.Name, "request_version", request.Version)
+	path, err := s.cachePath(request)
+	if err != nil {
+		l.Warn("Skipping schema cache", "error", err)
+		return nil, false
+	}
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, false
+	}
+	var entry cachedSchema
+	if err := json.Unmarshal(content, &entry); err != nil || entry.FormatVersion != schemaCacheFormatVersion {
+		l.Warn("Ignoring unreadable schema cache entry", "path", path)
+		return nil, false
+	}
+	sum := sha256.Sum256(entry.Schema)
+	if hex.EncodeToString(sum[:]) != entry.Checksum {
+		l.Warn("Ignoring schema cache entry with mismatched checksum", "path", path)
+		return nil, false
+	}
+	var schema tfjson.ProviderSchema
+	if err := json.Unmarshal(entry.Schema, &schema); err != nil {
+		l.Warn("Ignoring undecodable schema cache entry", "path", path, "error", err)
+		return nil, false
+	}
+	l.Info("Schema loaded from cache", "path", path)
+	return &schema, true
+}
+
+// saveCachedSchema writes the schema into the cache through a temporary file and a rename,
+// so concurrent runs never read a partially written entry.
+func (s *Server) saveCachedSchema(request Request, schema *tfjson.ProviderSchema) error {
+	if s.schemaCacheDir() == "" {
+		return nil
+	}
+	path, err := s.cachePath(request)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provider schema: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	content, err := json.Marshal(cachedSchema{
+		FormatVersion: schemaCacheFormatVersion,
+		Checksum:      hex.EncodeToString(sum[:]),
+		Schema:        raw,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema cache entry: %w", err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("failed to create schema cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, "schema-*.json.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create schema cache file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write schema cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write schema cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save schema cache file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+var cachedTestSchema = &tfjson.ProviderSchema{
+	ResourceSchemas: map[string]*tfjson.Schema{
+		"azurerm_resource_group": {
+			Block: &tfjson.SchemaBlock{
+				Attributes: map[string]*tfjson.SchemaAttribute{
+					"name": {
+						AttributeType: cty.String,
+						Required:      true,
+					},
+				},
+			},
+		},
+	},
+}
+
+func TestSchemaCache_LaterServerShouldLoadSchemaWithoutProvider(t *testing.T) {
+	cacheDir := t.TempDir()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	writer := NewServer(nil)
+	writer.SetCacheDir(cacheDir)
+	require.NoError(t, writer.saveCachedSchema(request, cachedTestSchema))
+	assert.FileExists(t, filepath.Join(cacheDir, "registry.terraform.io", "hashicorp", "azurerm", "4.37.0", "schema.json"))
+
+	reader := NewServer(nil)
+	// No provider is available and network is disabled, so the schema must come from the cache.
+	reader.SetOffline(true)
+	reader.SetCacheDir(cacheDir)
+	schema, err := reader.GetResourceSchema(request, "azurerm_resource_group")
+	require.NoError(t, err)
+	assert.True(t, schema.Block.Attributes["name"].Required)
+	assert.Equal(t, cty.String, schema.Block.Attributes["name"].AttributeType)
+}
+
+func TestSchemaCache_CorruptedEntryShouldBeIgnored(t *testing.T) {
+	cacheDir := t.TempDir()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	s := NewServer(nil)
+	s.SetOffline(true)
+	s.SetCacheDir(cacheDir)
+	require.NoError(t, s.saveCachedSchema(request, cachedTestSchema))
+	path, err := s.cachePath(request)
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var entry cachedSchema
+	require.NoError(t, json.Unmarshal(content, &entry))
+	entry.Schema = json.RawMessage(strings.Replace(string(entry.Schema), `"required":true`, `"required":false`, 1))
+	tampered, err := json.Marshal(entry)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, tampered, 0600))
+
+	_, ok := s.loadCachedSchema(request)
+	assert.False(t, ok)
+	_, err = s.GetResourceSchema(request, "azurerm_resource_group")
+	assert.ErrorIs(t, err, ErrPluginNotFound)
+}
+
+func TestSchemaCache_KeyedByVersion(t *testing.T) {
+	cacheDir := t.TempDir()
+	s := NewServer(nil)
+	s.SetCacheDir(cacheDir)
+	require.NoError(t, s.saveCachedSchema(Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}, cachedTestSchema))
+	_, ok := s.loadCachedSchema(Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.38.0"})
+	assert.False(t, ok)
+	_, ok = s.loadCachedSchema(Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"})
+	assert.True(t, ok)
+}
+
+func TestSchemaCache_KeyedByProviderSourceAddress(t *testing.T) {
+	cacheDir := t.TempDir()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0", Hostname: "registry.terraform.io"}
+	s := NewServer(nil)
+	s.SetCacheDir(cacheDir)
+	require.NoError(t, s.saveCachedSchema(request, cachedTestSchema))
+	path, err := s.cachePath(request)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cacheDir, "registry.terraform.io", "hashicorp", "azurerm", "4.37.0", "schema.json"), path)
+
+	// The same provider served by another registry or mirror shares the entry.
+	s.SetRegistryURL("http://127.0.0.1:8080/v1/providers")
+	_, ok := s.loadCachedSchema(request)
+	assert.True(t, ok)
+	_, ok = s.loadCachedSchema(Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"})
+	assert.True(t, ok)
+
+	// A provider with the same namespace and name from another host doesn't.
+	other := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0", Hostname: "Example.com:8443"}
+	_, ok = s.loadCachedSchema(other)
+	assert.False(t, ok)
+	path, err = s.cachePath(other)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(cacheDir, "example.com_8443", "hashicorp", "azurerm", "4.37.0", "schema.json"), path)
+}
+
+func TestSchemaCache_InvalidRequestShouldBeRejected(t *testing.T) {
+	s := NewServer(nil)
+	s.SetCacheDir(t.TempDir())
+	err := s.saveCachedSchema(Request{Namespace: "..", Name: "azurerm", Version: "4.37.0"}, cachedTestSchema)
+	assert.Error(t, err)
+}
+
+func TestConfiguredServer_EmptySchemaCacheDirShouldDisableCache(t *testing.T) {
+	s := NewServer(nil)
+	s.SetCacheDir(t.TempDir())
+
+	configured, err := configuredServer(s, Options{})
+	require.NoError(t, err)
+	assert.Empty(t, configured.schemaCacheDir())
+	configured, err = configuredServer(s, Options{SchemaCacheDir: t.TempDir()})
+	require.NoError(t, err)
+	assert.NotEqual(t, s.schemaCacheDir(), configured.schemaCacheDir())
+}
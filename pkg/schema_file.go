@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/spf13/afero"
+)
+
+var _ SchemaGetter = &ProviderSchemasFile{}
+
+// ProviderSchemasFile is a SchemaGetter backed by the output of `terraform providers schema -json`,
+// no provider binary is downloaded nor executed.
+type ProviderSchemasFile struct {
+	path    string
+	schemas *tfjson.ProviderSchemas
+}
+
+// LoadProviderSchemasFile reads and validates the `terraform providers schema -json` output at path.
+func LoadProviderSchemasFile(path string) (*ProviderSchemasFile, error) {
+	content, err := afero.ReadFile(Fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schemas file %s: %w", path, err)
+	}
+	schemas := &tfjson.ProviderSchemas{}
+	if err := json.Unmarshal(content, schemas); err != nil {
+		return nil, fmt.Errorf("failed to decode provider schemas file %s: %w", path, err)
+	}
+	return &ProviderSchemasFile{
+		path:    path,
+		schemas: schemas,
+	}, nil
+}
+
+// providerSchema finds the schema whose address ends with {namespace}/{name}, the version in the request is ignored
+// since the file contains the versions selected by `terraform init`.
+func (f *ProviderSchemasFile) providerSchema(request Request) (*tfjson.ProviderSchema, error) {
+	var addresses []string
+	for address := range f.schemas.Schemas {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		parts := strings.Split(address, "/")
+		if len(parts) < 2 {
+			continue
+		}
+		namespace, name := parts[len(parts)-2], parts[len(parts)-1]
+		if strings.EqualFold(namespace, request.Namespace) && name == request.Name {
+			return f.schemas.Schemas[address], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s/%s in provider schemas file %s", ErrPluginNotFound, request.Namespace, request.Name, f.path)
+}
+
+// GetResourceSchema retrieves the schema for a specific resource from the file.
+func (f *ProviderSchemasFile) GetResourceSchema(request Request, resource string) (*tfjson.Schema, error) {
+	ps, err := f.providerSchema(request)
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := ps.ResourceSchemas[resource]
+	if !ok {
+		return nil, fmt.Errorf("resource schema not found: %s", resource)
+	}
+	return schema, nil
+}
+
+// GetDataSourceSchema retrieves the schema for a specific data source from the file.
+func (f *ProviderSchemasFile) GetDataSourceSchema(request Request, dataSource string) (*tfjson.Schema, error) {
+	ps, err := f.providerSchema(request)
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := ps.DataSourceSchemas[dataSource]
+	if !ok {
+		return nil, fmt.Errorf("data source schema not found: %s", dataSource)
+	}
+	return schema, nil
+}
+
+// GetEphemeralResourceSchema retrieves the schema for a specific ephemeral resource from the file.
+func (f *ProviderSchemasFile) GetEphemeralResourceSchema(request Request, ephemeralResource string) (*tfjson.Schema, error) {
+	ps, err := f.providerSchema(request)
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := ps.EphemeralResourceSchemas[ephemeralResource]
+	if !ok {
+		return nil, fmt.Errorf("ephemeral resource schema not found: %s", ephemeralResource)
+	}
+	return schema, nil
+}
+
+// GetResourceIdentitySchema retrieves the identity schema for a specific managed resource from the file, nil is returned if the resource has none.
+func (f *ProviderSchemasFile) GetResourceIdentitySchema(request Request, resource string) (*tfjson.IdentitySchema, error) {
+	ps, err := f.providerSchema(request)
+	if err != nil {
+		return nil, err
+	}
+	return ps.ResourceIdentitySchemas[resource], nil
+}
+
+// GetListResourceSchema retrieves the schema for a specific list resource from the file.
+func (f *ProviderSchemasFile) GetListResourceSchema(request Request, listResource string) (*tfjson.Schema, error) {
+	ps, err := f.providerSchema(request)
+	if err != nil {
+		return nil, err
+	}
+	return listResourceSchema(ps, listResource)
+}
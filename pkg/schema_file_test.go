@@ -0,0 +1,102 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const providerSchemasJson = `{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/azure/azapi": {
+      "resource_schemas": {
+        "azapi_resource": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "type": {"type": "string", "required": true},
+              "body": {"type": "dynamic", "optional": true}
+            }
+          }
+        }
+      }
+    },
+    "registry.terraform.io/hashicorp/azurerm": {
+      "resource_schemas": {
+        "azurerm_resource_group": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "name": {"type": "string", "required": true},
+              "location": {"type": "string", "required": true},
+              "tags": {"type": ["map", "string"], "optional": true}
+            }
+          }
+        }
+      },
+      "data_source_schemas": {
+        "azurerm_client_config": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "tenant_id": {"type": "string", "computed": true}
+            }
+          }
+        }
+      },
+      "ephemeral_resource_schemas": {
+        "azurerm_key_vault_secret": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "name": {"type": "string", "required": true}
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func TestProviderSchemasFile_Lookup(t *testing.T) {
+	stub := gostub.Stub(&pkg.Fs, fakeFs(map[string]string{
+		"schemas.json": providerSchemasJson,
+	}))
+	defer stub.Reset()
+
+	sut, err := pkg.LoadProviderSchemasFile("schemas.json")
+	require.NoError(t, err)
+	azurerm := pkg.Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	resource, err := sut.GetResourceSchema(azurerm, "azurerm_resource_group")
+	require.NoError(t, err)
+	assert.True(t, resource.Block.Attributes["name"].Required)
+	dataSource, err := sut.GetDataSourceSchema(azurerm, "azurerm_client_config")
+	require.NoError(t, err)
+	assert.True(t, dataSource.Block.Attributes["tenant_id"].Computed)
+	ephemeral, err := sut.GetEphemeralResourceSchema(azurerm, "azurerm_key_vault_secret")
+	require.NoError(t, err)
+	assert.True(t, ephemeral.Block.Attributes["name"].Required)
+
+	azapi, err := sut.GetResourceSchema(pkg.Request{Namespace: "Azure", Name: "azapi"}, "azapi_resource")
+	require.NoError(t, err)
+	assert.True(t, azapi.Block.Attributes["type"].Required)
+
+	_, err = sut.GetResourceSchema(azurerm, "azurerm_virtual_network")
+	assert.Error(t, err)
+	_, err = sut.GetResourceSchema(pkg.Request{Namespace: "hashicorp", Name: "aws"}, "aws_instance")
+	assert.ErrorIs(t, err, pkg.ErrPluginNotFound)
+}
+
+func TestProviderSchemasFile_InvalidFormatVersion(t *testing.T) {
+	stub := gostub.Stub(&pkg.Fs, fakeFs(map[string]string{
+		"schemas.json": `{"format_version": "9.0", "provider_schemas": {}}`,
+	}))
+	defer stub.Reset()
+
+	_, err := pkg.LoadProviderSchemasFile("schemas.json")
+	assert.Error(t, err)
+}
@@ -644,3 +644,68 @@ func safeInt64ToUint64(val int64) (uint64, error) {
 	// 2. If non-negative, the cast is safe.
 	return uint64(val), nil
 }
+
+// convertV6IdentitySchemasToTFJSON converts a tfplugin6.GetResourceIdentitySchemas_Response to the identity schemas of tfjson.ProviderSchema
+func convertV6IdentitySchemasToTFJSON(resp *tfplugin6.GetResourceIdentitySchemas_Response) (map[string]*tfjson.IdentitySchema, error) {
+	identitySchemas := make(map[string]*tfjson.IdentitySchema)
+	for name, schema := range resp.GetIdentitySchemas() {
+		version, err := safeInt64ToUint64(schema.GetVersion())
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert identity schema version of %s: %w", name, err)
+		}
+		identitySchema := &tfjson.IdentitySchema{
+			Version:    version,
+			Attributes: make(map[string]*tfjson.IdentityAttribute),
+		}
+		for _, attr := range schema.GetIdentityAttributes() {
+			identityAttr, err := convertIdentityAttribute(attr.GetType(), attr.GetDescription(), attr.GetRequiredForImport(), attr.GetOptionalForImport())
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert identity attribute %s of %s: %w", attr.GetName(), name, err)
+			}
+			identitySchema.Attributes[attr.GetName()] = identityAttr
+		}
+		identitySchemas[name] = identitySchema
+	}
+	return identitySchemas, nil
+}
+
+// convertV5IdentitySchemasToTFJSON converts a tfplugin5.GetResourceIdentitySchemas_Response to the identity schemas of tfjson.ProviderSchema
+func convertV5IdentitySchemasToTFJSON(resp *tfplugin5.GetResourceIdentitySchemas_Response) (map[string]*tfjson.IdentitySchema, error) {
+	identitySchemas := make(map[string]*tfjson.IdentitySchema)
+	for name, schema := range resp.GetIdentitySchemas() {
+		version, err := safeInt64ToUint64(schema.GetVersion())
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert identity schema version of %s: %w", name, err)
+		}
+		identitySchema := &tfjson.IdentitySchema{
+			Version:    version,
+			Attributes: make(map[string]*tfjson.IdentityAttribute),
+		}
+		for _, attr := range schema.GetIdentityAttributes() {
+			identityAttr, err := convertIdentityAttribute(attr.GetType(), attr.GetDescription(), attr.GetRequiredForImport(), attr.GetOptionalForImport())
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert identity attribute %s of %s: %w", attr.GetName(), name, err)
+			}
+			identitySchema.Attributes[attr.GetName()] = identityAttr
+		}
+		identitySchemas[name] = identitySchema
+	}
+	return identitySchemas, nil
+}
+
+// convertIdentityAttribute builds a tfjson.IdentityAttribute, the V5 and V6 identity attributes share the same fields.
+func convertIdentityAttribute(attrType []byte, description string, requiredForImport, optionalForImport bool) (*tfjson.IdentityAttribute, error) {
+	identityAttr := &tfjson.IdentityAttribute{
+		Description:       description,
+		RequiredForImport: requiredForImport,
+		OptionalForImport: optionalForImport,
+	}
+	if attrType != nil {
+		t, err := ctyjson.UnmarshalType(attrType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal identity attribute type: %w", err)
+		}
+		identityAttr.IdentityType = t
+	}
+	return identityAttr, nil
+}
@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// The names of the schema sources, see Server.SetSchemaSources.
+const (
+	// SchemaSourceCache is the persistent schema cache, see Server.SetCacheDir.
+	SchemaSourceCache = "cache"
+	// SchemaSourceProviders is the `.terraform/providers` folder of the module being fixed.
+	SchemaSourceProviders = "providers"
+	// SchemaSourceMirror is the filesystem mirror folders, see Server.AddProviderDir.
+	SchemaSourceMirror = "mirror"
+	// SchemaSourceRegistry is the provider registry, see Server.SetRegistryURL.
+	SchemaSourceRegistry = "registry"
+)
+
+// DefaultSchemaSources is the order the schema sources are asked in unless Server.SetSchemaSources is called.
+var DefaultSchemaSources = []string{SchemaSourceCache, SchemaSourceProviders, SchemaSourceMirror, SchemaSourceRegistry}
+
+// schemaSource is a link of the schema resolution chain, Server asks its sources in order until one of them has the provider.
+type schemaSource interface {
+	// providerSchema returns the schema of the provider, an error wrapping ErrPluginNotFound passes the request to the next source.
+	providerSchema(request Request) (*tfjson.ProviderSchema, error)
+	String() string
+}
+
+// providerLocator is implemented by the sources serving provider binaries, the schema is read by launching the binary.
+type providerLocator interface {
+	fmt.Stringer
+	// locate records the path of the provider binary in the download cache, found is false if the source doesn't have it.
+	locate(request Request) (found bool, err error)
+}
+
+// SetSchemaSources sets the order the schema sources are asked in, sources not listed are never used,
+// e.g. `SetSchemaSources(SchemaSourceCache, SchemaSourceMirror)` never reads `.terraform/providers` nor the registry.
+// Calling it without names restores DefaultSchemaSources.
+func (s *Server) SetSchemaSources(names ...string) error {
+	for _, name := range names {
+		if !slices.Contains(DefaultSchemaSources, name) {
+			return fmt.Errorf("unknown schema source %q, valid sources are %s", name, strings.Join(DefaultSchemaSources, ", "))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sourceNames = slices.Clone(names)
+	return nil
+}
+
+// sources returns the schema sources in the configured order, every provider folder is a source of its own.
+func (s *Server) sources() []schemaSource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := s.sourceNames
+	if len(names) == 0 {
+		names = DefaultSchemaSources
+	}
+	var r []schemaSource
+	for _, name := range names {
+		switch name {
+		case SchemaSourceCache:
+			r = append(r, cacheSource{s: s})
+		case SchemaSourceProviders:
+			for _, dir := range s.initProviderDirs {
+				r = append(r, providerDirSource{s: s, name: name, dir: dir})
+			}
+		case SchemaSourceMirror:
+			for _, dir := range s.providerDirs {
+				r = append(r, providerDirSource{s: s, name: name, dir: dir})
+			}
+		case SchemaSourceRegistry:
+			r = append(r, registrySource{s: s})
+		}
+	}
+	return r
+}
+
+// resolveSchema asks the sources in order, the schema found by a provider binary is saved into the persistent cache
+// if the cache is one of the sources.
+func (s *Server) resolveSchema(request Request) (*tfjson.ProviderSchema, error) {
+	sources := s.sources()
+	var tried []string
+	for _, src := range sources {
+		schema, err := src.providerSchema(request)
+		if errors.Is(err, ErrPluginNotFound) {
+			tried = append(tried, src.String())
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, fromCache := src.(cacheSource); !fromCache && slices.ContainsFunc(sources, isCacheSource) {
+			if err := s.saveCachedSchema(request, schema); err != nil {
+				s.l.Warn("Failed to save schema cache", "error", err)
+			}
+		}
+		return schema, nil
+	}
+	return nil, s.notFound(request, tried)
+}
+
+func isCacheSource(src schemaSource) bool {
+	_, ok := src.(cacheSource)
+	return ok
+}
+
+// notFound returns the error of a provider none of the sources has.
+func (s *Server) notFound(request Request, tried []string) error {
+	if s.Offline() {
+		return fmt.Errorf("%w: %s/%s %s is not available in schema sources %v and network access is disabled", ErrPluginNotFound, request.Namespace, request.Name, request.Version, tried)
+	}
+	return fmt.Errorf("%w: %s/%s %s is not available in schema sources %v", ErrPluginNotFound, request.Namespace, request.Name, request.Version, tried)
+}
+
+// cacheSource reads the schemas persisted by earlier runs.
+type cacheSource struct {
+	s *Server
+}
+
+func (c cacheSource) providerSchema(request Request) (*tfjson.ProviderSchema, error) {
+	schema, ok := c.s.loadCachedSchema(request)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s %s is not in the schema cache", ErrPluginNotFound, request.Namespace, request.Name, request.Version)
+	}
+	return schema, nil
+}
+
+func (c cacheSource) String() string {
+	return SchemaSourceCache
+}
+
+// providerDirSource finds provider binaries in a local folder, like `.terraform/providers` or a filesystem mirror.
+type providerDirSource struct {
+	s    *Server
+	name string
+	dir  string
+}
+
+func (p providerDirSource) providerSchema(request Request) (*tfjson.ProviderSchema, error) {
+	return p.s.locatedSchema(request, p)
+}
+
+func (p providerDirSource) locate(request Request) (bool, error) {
+	return p.s.getLocal(p.dir, request)
+}
+
+func (p providerDirSource) String() string {
+	return p.name + " " + p.dir
+}
+
+// registrySource downloads provider binaries from the registry, it's skipped in offline mode.
+type registrySource struct {
+	s *Server
+}
+
+func (r registrySource) providerSchema(request Request) (*tfjson.ProviderSchema, error) {
+	return r.s.locatedSchema(request, r)
+}
+
+func (r registrySource) locate(request Request) (bool, error) {
+	if r.s.Offline() {
+		return false, nil
+	}
+	err := r.s.download(request)
+	if errors.Is(err, ErrPluginNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r registrySource) String() string {
+	return SchemaSourceRegistry + " " + r.s.registryURL()
+}
+
+// locatedSchema reads the schema from the provider binary the locator finds.
+func (s *Server) locatedSchema(request Request, locator providerLocator) (*tfjson.ProviderSchema, error) {
+	found, err := s.locate(request, locator)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrPluginNotFound
+	}
+	return s.pluginSchema(request)
+}
+
+// locate runs the locator unless the provider binary is known already, concurrent calls for the same request and locator
+// share one download.
+func (s *Server) locate(request Request, locator providerLocator) (bool, error) {
+	if _, exists := s.providerPath(request); exists {
+		return true, nil
+	}
+	v, err, shared := s.state.downloads.Do(s.providerKey(request).key()+" "+locator.String(), func() (any, error) {
+		// The download might have finished between the check above and this call.
+		if _, exists := s.providerPath(request); exists {
+			return true, nil
+		}
+		return locator.locate(request)
+	})
+	if shared {
+		s.l.Debug("Download shared with a concurrent request", "request", request)
+	}
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// standInRegistry serves the versions and download API of the providers in the requests, like an Artifactory remote repository would.
+type standInRegistry struct {
+	*httptest.Server
+	hits atomic.Int32
+	mu   sync.Mutex
+	// shasums are the checksums reported for the zip archives, keyed by file name.
+	shasums map[string]string
+}
+
+func (r *standInRegistry) setShasum(zipName, shasum string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shasums[zipName] = shasum
+}
+
+func (r *standInRegistry) shasum(zipName string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.shasums[zipName]
+}
+
+func newStandInRegistry(t *testing.T, requests ...Request) *standInRegistry {
+	zipDir := t.TempDir()
+	mux := http.NewServeMux()
+	r := &standInRegistry{shasums: make(map[string]string)}
+	versions := make(map[string][]map[string]string)
+	for _, request := range requests {
+		versionsPath := fmt.Sprintf("/v1/providers/%s/%s/versions", request.Namespace, request.Name)
+		versions[versionsPath] = append(versions[versionsPath], map[string]string{"version": request.Version})
+		zipName := providerZipName(request)
+		writeProviderZip(t, filepath.Join(zipDir, zipName), fmt.Sprintf("terraform-provider-%s_v%s_x5", request.Name, request.Version))
+		sum, err := fileSha256(filepath.Join(zipDir, zipName))
+		require.NoError(t, err)
+		r.shasums[zipName] = sum
+		apiPath := fmt.Sprintf("/v1/providers/%s/%s/%s/download/%s/%s", request.Namespace, request.Name, request.Version, runtime.GOOS, runtime.GOARCH)
+		mux.HandleFunc(apiPath, func(w http.ResponseWriter, _ *http.Request) {
+			r.hits.Add(1)
+			_ = json.NewEncoder(w).Encode(pluginApiResponse{
+				OS:          runtime.GOOS,
+				Arch:        runtime.GOARCH,
+				FileName:    zipName,
+				DownloadURL: r.URL + "/files/" + zipName,
+				Shasum:      r.shasum(zipName),
+			})
+		})
+	}
+	for versionsPath, list := range versions {
+		mux.HandleFunc(versionsPath, func(w http.ResponseWriter, _ *http.Request) {
+			_ = json.NewEncoder(w).Encode(map[string]any{"versions": list})
+		})
+	}
+	mux.Handle("/files/", http.StripPrefix("/files/", http.FileServer(http.Dir(zipDir))))
+	r.Server = httptest.NewServer(mux)
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestVersionOrLatest_ShouldQueryConfiguredRegistry(t *testing.T) {
+	registry := newStandInRegistry(t,
+		Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"},
+		Request{Namespace: "hashicorp", Name: "random", Version: "3.10.0"},
+		Request{Namespace: "hashicorp", Name: "random", Version: "3.11.0-beta1"},
+	)
+	s := NewServer(nil)
+	s.SetRegistryURL(registry.URL + "/v1/providers")
+
+	version, err := versionOrLatest(s, "hashicorp", "random", "")
+	require.NoError(t, err)
+	assert.Equal(t, "3.10.0", version)
+	_, err = versionOrLatest(s, "hashicorp", "azurerm", "")
+	assert.ErrorContains(t, err, "registry API returned status 404 for provider hashicorp/azurerm")
+}
+
+func providerZipName(request Request) string {
+	return fmt.Sprintf("terraform-provider-%s_%s_%s.zip", request.Name, request.Version, testPlatform)
+}
+
+func writeLocalProvider(t *testing.T, dir string, request Request) string {
+	binaryDir := filepath.Join(dir, "registry.terraform.io", request.Namespace, request.Name, request.Version, testPlatform)
+	require.NoError(t, os.MkdirAll(binaryDir, 0750))
+	binary := filepath.Join(binaryDir, "terraform-provider-"+request.Name+"_v"+request.Version)
+	require.NoError(t, os.WriteFile(binary, []byte("binary"), 0600))
+	return binary
+}
+
+func TestServerGet_ShouldDownloadFromConfiguredRegistry(t *testing.T) {
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	registry := newStandInRegistry(t, request)
+
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetRegistryURL(registry.URL + "/v1/providers")
+	s.SetAllowUnlockedProviders(true)
+	require.NoError(t, s.Get(request))
+	assert.Equal(t, "terraform-provider-random_v3.6.0_x5", filepath.Base(s.state.dlc[s.providerKey(request)]))
+	assert.Equal(t, int32(1), registry.hits.Load())
+
+	err := s.Get(Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"})
+	require.ErrorIs(t, err, ErrPluginNotFound)
+	assert.Contains(t, err.Error(), "registry "+registry.URL+"/v1/providers")
+}
+
+func TestServerGet_ShouldAskSchemaSourcesInOrder(t *testing.T) {
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	initDir := t.TempDir()
+	initBinary := writeLocalProvider(t, initDir, request)
+	mirrorDir := t.TempDir()
+	mirrorBinary := writeLocalProvider(t, mirrorDir, request)
+	registry := newStandInRegistry(t, request)
+
+	cases := []struct {
+		desc     string
+		sources  []string
+		expected string
+	}{
+		{
+			desc:     "default",
+			expected: initBinary,
+		},
+		{
+			desc:     "mirror first",
+			sources:  []string{SchemaSourceMirror, SchemaSourceProviders},
+			expected: mirrorBinary,
+		},
+		{
+			desc:     "registry only",
+			sources:  []string{SchemaSourceRegistry},
+			expected: "terraform-provider-random_v3.6.0_x5",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			s := NewServer(nil)
+			defer s.Cleanup()
+			s.SetRegistryURL(registry.URL + "/v1/providers")
+			s.SetAllowUnlockedProviders(true)
+			s.addInitProviderDir(initDir)
+			s.AddProviderDir(mirrorDir)
+			require.NoError(t, s.SetSchemaSources(c.sources...))
+			require.NoError(t, s.Get(request))
+			path := s.state.dlc[s.providerKey(request)]
+			if filepath.IsAbs(c.expected) {
+				assert.Equal(t, c.expected, path)
+				return
+			}
+			assert.Equal(t, c.expected, filepath.Base(path))
+		})
+	}
+}
+
+func TestServerGet_ExcludedSourcesShouldNotBeUsed(t *testing.T) {
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	registry := newStandInRegistry(t, request)
+	mirrorDir := t.TempDir()
+	writeLocalProvider(t, mirrorDir, Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"})
+
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetRegistryURL(registry.URL + "/v1/providers")
+	s.AddProviderDir(mirrorDir)
+	require.NoError(t, s.SetSchemaSources(SchemaSourceCache, SchemaSourceMirror))
+	err := s.Get(request)
+	require.ErrorIs(t, err, ErrPluginNotFound)
+	assert.Equal(t, int32(0), registry.hits.Load())
+}
+
+func TestServerLoadSchema_ShouldSaveSchemaFoundByBinaryIntoCache(t *testing.T) {
+	launcher := &fakePluginLauncher{}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	cacheDir := t.TempDir()
+	s := newLocalProviderServer(t, request)
+	defer s.Cleanup()
+	s.SetCacheDir(cacheDir)
+
+	_, err := s.GetProviderSchema(request)
+	require.NoError(t, err)
+	assert.Len(t, launcher.launches(), 1)
+	_, ok := s.loadCachedSchema(request)
+	assert.True(t, ok)
+
+	// The cache is the first source, a new Server doesn't launch the plugin.
+	fresh := newLocalProviderServer(t, request)
+	defer fresh.Cleanup()
+	fresh.SetCacheDir(cacheDir)
+	_, err = fresh.GetProviderSchema(request)
+	require.NoError(t, err)
+	assert.Len(t, launcher.launches(), 1)
+
+	// Without the cache in the chain, the plugin is launched and nothing is read from or written into the cache.
+	noCache := newLocalProviderServer(t, request)
+	defer noCache.Cleanup()
+	noCache.SetCacheDir(cacheDir)
+	require.NoError(t, noCache.SetSchemaSources(SchemaSourceMirror))
+	_, err = noCache.GetProviderSchema(request)
+	require.NoError(t, err)
+	assert.Len(t, launcher.launches(), 2)
+}
+
+func TestServerSetSchemaSources_UnknownSourceShouldFail(t *testing.T) {
+	s := NewServer(nil)
+	err := s.SetSchemaSources(SchemaSourceCache, "artifactory")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown schema source "artifactory"`)
+	assert.Empty(t, s.sourceNames)
+}
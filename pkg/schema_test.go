@@ -8,8 +8,15 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// newRegistryServer returns a Server downloading the providers from the registry, there is no lock file to verify them against.
+func newRegistryServer() *Server {
+	s := NewServer(nil)
+	s.SetAllowUnlockedProviders(true)
+	return s
+}
+
 func TestQueryBlockSchema_ResourceBlock(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	t.Run("azurerm_resource_group", func(t *testing.T) {
 		path := []string{"resource", "azurerm_resource_group"}
@@ -65,7 +72,7 @@ func TestQueryBlockSchema_ResourceBlock(t *testing.T) {
 }
 
 func TestQueryBlockSchema_DataBlock(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	t.Run("azurerm_resource_group", func(t *testing.T) {
 		path := []string{"data", "azurerm_resource_group"}
@@ -85,7 +92,7 @@ func TestQueryBlockSchema_DataBlock(t *testing.T) {
 }
 
 func TestQueryBlockSchema_EphemeralBlock(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 
 	path := []string{"ephemeral", "azurerm_key_vault_secret"}
@@ -102,7 +109,7 @@ func TestQueryBlockSchema_EphemeralBlock(t *testing.T) {
 }
 
 func TestQueryBlockSchema_NestedBlocks(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	t.Run("azurerm_container_group_container", func(t *testing.T) {
 		// Test nested block access - container block within azurerm_container_group
@@ -125,7 +132,7 @@ func TestQueryBlockSchema_NestedBlocks(t *testing.T) {
 }
 
 func TestQueryBlockSchema_InvalidInputs(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	t.Run("empty_path", func(t *testing.T) {
 		path := []string{}
@@ -153,7 +160,7 @@ func TestQueryBlockSchema_InvalidInputs(t *testing.T) {
 }
 
 func TestQueryBlockSchema_ProviderNamespaceHandling(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	t.Run("azapi_default_namespace", func(t *testing.T) {
 		path := []string{"resource", "azapi_resource"}
@@ -175,7 +182,7 @@ func TestQueryBlockSchema_ProviderNamespaceHandling(t *testing.T) {
 }
 
 func TestQueryBlockSchema_VersionHandling(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	t.Run("latest_version", func(t *testing.T) {
 		path := []string{"resource", "azurerm_resource_group"}
@@ -200,7 +207,7 @@ func TestQueryBlockSchema_VersionHandling(t *testing.T) {
 }
 
 func TestQueryBlockSchema_PostProcessors(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	testCases := []struct {
 		name      string
@@ -239,7 +246,7 @@ func TestQueryBlockSchema_Integration(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
 	}
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 
 	t.Run("multiple_providers", func(t *testing.T) {
@@ -274,7 +281,7 @@ func TestQueryBlockSchema_Integration(t *testing.T) {
 
 // Test helper functions used by queryBlockSchema
 func TestNameSpaceOrDefault(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	testCases := []struct {
 		name         string
@@ -299,7 +306,7 @@ func TestNameSpaceOrDefault(t *testing.T) {
 
 // Test that schema post-processors are registered correctly
 func TestSchemaPostProcessors(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	expectedPostProcessors := []string{
 		"azapi_resource",
@@ -318,7 +325,7 @@ func TestSchemaPostProcessors(t *testing.T) {
 
 // Test error handling with non-existent provider types
 func TestQueryBlockSchema_NonExistentProviderTypes(t *testing.T) {
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 	t.Run("non_existent_resource", func(t *testing.T) {
 		path := []string{"resource", "nonexistent_provider_resource"}
@@ -342,12 +349,12 @@ func TestGetLatestVersion(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping getLatestVersion test in short mode")
 	}
-	stub := gostub.Stub(&tfPluginServer, NewServer(nil))
+	stub := gostub.Stub(&tfPluginServer, newRegistryServer())
 	defer stub.Reset()
 
 	t.Run("valid_provider", func(t *testing.T) {
 		// Test with a known provider
-		version, err := getLatestVersion("hashicorp", "azurerm")
+		version, err := getLatestVersion(pluginApi, "hashicorp", "azurerm")
 
 		require.NoError(t, err)
 		assert.NotEmpty(t, version, "version should not be empty")
@@ -356,7 +363,7 @@ func TestGetLatestVersion(t *testing.T) {
 
 	t.Run("azure_provider", func(t *testing.T) {
 		// Test with Azure namespace
-		version, err := getLatestVersion("Azure", "azapi")
+		version, err := getLatestVersion(pluginApi, "Azure", "azapi")
 
 		require.NoError(t, err)
 		assert.NotEmpty(t, version, "version should not be empty")
@@ -364,7 +371,7 @@ func TestGetLatestVersion(t *testing.T) {
 
 	t.Run("invalid_provider", func(t *testing.T) {
 		// Test with non-existent provider
-		_, err := getLatestVersion("nonexistent", "invalid")
+		_, err := getLatestVersion(pluginApi, "nonexistent", "invalid")
 
 		assert.Error(t, err, "should return error for non-existent provider")
 		assert.Contains(t, err.Error(), "registry API returned status", "error should mention registry API status")
@@ -372,14 +379,14 @@ func TestGetLatestVersion(t *testing.T) {
 
 	t.Run("empty_namespace", func(t *testing.T) {
 		// Test with empty namespace
-		_, err := getLatestVersion("", "azurerm")
+		_, err := getLatestVersion(pluginApi, "", "azurerm")
 
 		assert.Error(t, err, "should return error for empty namespace")
 	})
 
 	t.Run("empty_provider_type", func(t *testing.T) {
 		// Test with empty provider type
-		_, err := getLatestVersion("hashicorp", "")
+		_, err := getLatestVersion(pluginApi, "hashicorp", "")
 
 		assert.Error(t, err, "should return error for empty provider type")
 	})
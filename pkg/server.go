@@ -2,18 +2,23 @@ package pkg
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
 
 	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -25,6 +30,10 @@ const (
 var (
 	ErrPluginNotFound = fmt.Errorf("plugin not found")
 	ErrPluginApi      = fmt.Errorf("plugin API error")
+	// ErrChecksumMismatch means a provider package doesn't match its checksum, the plugin is never launched.
+	ErrChecksumMismatch = fmt.Errorf("provider checksum mismatch")
+	// ErrProviderNotLocked means a provider has no hashes in `.terraform.lock.hcl` to verify its download against.
+	ErrProviderNotLocked = fmt.Errorf("provider not locked")
 )
 
 // ContextKey is a type used to store the server instance in the context.
@@ -37,14 +46,21 @@ type Request struct {
 	Namespace string // Namespace of the provider (e.g., "Azure")
 	Name      string // Name of the provider (e.g., "azapi")
 	Version   string // Version of the provider (e.g., "2.5.0")
+	// Hostname is the hostname of the provider's source address, empty means registry.terraform.io.
+	Hostname string
 }
 
 // String returns a string representation of the Request in the format:
 // "https://registry.opentofu.org/v1/providers/{namespace}/{name}/{version}/download/{os}/{arch}"
 // This format is used to construct the URL for downloading the plugin.
 func (r Request) String() string {
+	return r.downloadURL(pluginApi)
+}
+
+// downloadURL returns the download API URL of the Request under the registry base URL, see Server.SetRegistryURL.
+func (r Request) downloadURL(registryURL string) string {
 	sb := strings.Builder{}
-	sb.WriteString(pluginApi)
+	sb.WriteString(strings.TrimSuffix(registryURL, string(urlPathSeparator)))
 	sb.WriteRune(urlPathSeparator)
 	sb.WriteString(r.Namespace)
 	sb.WriteRune(urlPathSeparator)
@@ -62,23 +78,67 @@ func (r Request) String() string {
 	return result
 }
 
+// key identifies the request in the singleflight group.
+func (r Request) key() string {
+	return r.hostname() + "/" + r.Namespace + "/" + r.Name + "/" + r.Version
+}
+
+// hostname returns the lower-cased hostname of the provider's source address.
+func (r Request) hostname() string {
+	if r.Hostname == "" {
+		return defaultProviderHostname
+	}
+	return strings.ToLower(r.Hostname)
+}
+
 type pluginApiResponse struct {
 	Protocols   []string `json:"protocols"`
 	OS          string   `json:"os"`
 	Arch        string   `json:"arch"`
 	FileName    string   `json:"filename"`
 	DownloadURL string   `json:"download_url"`
+	Shasum      string   `json:"shasum"`
 }
 
-type downloadCache map[Request]string
-type schemaCache map[Request]*tfjson.ProviderSchema
+type downloadCache map[providerKey]string
+type schemaCache map[providerKey]*tfjson.ProviderSchema
 
 // Server is a struct that manages the plugin download and caching process.
+// It's safe for concurrent use, concurrent calls for the same Request share one download and one plugin launch.
 type Server struct {
+	// mu guards the configuration fields below it.
+	mu           sync.RWMutex
+	providerDirs []string
+	// initProviderDirs are the `.terraform/providers` folders of the modules being fixed.
+	initProviderDirs []string
+	// sourceNames is the order of the schema sources, DefaultSchemaSources if empty.
+	sourceNames []string
+	// registry is the base URL of the provider registry download API, pluginApi if empty.
+	registry string
+	// hashes are the provider hashes locked in `.terraform.lock.hcl`, keyed by the request with a lower case namespace.
+	hashes map[Request][]string
+	// allowUnlocked allows downloading providers without hashes, see SetAllowUnlockedProviders.
+	allowUnlocked bool
+	offline       bool
+	cacheDir      string
+	l             *slog.Logger
+	// state holds the downloads, schemas and plugins, it's shared with the Servers forked from this one.
+	state *serverState
+}
+
+// serverState holds the downloads, schemas and running plugins shared by a Server and its forks.
+type serverState struct {
+	// mu guards the fields below it.
+	mu     sync.RWMutex
 	tmpDir string
 	dlc    downloadCache
 	sc     schemaCache
-	l      *slog.Logger
+	// plugins are the running provider processes keyed by the binary path, they're reused by all schema queries until Cleanup.
+	plugins map[string]universalProvider
+	// downloads, launches and schemas collapse duplicate Get, plugin and providerSchema calls in flight.
+	downloads singleflight.Group
+	launches  singleflight.Group
+	schemas   singleflight.Group
 }
 
 // NewServer creates a new Server instance with an optional logger.
@@ -92,31 +152,193 @@ func NewServer(l *slog.Logger) *Server {
 	}
 	l.Info("Creating new server instance")
 	return &Server{
+		l:     l,
+		state: newServerState(),
+	}
+}
+
+func newServerState() *serverState {
+	return &serverState{
 		dlc: make(downloadCache),
 		sc:  make(schemaCache),
-		l:   l,
 	}
 }
 
-// Cleanup removes the temporary directory used for plugin downloads.
+// fork returns a Server with a copy of the configuration of s, sharing the downloads, schemas and plugins of s.
+// Every Run and every folder configures a fork of its own, so concurrent Runs never change each other's settings
+// while a provider is still downloaded and launched only once.
+func (s *Server) fork() *Server {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hashes := make(map[Request][]string, len(s.hashes))
+	for key, h := range s.hashes {
+		hashes[key] = slices.Clone(h)
+	}
+	return &Server{
+		providerDirs:     slices.Clone(s.providerDirs),
+		initProviderDirs: slices.Clone(s.initProviderDirs),
+		sourceNames:      slices.Clone(s.sourceNames),
+		registry:         s.registry,
+		hashes:           hashes,
+		allowUnlocked:    s.allowUnlocked,
+		offline:          s.offline,
+		cacheDir:         s.cacheDir,
+		l:                s.l,
+		state:            s.state,
+	}
+}
+
+// isolated returns a fork of s with downloads, schemas and plugins of its own, its Cleanup never stops the plugins of s.
+func (s *Server) isolated() *Server {
+	r := s.fork()
+	r.state = newServerState()
+	return r
+}
+
+// Cleanup stops the provider plugin processes and removes the temporary directory used for plugin downloads.
+// The Server could still be used afterwards, plugins are launched again on demand.
 func (s *Server) Cleanup() {
-	s.l.Info("Cleaning up temporary directory", "dir", s.tmpDir)
-	_ = os.RemoveAll(s.tmpDir)
+	st := s.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s.closeAllPlugins()
+	if st.tmpDir == "" {
+		return
+	}
+	s.l.Info("Cleaning up temporary directory", "dir", st.tmpDir)
+	_ = os.RemoveAll(st.tmpDir)
+	// The providers extracted into the temporary directory are gone.
+	for key, path := range st.dlc {
+		if strings.HasPrefix(path, st.tmpDir+string(filepath.Separator)) {
+			delete(st.dlc, key)
+		}
+	}
+	st.tmpDir = ""
+}
+
+// AddProviderDir adds a filesystem mirror folder that is searched for provider binaries before the registry.
+// Both the unpacked layout used by `.terraform/providers` and the packed layout of `terraform providers mirror` are supported:
+// {dir}/{hostname}/{namespace}/{name}/{version}/{os}_{arch}/terraform-provider-{name}_*
+// {dir}/{hostname}/{namespace}/{name}/terraform-provider-{name}_{version}_{os}_{arch}.zip
+func (s *Server) AddProviderDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.Contains(s.providerDirs, dir) {
+		return
+	}
+	s.l.Info("Adding local provider directory", "dir", dir)
+	s.providerDirs = append(s.providerDirs, dir)
+}
+
+// addInitProviderDir adds the `.terraform/providers` folder of a module, it's searched before the filesystem mirrors.
+func (s *Server) addInitProviderDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.Contains(s.initProviderDirs, dir) {
+		return
+	}
+	s.l.Info("Adding initialized provider directory", "dir", dir)
+	s.initProviderDirs = append(s.initProviderDirs, dir)
+}
+
+// SetRegistryURL sets the base URL of the provider registry download API, e.g. an Artifactory remote repository
+// proxying the registry. The default is "https://registry.opentofu.org/v1/providers", an empty url restores it.
+func (s *Server) SetRegistryURL(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registry = url
+}
+
+func (s *Server) registryURL() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.registry == "" {
+		return pluginApi
+	}
+	return s.registry
+}
+
+// SetOffline disables all network calls, providers must be resolved from the local provider directories.
+func (s *Server) SetOffline(offline bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offline = offline
+}
+
+// Offline reports whether network calls are disabled.
+func (s *Server) Offline() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.offline
+}
+
+func (s *Server) providerPath(request Request) (string, bool) {
+	key := s.providerKey(request)
+	s.state.mu.RLock()
+	defer s.state.mu.RUnlock()
+	path, ok := s.state.dlc[key]
+	return path, ok
+}
+
+func (s *Server) setProviderPath(request Request, path string) {
+	key := s.providerKey(request)
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	s.state.dlc[key] = path
+}
+
+func (s *Server) cachedProviderSchema(request Request) (*tfjson.ProviderSchema, bool) {
+	key := s.providerKey(request)
+	s.state.mu.RLock()
+	defer s.state.mu.RUnlock()
+	schema, ok := s.state.sc[key]
+	return schema, ok
+}
+
+func (s *Server) setProviderSchema(request Request, schema *tfjson.ProviderSchema) {
+	key := s.providerKey(request)
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	s.state.sc[key] = schema
 }
 
 // Get retrieves the plugin for the specified request, downloading it if necessary.
 // The GetXxx methods (GetResourceSchema, GetDataSourceSchema, etc.) will call this method anyway,
 // so it is not necessary to call Get directly unless you want to ensure the plugin is downloaded first.
-// It is stored in a temporary directory and cached for future use.
-// Make sure to call Cleanup() to remove the temporary files.
+// The schema sources serving provider binaries are asked in order, see SetSchemaSources.
+// A downloaded plugin is stored in a temporary directory and cached for future use.
+// Make sure to call Cleanup() to stop the plugins and remove the temporary files.
 func (s *Server) Get(request Request) error {
-	l := s.l.With("request_namespace", request.Namespace, "request_name", request.Name, "request_version", request.Version)
-	if _, exists := s.dlc[request]; exists {
-		l.Info("Request already exists in download cache")
+	if _, exists := s.providerPath(request); exists {
+		s.l.Info("Request already exists in download cache", "request", request)
 		return nil // Request already exists, no need to add again
 	}
+	var tried []string
+	for _, src := range s.sources() {
+		locator, ok := src.(providerLocator)
+		if !ok {
+			continue
+		}
+		found, err := s.locate(request, locator)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+		tried = append(tried, src.String())
+	}
+	return s.notFound(request, tried)
+}
 
-	registryApiRequest, err := http.NewRequest(http.MethodGet, request.String(), nil)
+// download fetches the plugin from the registry, it's called by the registry schema source only.
+func (s *Server) download(request Request) error {
+	l := s.l.With("request_namespace", request.Namespace, "request_name", request.Name, "request_version", request.Version)
+	if len(s.providerHashes(request)) == 0 && !s.allowUnlockedProviders() {
+		return fmt.Errorf("%w: %s/%s %s has no hashes in .terraform.lock.hcl to verify the download against", ErrProviderNotLocked, request.Namespace, request.Name, request.Version)
+	}
+	apiURL := request.downloadURL(s.registryURL())
+	registryApiRequest, err := http.NewRequest(http.MethodGet, apiURL, nil)
 	if registryApiRequest != nil {
 		l.Debug("Sending request to registry API", "url", registryApiRequest.URL.String())
 	}
@@ -133,11 +355,11 @@ func (s *Server) Get(request Request) error {
 	}()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("%w: %s", ErrPluginNotFound, request.String())
+		return fmt.Errorf("%w: %s", ErrPluginNotFound, apiURL)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%w: %s => %d", ErrPluginApi, request.String(), resp.StatusCode)
+		return fmt.Errorf("%w: %s => %d", ErrPluginApi, apiURL, resp.StatusCode)
 	}
 
 	var pluginResponse pluginApiResponse
@@ -147,17 +369,18 @@ func (s *Server) Get(request Request) error {
 
 	l.Info("Plugin API response received", "arch", pluginResponse.Arch, "os", pluginResponse.OS, "filename", pluginResponse.FileName, "download_url", pluginResponse.DownloadURL)
 
-	if s.tmpDir == "" {
-		tmpFile, err := os.MkdirTemp("", "tfpluginschema-")
-		if err != nil {
-			return fmt.Errorf("failed to create temporary directory: %w", err)
-		}
-		s.tmpDir = tmpFile
+	tmpDir, err := s.ensureTmpDir()
+	if err != nil {
+		return err
 	}
 
 	downloadURL := pluginResponse.DownloadURL
 	if downloadURL == "" {
-		return fmt.Errorf("download URL is empty for request: %s", request.String())
+		return fmt.Errorf("download URL is empty for request: %s", apiURL)
+	}
+	// An archive without a checksum could never be verified.
+	if pluginResponse.Shasum == "" {
+		return fmt.Errorf("%w: the registry reports no shasum for request: %s", ErrChecksumMismatch, apiURL)
 	}
 
 	downloadRequest, err := http.NewRequest(http.MethodGet, downloadURL, nil)
@@ -178,7 +401,7 @@ func (s *Server) Get(request Request) error {
 		return fmt.Errorf("failed to download plugin: %s => %d", downloadURL, resp.StatusCode)
 	}
 
-	pluginFilePath := filepath.Join(s.tmpDir, pluginResponse.FileName)
+	pluginFilePath := filepath.Join(tmpDir, pluginResponse.FileName)
 
 	file, err := os.Create(filepath.Clean(pluginFilePath))
 	if err != nil {
@@ -193,9 +416,38 @@ func (s *Server) Get(request Request) error {
 		return fmt.Errorf("failed to read plugin data into file: %w", err)
 	}
 
-	// unzip the file
-	extractDir := strings.TrimSuffix(pluginResponse.FileName, filepath.Ext(pluginResponse.FileName)) // Remove extension for directory name
-	extractDir = filepath.Join(s.tmpDir, extractDir)
+	// The archive is closed before it's verified, so a mismatched one could be removed on Windows too.
+	_ = file.Close()
+	if err := s.verifyArchive(request, pluginFilePath, pluginResponse.Shasum); err != nil {
+		_ = os.Remove(pluginFilePath)
+		return err
+	}
+
+	return s.extract(request, tmpDir, pluginFilePath)
+}
+
+// ensureTmpDir creates the temporary directory once and returns it.
+func (s *Server) ensureTmpDir() (string, error) {
+	st := s.state
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.tmpDir != "" {
+		return st.tmpDir, nil
+	}
+	tmpFile, err := os.MkdirTemp("", "tfpluginschema-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	st.tmpDir = tmpFile
+	return tmpFile, nil
+}
+
+// extract unzips the provider archive into the temporary directory and records the provider binary in the download cache.
+func (s *Server) extract(request Request, tmpDir, pluginFilePath string) error {
+	l := s.l.With("request_namespace", request.Namespace, "request_name", request.Name, "request_version", request.Version)
+	fileName := filepath.Base(pluginFilePath)
+	extractDir := strings.TrimSuffix(fileName, filepath.Ext(fileName)) // Remove extension for directory name
+	extractDir = filepath.Join(tmpDir, extractDir)
 
 	if err := os.Mkdir(extractDir, 0750); err != nil {
 		return fmt.Errorf("failed to create extraction directory: %w", err)
@@ -205,60 +457,52 @@ func (s *Server) Get(request Request) error {
 		return fmt.Errorf("failed to unzip plugin file: %w", err)
 	}
 
-	// check the extracted directory
-	wantProviderFileName := fmt.Sprintf("%s%s", providerFileNamePrefix, request.Name)
-	if err = fs.WalkDir(os.DirFS(extractDir), ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return fmt.Errorf("error walking extracted directory (%s): %w", extractDir, err)
-		}
-
-		l.Debug("Checking extracted file", "path", path, "is_dir", d.IsDir(), "name", d.Name())
-
-		if d.IsDir() && d.Name() != "." {
-			return fs.SkipDir
-		}
-
-		if !strings.HasPrefix(d.Name(), wantProviderFileName) {
-			return nil
-		}
-
-		l.Info("Found provider file", "provider_file_name", d.Name())
-
-		s.dlc[request] = filepath.Join(extractDir, path)
-		return fs.SkipAll
-	}); err != nil {
+	providerPath, err := findProviderBinary(extractDir, request.Name)
+	if err != nil {
 		return fmt.Errorf("error checking extracted files: %w", err)
 	}
-
-	if _, exists := s.dlc[request]; !exists {
+	if providerPath == "" {
 		return fmt.Errorf("provider file not found in extracted directory (%s) for request: %s", extractDir, request.String())
 	}
-
+	l.Info("Found provider file", "provider_file_name", filepath.Base(providerPath))
+	s.setProviderPath(request, providerPath)
 	return nil
 }
 
-// getSchema creates a universal provider client for the given request
-func (s *Server) getSchema(request Request) ([]byte, error) {
-	if resp, exists := s.sc[request]; exists {
-		return json.Marshal(resp)
+// providerSchema returns the schema of the provider, concurrent calls for the same request share one plugin launch.
+func (s *Server) providerSchema(request Request) (*tfjson.ProviderSchema, error) {
+	if schema, exists := s.cachedProviderSchema(request); exists {
+		return schema, nil
 	}
-
-	// Ensure the provider is downloaded
-	if err := s.Get(request); err != nil {
-		return nil, fmt.Errorf("failed to download provider: %w", err)
+	v, err, _ := s.state.schemas.Do(s.providerKey(request).key(), func() (any, error) {
+		if schema, exists := s.cachedProviderSchema(request); exists {
+			return schema, nil
+		}
+		return s.loadSchema(request)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return v.(*tfjson.ProviderSchema), nil
+}
 
-	// Get the provider path
-	providerPath, exists := s.dlc[request]
-	if !exists {
-		return nil, fmt.Errorf("provider not found in cache: %s", request.String())
+// loadSchema resolves the schema through the schema sources and keeps it in memory.
+func (s *Server) loadSchema(request Request) (*tfjson.ProviderSchema, error) {
+	schema, err := s.resolveSchema(request)
+	if err != nil {
+		return nil, err
 	}
+	s.setProviderSchema(request, schema)
+	return schema, nil
+}
 
-	client, err := newGrpcClient(providerPath)
+// pluginSchema reads the schema from the running plugin of the provider, its binary must have been located.
+func (s *Server) pluginSchema(request Request) (*tfjson.ProviderSchema, error) {
+	// The plugin keeps running after the call, it's stopped by Cleanup.
+	client, err := s.plugin(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+		return nil, err
 	}
-	defer client.close()
 
 	var schemaResp *tfjson.ProviderSchema
 
@@ -268,31 +512,76 @@ func (s *Server) getSchema(request Request) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert V6 provider schema: %w", err)
 		}
+		schemaResp.ResourceIdentitySchemas = s.identitySchemas(request, func() (map[string]*tfjson.IdentitySchema, error) {
+			resp, err := client.v6IdentitySchemas()
+			if err != nil {
+				return nil, err
+			}
+			return convertV6IdentitySchemasToTFJSON(resp)
+		})
 	} else if resp, v5Err := client.v5Schema(); v5Err == nil {
 		// Fall back to V5 protocol
 		schemaResp, err = convertV5ResponseToProviderSchema(resp)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert V5 provider schema: %w", err)
 		}
+		schemaResp.ResourceIdentitySchemas = s.identitySchemas(request, func() (map[string]*tfjson.IdentitySchema, error) {
+			resp, err := client.v5IdentitySchemas()
+			if err != nil {
+				return nil, err
+			}
+			return convertV5IdentitySchemasToTFJSON(resp)
+		})
 	} else {
+		// The plugin might be broken, launch a new one next time.
+		if path, ok := s.providerPath(request); ok {
+			s.closePlugin(path)
+		}
 		return nil, fmt.Errorf("failed to get provider schema for either V5 or V6 protocols: v6 error: %v, v5 error: %v", v6Err, v5Err)
 	}
 
-	// Cache the schema response
-	s.sc[request] = schemaResp
+	return schemaResp, nil
+}
 
-	return json.MarshalIndent(schemaResp, "", "  ")
+// identitySchemas reads the resource identity schemas with get. Resource identity is optional, the schema is still usable
+// without them, so errors are logged only. Providers built before resource identity was introduced don't implement the call.
+func (s *Server) identitySchemas(request Request, get func() (map[string]*tfjson.IdentitySchema, error)) map[string]*tfjson.IdentitySchema {
+	schemas, err := get()
+	if status.Code(err) == codes.Unimplemented {
+		s.l.Info("Provider doesn't support resource identity", "request", request)
+		return nil
+	}
+	if err != nil {
+		s.l.Warn("Failed to read resource identity schemas", "request", request, "error", err)
+		return nil
+	}
+	return schemas
+}
+
+// Prefetch downloads the providers and reads their schemas in parallel, so the schemas are cached before they're queried
+// one by one. The errors of all requests are joined.
+func (s *Server) Prefetch(requests ...Request) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(requests))
+	for i, request := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.providerSchema(request); err != nil {
+				errs[i] = fmt.Errorf("%s/%s %s: %w", request.Namespace, request.Name, request.Version, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
 // GetResourceSchema retrieves the schema for a specific resource from the provider.
 func (s *Server) GetResourceSchema(request Request, resource string) (*tfjson.Schema, error) {
 	s.l.Info("Getting resource schema", "request", request, "resource", resource)
-	schemaResp, ok := s.sc[request]
-	if !ok {
-		if _, err := s.getSchema(request); err != nil {
-			return nil, fmt.Errorf("failed to read provider schema: %w", err)
-		}
-		schemaResp = s.sc[request]
+	schemaResp, err := s.providerSchema(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schema: %w", err)
 	}
 
 	schemaResource, ok := schemaResp.ResourceSchemas[resource]
@@ -305,12 +594,9 @@ func (s *Server) GetResourceSchema(request Request, resource string) (*tfjson.Sc
 // GetDataSourceSchema retrieves the schema for a specific data source from the provider.
 func (s *Server) GetDataSourceSchema(request Request, dataSource string) (*tfjson.Schema, error) {
 	s.l.Info("Getting data source schema", "request", request, "data_source", dataSource)
-	schemaResp, ok := s.sc[request]
-	if !ok {
-		if _, err := s.getSchema(request); err != nil {
-			return nil, fmt.Errorf("failed to read provider schema: %w", err)
-		}
-		schemaResp = s.sc[request]
+	schemaResp, err := s.providerSchema(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schema: %w", err)
 	}
 
 	schemaResource, ok := schemaResp.DataSourceSchemas[dataSource]
@@ -323,12 +609,9 @@ func (s *Server) GetDataSourceSchema(request Request, dataSource string) (*tfjso
 // GetFunctionSchema retrieves the schema for a specific function from the provider.
 func (s *Server) GetFunctionSchema(request Request, function string) (*tfjson.FunctionSignature, error) {
 	s.l.Info("Getting function schema", "request", request, "function", function)
-	schemaResp, ok := s.sc[request]
-	if !ok {
-		if _, err := s.getSchema(request); err != nil {
-			return nil, fmt.Errorf("failed to read provider schema: %w", err)
-		}
-		schemaResp = s.sc[request]
+	schemaResp, err := s.providerSchema(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schema: %w", err)
 	}
 
 	schemaFunction, ok := schemaResp.Functions[function]
@@ -342,12 +625,9 @@ func (s *Server) GetFunctionSchema(request Request, function string) (*tfjson.Fu
 // GetEphemeralResourceSchema retrieves the schema for a specific ephemeral resource from the provider.
 func (s *Server) GetEphemeralResourceSchema(request Request, ephemeralResource string) (*tfjson.Schema, error) {
 	s.l.Info("Getting ephemeral resource schema", "request", request, "ephemeral_resource", ephemeralResource)
-	schemaResp, ok := s.sc[request]
-	if !ok {
-		if _, err := s.getSchema(request); err != nil {
-			return nil, fmt.Errorf("failed to read provider schema: %w", err)
-		}
-		schemaResp = s.sc[request]
+	schemaResp, err := s.providerSchema(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schema: %w", err)
 	}
 
 	schemaResource, ok := schemaResp.EphemeralResourceSchemas[ephemeralResource]
@@ -358,15 +638,37 @@ func (s *Server) GetEphemeralResourceSchema(request Request, ephemeralResource s
 	return schemaResource, nil
 }
 
+// GetResourceIdentitySchema retrieves the identity schema for a specific managed resource from the provider.
+// Resource identity is optional, nil is returned if the resource has none.
+func (s *Server) GetResourceIdentitySchema(request Request, resource string) (*tfjson.IdentitySchema, error) {
+	s.l.Info("Getting resource identity schema", "request", request, "resource", resource)
+	schemaResp, err := s.providerSchema(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schema: %w", err)
+	}
+
+	return schemaResp.ResourceIdentitySchemas[resource], nil
+}
+
+// GetListResourceSchema retrieves the schema for a specific list resource from the provider. The plugin protocol
+// avmfix speaks has no list resource schemas yet, they're only known when the schema comes from the cache or a schema file,
+// nil is returned if the provider has no list resource schemas at all.
+func (s *Server) GetListResourceSchema(request Request, listResource string) (*tfjson.Schema, error) {
+	s.l.Info("Getting list resource schema", "request", request, "list_resource", listResource)
+	schemaResp, err := s.providerSchema(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schema: %w", err)
+	}
+
+	return listResourceSchema(schemaResp, listResource)
+}
+
 // GetProviderSchema retrieves the schema for the provider configuration.
 func (s *Server) GetProviderSchema(request Request) (*tfjson.ProviderSchema, error) {
 	s.l.Info("Getting provider schema", "request", request)
-	schemaResp, ok := s.sc[request]
-	if !ok {
-		if _, err := s.getSchema(request); err != nil {
-			return nil, fmt.Errorf("failed to read provider schema: %w", err)
-		}
-		schemaResp = s.sc[request]
+	schemaResp, err := s.providerSchema(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schema: %w", err)
 	}
 
 	return schemaResp, nil
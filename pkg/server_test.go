@@ -0,0 +1,340 @@
+package pkg
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/matt-FFFFFF/tfpluginschema/tfplugin6"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var testPlatform = fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH)
+
+func TestServerGet_UnpackedLocalProvider(t *testing.T) {
+	providersDir := t.TempDir()
+	binaryDir := filepath.Join(providersDir, "registry.terraform.io", "azure", "azapi", "2.5.0", testPlatform)
+	require.NoError(t, os.MkdirAll(binaryDir, 0750))
+	binary := filepath.Join(binaryDir, "terraform-provider-azapi_v2.5.0")
+	require.NoError(t, os.WriteFile(binary, []byte("binary"), 0600))
+
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetOffline(true)
+	s.AddProviderDir(providersDir)
+	request := Request{Namespace: "Azure", Name: "azapi", Version: "2.5.0"}
+	require.NoError(t, s.Get(request))
+	assert.Equal(t, binary, s.state.dlc[s.providerKey(request)])
+}
+
+func TestServerGet_PackedMirrorProvider(t *testing.T) {
+	mirrorDir := t.TempDir()
+	typeDir := filepath.Join(mirrorDir, "registry.terraform.io", "hashicorp", "random")
+	require.NoError(t, os.MkdirAll(typeDir, 0750))
+	writeProviderZip(t, filepath.Join(typeDir, fmt.Sprintf("terraform-provider-random_3.6.0_%s.zip", testPlatform)), "terraform-provider-random_v3.6.0_x5")
+
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetOffline(true)
+	s.AddProviderDir(mirrorDir)
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	require.NoError(t, s.Get(request))
+	providerPath := s.state.dlc[s.providerKey(request)]
+	assert.Equal(t, "terraform-provider-random_v3.6.0_x5", filepath.Base(providerPath))
+	content, err := os.ReadFile(providerPath)
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(content))
+}
+
+func TestServerGet_OfflineShouldNotFallbackToRegistry(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetOffline(true)
+	s.AddProviderDir(t.TempDir())
+	err := s.Get(Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"})
+	require.ErrorIs(t, err, ErrPluginNotFound)
+	assert.Contains(t, err.Error(), "network access is disabled")
+}
+
+func TestServerGet_LocalProviderVersionMismatchShouldNotBeUsed(t *testing.T) {
+	providersDir := t.TempDir()
+	binaryDir := filepath.Join(providersDir, "registry.terraform.io", "hashicorp", "azurerm", "4.36.0", testPlatform)
+	require.NoError(t, os.MkdirAll(binaryDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(binaryDir, "terraform-provider-azurerm_v4.36.0_x5"), []byte("binary"), 0600))
+
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetOffline(true)
+	s.AddProviderDir(providersDir)
+	err := s.Get(Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"})
+	assert.ErrorIs(t, err, ErrPluginNotFound)
+}
+
+func TestVersionOrLatest_OfflineShouldNotQueryRegistry(t *testing.T) {
+	s := NewServer(nil)
+	s.SetOffline(true)
+	_, err := versionOrLatest(s, "hashicorp", "azurerm", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "offline mode")
+	version, err := versionOrLatest(s, "hashicorp", "azurerm", "v4.37.0")
+	require.NoError(t, err)
+	assert.Equal(t, "4.37.0", version)
+}
+
+func writeProviderZip(t *testing.T, path, binaryName string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	w := zip.NewWriter(f)
+	fw, err := w.Create(binaryName)
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("binary"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func TestServerGet_ConcurrentCallsShouldShareOneResolution(t *testing.T) {
+	providersDir := t.TempDir()
+	binaryDir := filepath.Join(providersDir, "registry.terraform.io", "hashicorp", "random", "3.6.0", testPlatform)
+	require.NoError(t, os.MkdirAll(binaryDir, 0750))
+	binary := filepath.Join(binaryDir, "terraform-provider-random_v3.6.0_x5")
+	require.NoError(t, os.WriteFile(binary, []byte("binary"), 0600))
+
+	s := NewServer(nil)
+	defer s.Cleanup()
+	s.SetOffline(true)
+	s.AddProviderDir(providersDir)
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.Get(request)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	path, ok := s.providerPath(request)
+	assert.True(t, ok)
+	assert.Equal(t, binary, path)
+}
+
+func TestServer_ConcurrentSchemaQueriesShouldShareOneLoad(t *testing.T) {
+	cacheDir := t.TempDir()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	s := NewServer(nil)
+	s.SetOffline(true)
+	s.SetCacheDir(cacheDir)
+	require.NoError(t, s.saveCachedSchema(request, cachedTestSchema))
+
+	schemas := make([]*tfjson.Schema, 16)
+	var wg sync.WaitGroup
+	for i := range schemas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			schema, err := s.GetResourceSchema(request, "azurerm_resource_group")
+			assert.NoError(t, err)
+			schemas[i] = schema
+		}()
+	}
+	wg.Wait()
+	require.NotNil(t, schemas[0])
+	// The schema has been decoded once, every caller gets the same instance.
+	for _, schema := range schemas[1:] {
+		assert.Same(t, schemas[0], schema)
+	}
+}
+
+func TestRun_ConcurrentRunsShouldKeepTheirOwnServerSettings(t *testing.T) {
+	launcher := &fakePluginLauncher{schema: &tfplugin6.GetProviderSchema_Response{
+		ResourceSchemas: map[string]*tfplugin6.Schema{
+			"random_string": {Block: &tfplugin6.Schema_Block{Attributes: []*tfplugin6.Schema_Attribute{
+				{Name: "length", Type: []byte(`"number"`), Required: true},
+			}}},
+		},
+	}}
+	// The global stub resolves every provider to version 4.37.0.
+	request := Request{Namespace: "hashicorp", Name: "random", Version: "4.37.0"}
+	registry := newStandInRegistry(t, request)
+	s := NewServer(nil)
+	defer s.Cleanup()
+	stub := gostub.Stub(&Fs, afero.NewOsFs()).Stub(&tfPluginServer, s).Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	writeModule := func(hash string) string {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte("resource \"random_string\" \"this\" {\n  length = 4\n}\n"), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".terraform.lock.hcl"), []byte(fmt.Sprintf(`provider "registry.terraform.io/hashicorp/random" {
+  version = "4.37.0"
+  hashes  = [%q]
+}
+`, hash)), 0600))
+		return dir
+	}
+	// The offline module locks other hashes, it would fail the download of the online one if their lock files mixed.
+	offlineModule := writeModule(mismatchedHash)
+	onlineModule := writeModule("zh:" + registry.shasum(providerZipName(request)))
+
+	var wg sync.WaitGroup
+	offlineErrs := make([]error, 8)
+	onlineErrs := make([]error, 8)
+	for i := range offlineErrs {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, offlineErrs[i] = Run(offlineModule, Options{Offline: true, DryRun: true, RegistryURL: registry.URL + "/v1/providers"})
+		}()
+		go func() {
+			defer wg.Done()
+			_, onlineErrs[i] = Run(onlineModule, Options{DryRun: true, RegistryURL: registry.URL + "/v1/providers"})
+		}()
+	}
+	wg.Wait()
+	for i := range offlineErrs {
+		require.Error(t, offlineErrs[i])
+		assert.Contains(t, offlineErrs[i].Error(), "network access is disabled")
+		assert.NoError(t, onlineErrs[i])
+	}
+	// The provider is downloaded and launched once, the global server is left untouched.
+	assert.Equal(t, int32(1), registry.hits.Load())
+	assert.Len(t, launcher.launches(), 1)
+	assert.False(t, s.Offline())
+	assert.Empty(t, s.providerHashes(request))
+	assert.Equal(t, pluginApi, s.registryURL())
+	assert.Empty(t, s.initProviderDirs)
+}
+
+func TestDirectoryCheck_ShouldStopOnlyThePluginsItLaunched(t *testing.T) {
+	launcher := &fakePluginLauncher{schema: &tfplugin6.GetProviderSchema_Response{
+		ResourceSchemas: map[string]*tfplugin6.Schema{
+			"random_string": {Block: &tfplugin6.Schema_Block{Attributes: []*tfplugin6.Schema_Attribute{
+				{Name: "length", Type: []byte(`"number"`), Required: true},
+			}}},
+		},
+	}}
+	s := newLocalProviderServer(t, Request{Namespace: "hashicorp", Name: "random", Version: "4.37.0"})
+	defer s.Cleanup()
+	stub := gostub.Stub(&Fs, afero.NewOsFs()).Stub(&tfPluginServer, s).Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte("resource \"random_string\" \"this\" {\n  length = 4\n}\n"), 0600))
+
+	_, err := Run(dir, Options{DryRun: true})
+	require.NoError(t, err)
+	changes, err := DirectoryCheck(dir)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	// The plugin of the long-lived Run keeps running, the one launched by DirectoryCheck is stopped.
+	launches := launcher.launches()
+	require.Len(t, launches, 2)
+	assert.False(t, launches[0].closed.Load())
+	assert.True(t, launches[1].closed.Load())
+	assert.Len(t, s.state.plugins, 1)
+}
+
+func TestServerPrefetch_ShouldCacheSchemasAndJoinErrors(t *testing.T) {
+	cacheDir := t.TempDir()
+	cached := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	missing := Request{Namespace: "hashicorp", Name: "random", Version: "3.6.0"}
+	s := NewServer(nil)
+	s.SetOffline(true)
+	s.SetCacheDir(cacheDir)
+	require.NoError(t, s.saveCachedSchema(cached, cachedTestSchema))
+
+	err := s.Prefetch(cached, missing)
+	require.ErrorIs(t, err, ErrPluginNotFound)
+	assert.Contains(t, err.Error(), "hashicorp/random 3.6.0")
+	_, ok := s.cachedProviderSchema(cached)
+	assert.True(t, ok)
+	_, ok = s.cachedProviderSchema(missing)
+	assert.False(t, ok)
+}
+
+func TestDirectoryProviderRequests(t *testing.T) {
+	mockFs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(mockFs, "/module/main.tf", []byte(`resource "azurerm_resource_group" "a" {}
+
+resource "azurerm_resource_group" "b" {}
+
+data "azurerm_client_config" "current" {}
+
+resource "terraform_data" "this" {}
+
+locals {}
+`), 0644))
+	require.NoError(t, afero.WriteFile(mockFs, "/module/random.tf.json", []byte(`{"resource": {"random_string": {"this": {"length": 8}}}}`), 0644))
+	d := newDirectory("/module", nil)
+	d.fs = mockFs
+
+	requests, err := d.providerRequests()
+	require.NoError(t, err)
+	assert.Equal(t, []Request{
+		{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0", Hostname: defaultProviderHostname},
+		{Namespace: "hashicorp", Name: "random", Version: "4.37.0", Hostname: defaultProviderHostname},
+	}, requests)
+}
+
+func TestServerLoadSchema_ShouldReadResourceIdentitySchemas(t *testing.T) {
+	launcher := &fakePluginLauncher{identities: &tfplugin6.GetResourceIdentitySchemas_Response{
+		IdentitySchemas: map[string]*tfplugin6.ResourceIdentitySchema{
+			"azurerm_resource_group": {
+				Version: 1,
+				IdentityAttributes: []*tfplugin6.ResourceIdentitySchema_IdentityAttribute{
+					{Name: "name", Type: []byte(`"string"`), RequiredForImport: true},
+					{Name: "subscription_id", Type: []byte(`"string"`), OptionalForImport: true},
+				},
+			},
+		},
+	}}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	s := newLocalProviderServer(t, request)
+	defer s.Cleanup()
+
+	schema, err := s.GetResourceIdentitySchema(request, "azurerm_resource_group")
+	require.NoError(t, err)
+	assert.Equal(t, &tfjson.IdentitySchema{
+		Version: 1,
+		Attributes: map[string]*tfjson.IdentityAttribute{
+			"name":            {IdentityType: cty.String, RequiredForImport: true},
+			"subscription_id": {IdentityType: cty.String, OptionalForImport: true},
+		},
+	}, schema)
+	schema, err = s.GetResourceIdentitySchema(request, "azurerm_virtual_network")
+	require.NoError(t, err)
+	assert.Nil(t, schema)
+}
+
+func TestServerLoadSchema_ProviderWithoutResourceIdentityShouldStillWork(t *testing.T) {
+	launcher := &fakePluginLauncher{identityErr: fmt.Errorf("failed to get resource identity schemas: %w", status.Error(codes.Unimplemented, "unknown method"))}
+	stub := gostub.Stub(&newPluginClient, launcher.launch)
+	defer stub.Reset()
+	request := Request{Namespace: "hashicorp", Name: "azurerm", Version: "4.37.0"}
+	s := newLocalProviderServer(t, request)
+	defer s.Cleanup()
+
+	schema, err := s.GetResourceIdentitySchema(request, "azurerm_resource_group")
+	require.NoError(t, err)
+	assert.Nil(t, schema)
+	list, err := s.GetListResourceSchema(request, "azurerm_resource_group")
+	require.NoError(t, err)
+	assert.Nil(t, list)
+}
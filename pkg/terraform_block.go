@@ -51,6 +51,10 @@ func BuildTerraformBlock(block *HclBlock, file *HclFile) *TerraformBlock {
 	return r
 }
 
+func (b *TerraformBlock) rule() string {
+	return RuleRequiredProvidersOrder
+}
+
 func (b *TerraformBlock) AutoFix() error {
 	if b.RequiredProvidersBlock == nil {
 		return nil
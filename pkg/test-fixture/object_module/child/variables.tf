@@ -0,0 +1,33 @@
+variable "network" {
+  type = object({
+    name          = string
+    address_space = list(string)
+    dns_servers   = optional(list(string), [])
+    subnets = optional(list(object({
+      name             = string
+      address_prefixes = list(string)
+      nat_gateway = optional(object({
+        id = string
+      }))
+    })), [])
+  })
+}
+
+variable "role_assignments" {
+  type = map(object({
+    role_definition_id_or_name = string
+    principal_id               = string
+    description                = optional(string)
+  }))
+  default = {}
+}
+
+variable "tags" {
+  type    = map(string)
+  default = null
+}
+
+variable "legacy" {
+  type    = "list"
+  default = []
+}
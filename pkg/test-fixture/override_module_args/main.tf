@@ -0,0 +1,5 @@
+module "consul" {
+  source = "../local_module/test_module"
+
+  required_variable = "value"
+}
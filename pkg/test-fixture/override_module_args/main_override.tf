@@ -0,0 +1,6 @@
+module "consul" {
+  source = "../local_module/test_module"
+
+  removed_variable  = "value"
+  optional_variable = "value"
+}
@@ -0,0 +1,4 @@
+module "consul" {
+  removed_variable  = "value"
+  optional_variable = "value"
+}
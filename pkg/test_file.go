@@ -0,0 +1,234 @@
+package pkg
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// testFilesDir is the folder Terraform looks for test files in, besides the module folder.
+const testFilesDir = "tests"
+
+// runBlockItemPriorities is the canonical order of the arguments and nested blocks in a `run` block,
+// the others are kept after them in their original order.
+var runBlockItemPriorities = map[string]int{
+	"command":         0,
+	"module":          1,
+	"providers":       2,
+	"variables":       3,
+	"assert":          4,
+	"expect_failures": 5,
+}
+
+// isTestFile checks whether the file is a Terraform or OpenTofu test file, e.g. `tests/main.tftest.hcl`.
+func isTestFile(fileName string) bool {
+	return strings.HasSuffix(fileName, ".tftest.hcl") || strings.HasSuffix(fileName, ".tofutest.hcl")
+}
+
+// TestFile is the wrapper of a test file.
+type TestFile struct {
+	dir  *directory
+	File *HclFile
+}
+
+func BuildTestFile(f *HclFile) *TestFile {
+	return &TestFile{
+		dir:  f.dir,
+		File: f,
+	}
+}
+
+func (f *TestFile) AutoFix() error {
+	for i, b := range f.File.Body.(*hclsyntax.Body).Blocks {
+		block := f.File.GetBlock(i)
+		switch b.Type {
+		case "run":
+			if !f.dir.ruleEnabled(RuleTestRunOrder) {
+				continue
+			}
+			if err := f.fixRunBlock(block); err != nil {
+				return err
+			}
+		case "variables":
+			if !f.dir.ruleEnabled(RuleTestVariablesOrder) {
+				continue
+			}
+			if err := f.dir.applyRule(block, RuleTestVariablesOrder, func() error {
+				sortAttributesByName(block)
+				return nil
+			}); err != nil {
+				return err
+			}
+		case "mock_provider":
+			if !f.dir.ruleEnabled(RuleTestMockDefaultsOrder) {
+				continue
+			}
+			if err := f.dir.applyRule(block, RuleTestMockDefaultsOrder, func() error {
+				return f.fixMockProvider(block)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// testBlockItem is an argument or a nested block in a test file block.
+type testBlockItem struct {
+	name    string
+	isBlock bool
+	start   int
+	tokens  hclwrite.Tokens
+}
+
+func (f *TestFile) fixRunBlock(block *HclBlock) error {
+	nestedBlocks := block.NestedBlocks()
+	if f.dir.ruleEnabled(RuleTestVariablesOrder) {
+		if err := f.dir.applyRule(block, RuleTestVariablesOrder, func() error {
+			for _, nb := range nestedBlocks {
+				if nb.Type == "variables" {
+					sortAttributesByName(nb)
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return f.dir.applyRule(block, RuleTestRunOrder, func() error {
+		sortRunBlockItems(block, nestedBlocks)
+		return nil
+	})
+}
+
+// sortRunBlockItems puts the arguments and nested blocks of a `run` block in the canonical order.
+func sortRunBlockItems(block *HclBlock, nestedBlocks []*HclBlock) {
+	var items []testBlockItem
+	for _, attr := range block.Attributes() {
+		items = append(items, testBlockItem{
+			name:   attr.Name,
+			start:  attr.SrcRange.Start.Byte,
+			tokens: attr.WriteAttribute.BuildTokens(hclwrite.Tokens{}),
+		})
+	}
+	for _, nb := range nestedBlocks {
+		items = append(items, testBlockItem{
+			name:    nb.Type,
+			isBlock: true,
+			start:   nb.Range().Start.Byte,
+			tokens:  nb.WriteBlock.BuildTokens(hclwrite.Tokens{}),
+		})
+	}
+	if len(items) == 0 {
+		return
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].start < items[j].start
+	})
+	sort.SliceStable(items, func(i, j int) bool {
+		return runBlockItemPriority(items[i].name) < runBlockItemPriority(items[j].name)
+	})
+	block.Clear()
+	block.appendNewline()
+	for i, item := range items {
+		// Nested blocks are separated from the other items by an empty line.
+		if i > 0 && (item.isBlock || items[i-1].isBlock) {
+			block.appendNewline()
+		}
+		block.WriteBlock.Body().AppendUnstructuredTokens(item.tokens)
+	}
+}
+
+func runBlockItemPriority(name string) int {
+	if priority, ok := runBlockItemPriorities[name]; ok {
+		return priority
+	}
+	return len(runBlockItemPriorities)
+}
+
+// sortAttributesByName sorts the attributes in a block like `variables`, which contains attributes only.
+func sortAttributesByName(block *HclBlock) {
+	if len(block.Body.Blocks) > 0 || len(block.Body.Attributes) == 0 {
+		return
+	}
+	var args Args
+	for _, attribute := range attributesByLines(block.Attributes()) {
+		args = append(args, buildAttrArg(attribute, nil))
+	}
+	attributes := block.WriteBlock.Body().Attributes()
+	block.Clear()
+	block.appendNewline()
+	block.writeArgs(args.SortByName(), attributes)
+}
+
+// fixMockProvider sorts the `defaults` of `mock_resource` and `mock_data` blocks by the schema of the resource or the data source,
+// just like the arguments in a resource block.
+func (f *TestFile) fixMockProvider(block *HclBlock) error {
+	for _, nb := range block.NestedBlocks() {
+		var category string
+		switch nb.Type {
+		case "mock_resource":
+			category = "resource"
+		case "mock_data":
+			category = "data"
+		default:
+			continue
+		}
+		defaults, ok := nb.Attributes()["defaults"]
+		if !ok || len(nb.Labels) == 0 {
+			continue
+		}
+		schema, err := f.mockSchema(category, nb)
+		if err != nil {
+			if f.File.skipBlock(nb.Block, err) {
+				continue
+			}
+			return err
+		}
+		tokens := defaults.WriteAttribute.Expr().BuildTokens(hclwrite.Tokens{})
+		nb.WriteBlock.Body().SetAttributeRaw("defaults", sortObjectBySchema(tokens, schema))
+	}
+	return nil
+}
+
+func (f *TestFile) mockSchema(category string, block *HclBlock) (*tfjson.SchemaBlock, error) {
+	provider, err := resolveProvider(block, f.File)
+	if err != nil {
+		return nil, err
+	}
+	version, err := resolveProviderVersion(provider, f.File)
+	if err != nil {
+		return nil, err
+	}
+	return queryProviderBlockSchema(f.dir.schemaGetter(), []string{category, block.Labels[0]}, provider, version)
+}
+
+// sortObjectBySchema sorts the keys of an object describing a resource like the arguments in the resource block,
+// objects and lists of objects of nested blocks are sorted recursively.
+func sortObjectBySchema(tokens hclwrite.Tokens, schema *tfjson.SchemaBlock) hclwrite.Tokens {
+	return sortObjectTokens(tokens, func(a, b string) bool {
+		groupA, groupB := schemaItemGroupOf(a, schema, false), schemaItemGroupOf(b, schema, false)
+		if groupA != groupB {
+			return groupA < groupB
+		}
+		return a < b
+	}, func(key string, value hclwrite.Tokens) hclwrite.Tokens {
+		if schema == nil {
+			return value
+		}
+		nb, ok := schema.NestedBlocks[key]
+		if !ok {
+			return value
+		}
+		sortNested := func(object hclwrite.Tokens) hclwrite.Tokens {
+			return sortObjectBySchema(object, nb.Block)
+		}
+		if len(value) > 0 && value[0].Type == hclsyntax.TokenOBrack {
+			return mapTupleObjects(value, sortNested)
+		}
+		return sortNested(value)
+	})
+}
@@ -0,0 +1,190 @@
+package pkg_test
+
+import (
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const unsortedTestFile = `variables {
+  name     = "rg"
+  # The location of the resources
+  location = "eastus"
+}
+
+mock_provider "azurerm" {
+  mock_resource "azurerm_resource_group" {
+    defaults = {
+      tags     = {}
+      id       = "/subscriptions/x"
+      name     = "rg" # the name
+      location = "eastus"
+    }
+  }
+  mock_resource "azurerm_kubernetes_cluster" {
+    defaults = {
+      identity = [{
+        identity_ids = []
+        type         = "UserAssigned"
+      }]
+      default_node_pool = {
+        vm_size = "Standard_D2_v2"
+        name    = "default"
+      }
+      location = "eastus"
+    }
+  }
+  mock_data "azurerm_client_config" {
+    defaults = { tenant_id = "t", client_id = "c" }
+  }
+}
+
+run "plan" {
+  assert {
+    condition     = true
+    error_message = "first"
+  }
+
+  assert {
+    condition     = true
+    error_message = "second"
+  }
+  expect_failures = [var.name]
+  variables {
+    name     = "b"
+    location = "westus"
+  }
+  providers = {
+    azurerm = azurerm
+  }
+  module {
+    source = "./"
+  }
+  command = plan
+}
+`
+
+const sortedTestFile = `variables {
+  # The location of the resources
+  location = "eastus"
+  name     = "rg"
+}
+
+mock_provider "azurerm" {
+  mock_resource "azurerm_resource_group" {
+    defaults = {
+      location = "eastus"
+      name     = "rg" # the name
+      id       = "/subscriptions/x"
+      tags     = {}
+    }
+  }
+  mock_resource "azurerm_kubernetes_cluster" {
+    defaults = {
+      location = "eastus"
+      default_node_pool = {
+        name    = "default"
+        vm_size = "Standard_D2_v2"
+      }
+      identity = [{
+        type         = "UserAssigned"
+        identity_ids = []
+      }]
+    }
+  }
+  mock_data "azurerm_client_config" {
+    defaults = { client_id = "c", tenant_id = "t" }
+  }
+}
+
+run "plan" {
+  command = plan
+
+  module {
+    source = "./"
+  }
+
+  providers = {
+    azurerm = azurerm
+  }
+
+  variables {
+    location = "westus"
+    name     = "b"
+  }
+
+  assert {
+    condition     = true
+    error_message = "first"
+  }
+
+  assert {
+    condition     = true
+    error_message = "second"
+  }
+
+  expect_failures = [var.name]
+}
+`
+
+func TestRunShouldFixTestFiles(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf":                 sortedLocals,
+		"/module/tests/main.tftest.hcl":   unsortedTestFile,
+		"/module/unit.tftest.hcl":         unsortedTestFile,
+		"/module/tests/helper/main.tf":    unsortedLocals,
+		"/module/tests/legacy.tftest.hcl": unsortedTestFile,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	result, err := pkg.Run("/module", pkg.Options{
+		ExcludePatterns: []string{"legacy.tftest.hcl"},
+	})
+	require.NoError(t, err)
+	for _, name := range []string{"/module/tests/main.tftest.hcl", "/module/unit.tftest.hcl"} {
+		content, err := afero.ReadFile(mockFs, name)
+		require.NoError(t, err)
+		assert.Equal(t, sortedTestFile, string(content), name)
+	}
+	for name, expected := range map[string]string{
+		"/module/tests/legacy.tftest.hcl": unsortedTestFile,
+		"/module/tests/helper/main.tf":    unsortedLocals,
+	} {
+		content, err := afero.ReadFile(mockFs, name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content), name)
+	}
+	rules := make(map[string][]string)
+	for _, fix := range result.Fixes {
+		if fix.File == "/module/tests/main.tftest.hcl" {
+			rules[fix.Block] = append(rules[fix.Block], fix.Rule)
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"variables":             {pkg.RuleTestVariablesOrder},
+		"mock_provider.azurerm": {pkg.RuleTestMockDefaultsOrder},
+		"run.plan":              {pkg.RuleTestVariablesOrder, pkg.RuleTestRunOrder},
+	}, rules)
+}
+
+func TestRunWithDisabledTestRulesShouldKeepTestFiles(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf":               sortedLocals,
+		"/module/tests/main.tftest.hcl": unsortedTestFile,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{
+		DisabledRules: []string{pkg.RuleTestRunOrder, pkg.RuleTestVariablesOrder, pkg.RuleTestMockDefaultsOrder},
+	})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/tests/main.tftest.hcl")
+	require.NoError(t, err)
+	assert.Equal(t, formatHcl(unsortedTestFile), string(content))
+}
@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"strings"
+)
+
+// isConfigFile checks whether the file is a Terraform or OpenTofu configuration file in native or JSON syntax.
+func isConfigFile(fileName string) bool {
+	return configFileExtension(fileName) != ""
+}
+
+// configFileExtension returns the extension of a configuration file, OpenTofu reads `.tofu` and `.tofu.json` files too.
+func configFileExtension(fileName string) string {
+	for _, ext := range []string{".tf.json", ".tofu.json", ".tf", ".tofu"} {
+		if strings.HasSuffix(fileName, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// tofuFileName returns the `.tofu`, `.tofu.json` or `.tofutest.hcl` file taking precedence over the `.tf`, `.tf.json` or `.tftest.hcl` file,
+// OpenTofu ignores `main.tf` if there is `main.tofu` in the same folder. An empty string is returned for other files.
+func tofuFileName(fileName string) string {
+	if strings.HasSuffix(fileName, ".tftest.hcl") {
+		return strings.TrimSuffix(fileName, ".tftest.hcl") + ".tofutest.hcl"
+	}
+	switch configFileExtension(fileName) {
+	case ".tf":
+		return strings.TrimSuffix(fileName, ".tf") + ".tofu"
+	case ".tf.json":
+		return strings.TrimSuffix(fileName, ".tf.json") + ".tofu.json"
+	}
+	return ""
+}
+
+// isOverrideFile checks whether the file is an override file like `override.tf` or `foo_override.tf`.
+// Blocks in an override file are merged into the blocks with the same address in other files,
+// so they're only sorted in place, they're never moved into another file and no argument is removed from them.
+func isOverrideFile(fileName string) bool {
+	ext := configFileExtension(fileName)
+	if ext == "" {
+		return false
+	}
+	name := strings.TrimSuffix(fileName, ext)
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return name == "override" || strings.HasSuffix(name, "_override")
+}
+
+// shadowedFiles returns the files ignored by OpenTofu because of a `.tofu` file with the same base name.
+func shadowedFiles(fileNames []string) map[string]bool {
+	names := make(map[string]bool, len(fileNames))
+	for _, name := range fileNames {
+		names[name] = true
+	}
+	r := make(map[string]bool)
+	for _, name := range fileNames {
+		if tofu := tofuFileName(name); tofu != "" && names[tofu] {
+			r[name] = true
+		}
+	}
+	return r
+}
+
+// effectiveFileName returns the `.tofu` file if it's been loaded and takes precedence over the file,
+// so blocks are never moved into a file that would be ignored.
+func (d *directory) effectiveFileName(fileName string) string {
+	if tofu := tofuFileName(fileName); tofu != "" {
+		if _, ok := d.tfFiles[tofu]; ok {
+			return tofu
+		}
+	}
+	return fileName
+}
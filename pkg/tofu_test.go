@@ -0,0 +1,130 @@
+package pkg_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lonegunmanb/avmfix/pkg"
+	"github.com/prashantv/gostub"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunShouldPreferTofuFileOverTfFileWithSameBaseName(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf":     unsortedLocals,
+		"/module/main.tofu":   unsortedLocals,
+		"/module/extra.tofu":  unsortedLocals,
+		"/module/legacy.tf":   unsortedLocals,
+		"/module/a.tf.json":   `{"variable": {"b": {}, "a": {}}}`,
+		"/module/a.tofu.json": `{"variable": {"b": {}, "a": {}}}`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{})
+	require.NoError(t, err)
+	for _, fixed := range []string{"/module/main.tofu", "/module/extra.tofu", "/module/legacy.tf"} {
+		content, err := afero.ReadFile(mockFs, fixed)
+		require.NoError(t, err)
+		assert.Equal(t, formatHcl(sortedLocals), formatHcl(string(content)), fixed)
+	}
+	content, err := afero.ReadFile(mockFs, "/module/main.tf")
+	require.NoError(t, err)
+	assert.Equal(t, unsortedLocals, string(content))
+	content, err = afero.ReadFile(mockFs, "/module/a.tf.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"variable": {"b": {}, "a": {}}}`, string(content))
+	content, err = afero.ReadFile(mockFs, "/module/a.tofu.json")
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"a": {},`)
+}
+
+func TestRunShouldMoveVariablesIntoTofuFileShadowingTheDestination(t *testing.T) {
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tofu":      nullableVariable,
+		"/module/variables.tf":   "",
+		"/module/variables.tofu": "",
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{})
+	require.NoError(t, err)
+	content, err := afero.ReadFile(mockFs, "/module/variables.tofu")
+	require.NoError(t, err)
+	assert.Equal(t, `variable "name" {
+  type = string
+}`, strings.TrimSpace(string(content)))
+	content, err = afero.ReadFile(mockFs, "/module/variables.tf")
+	require.NoError(t, err)
+	assert.Empty(t, content)
+}
+
+func TestRunShouldOnlySortOverrideFilesInPlace(t *testing.T) {
+	overrideContent := `variable "name" {
+  nullable  = true
+  sensitive = false
+  type      = string
+}
+
+output "name" {
+  value       = var.name
+  sensitive   = false
+  description = "name"
+}
+`
+	sortedOverrideContent := `variable "name" {
+  type      = string
+  nullable  = true
+  sensitive = false
+}
+
+output "name" {
+  description = "name"
+  sensitive   = false
+  value       = var.name
+}
+`
+	mockFs := fakeFs(map[string]string{
+		"/module/main.tf":           unsortedLocals,
+		"/module/override.tf":       overrideContent,
+		"/module/foo_override.tofu": overrideContent,
+		"/module/variables_override.tf": `variable "name" {
+  type = number
+}
+
+locals {
+  b = "b"
+  a = "a"
+}
+`,
+	})
+	stub := gostub.Stub(&pkg.Fs, mockFs)
+	defer stub.Reset()
+
+	_, err := pkg.Run("/module", pkg.Options{})
+	require.NoError(t, err)
+	for _, name := range []string{"/module/override.tf", "/module/foo_override.tofu"} {
+		content, err := afero.ReadFile(mockFs, name)
+		require.NoError(t, err)
+		assert.Equal(t, sortedOverrideContent, string(content), name)
+	}
+	content, err := afero.ReadFile(mockFs, "/module/variables_override.tf")
+	require.NoError(t, err)
+	assert.Equal(t, `variable "name" {
+  type = number
+}
+
+locals {
+  a = "a"
+  b = "b"
+}
+`, string(content))
+	for _, name := range []string{"/module/variables.tf", "/module/outputs.tf"} {
+		exists, err := afero.Exists(mockFs, name)
+		require.NoError(t, err)
+		assert.False(t, exists, name)
+	}
+}
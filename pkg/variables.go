@@ -2,6 +2,8 @@ package pkg
 
 import (
 	"fmt"
+	"slices"
+
 	"github.com/ahmetb/go-linq/v3"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
@@ -29,18 +31,31 @@ func BuildVariablesFile(f *HclFile) *VariablesFile {
 
 func (f *VariablesFile) AutoFix() error {
 	variableBlocks := make([]*VariableBlock, 0)
+	// layout keeps the blocks in the order of the file, nil marks the place of a variable.
+	var layout []*HclBlock
 	for i := 0; i < len(f.File.WriteFile.Body().Blocks()); i++ {
 		block := f.File.GetBlock(i)
 		if block.Type != "variable" {
-			f.dir.AppendBlockToFile("main.tf", block)
+			if f.dir.ruleEnabled(RuleVariableFilePlacement) {
+				f.dir.recordFix(block.Block, RuleVariableFilePlacement)
+				f.dir.AppendBlockToFile("main.tf", block)
+			} else {
+				layout = append(layout, block)
+			}
 			continue
 		}
 		b := BuildVariableBlock(f.File.File, block)
-		if err := b.AutoFix(); err != nil {
+		b.dir = f.dir
+		if err := f.File.autoFixBlock(b, block); err != nil {
 			return err
 		}
 		variableBlocks = append(variableBlocks, b)
+		layout = append(layout, nil)
+	}
+	if !f.dir.ruleEnabled(RuleVariableOrder) {
+		return f.write(variableBlocks, layout)
 	}
+	original := slices.Clone(variableBlocks)
 	linq.From(variableBlocks).OrderBy(func(i interface{}) interface{} {
 		variableBlock := i.(*VariableBlock)
 		name := variableBlock.Block.Labels[0]
@@ -51,15 +66,35 @@ func (f *VariablesFile) AutoFix() error {
 		}
 		return fmt.Sprintf("%s_%s", prefix, name)
 	}).ToSlice(&variableBlocks)
+	for i, b := range variableBlocks {
+		if b != original[i] {
+			f.dir.recordFix(b.Block.Block, RuleVariableOrder)
+		}
+	}
+	return f.write(variableBlocks, layout)
+}
+
+// write rewrites the file with the variables in the places of the variables in layout, the other blocks kept
+// when variable-file-placement is disabled stay where they were.
+func (f *VariablesFile) write(variableBlocks []*VariableBlock, layout []*HclBlock) error {
+	blocks := make([]*HclBlock, 0, len(layout))
+	next := 0
+	for _, block := range layout {
+		if block == nil {
+			block = variableBlocks[next].Block
+			next++
+		}
+		blocks = append(blocks, block)
+	}
 
 	f.File.ClearWriteFile()
 
-	for i, variableBlock := range variableBlocks {
+	for i, block := range blocks {
 		if i != 0 {
 			f.File.appendNewline()
 		}
-		f.File.appendBlock(variableBlock.Block)
-		if !endWithNewLine(variableBlock.Block.WriteBlock) {
+		f.File.appendBlock(block)
+		if !endWithNewLine(block.WriteBlock) {
 			f.File.appendNewline()
 		}
 	}
@@ -67,6 +102,9 @@ func (f *VariablesFile) AutoFix() error {
 }
 
 type VariableBlock struct {
+	dir *directory
+	// overriding is true for a variable in an override file, its arguments are sorted but never removed.
+	overriding bool
 	Block      *HclBlock
 	Attributes Args
 }
@@ -82,18 +120,38 @@ func BuildVariableBlock(f *hcl.File, b *HclBlock) *VariableBlock {
 }
 
 func (b *VariableBlock) AutoFix() error {
-	b.sortArguments()
-	b.removeUnnecessaryNullable()
-	b.removeUnnecessarySensitive()
+	var applied []string
+	if b.dir.ruleEnabled(RuleVariableOrder) && b.sortArguments() {
+		applied = append(applied, RuleVariableOrder)
+	}
+	if b.dir.ruleEnabled(RuleVariableNullable) && !b.overriding && b.removeUnnecessaryNullable() {
+		applied = append(applied, RuleVariableNullable)
+	}
+	if b.dir.ruleEnabled(RuleVariableSensitive) && !b.overriding && b.removeUnnecessarySensitive() {
+		applied = append(applied, RuleVariableSensitive)
+	}
+	// Arguments already in order might still be rewritten in a new layout, e.g. without blank lines between them.
+	if len(applied) == 0 && b.dir.ruleEnabled(RuleVariableOrder) {
+		return b.dir.applyRule(b.Block, RuleVariableOrder, func() error {
+			b.write()
+			return nil
+		})
+	}
 	b.write()
+	for _, rule := range applied {
+		b.dir.recordFix(b.Block.Block, rule)
+	}
 	return nil
 }
 
-func (b *VariableBlock) sortArguments() {
+// sortArguments returns true if the order of the arguments has been changed.
+func (b *VariableBlock) sortArguments() bool {
+	original := slices.Clone(b.Attributes)
 	linq.From(b.Attributes).OrderBy(func(i interface{}) interface{} {
 		attr := i.(*Arg)
 		return variableAttributePriorities[attr.Name]
 	}).ToSlice(&b.Attributes)
+	return !slices.Equal(original, b.Attributes)
 }
 
 func (b *VariableBlock) write() {
@@ -110,7 +168,8 @@ func (b *VariableBlock) write() {
 	}
 }
 
-func (b *VariableBlock) removeUnnecessaryNullable() {
+// removeUnnecessaryNullable returns true if `nullable = true` has been removed.
+func (b *VariableBlock) removeUnnecessaryNullable() bool {
 	for i := 0; i < len(b.Attributes); i++ {
 		attr := b.Attributes[i]
 		if attr.Name != "nullable" {
@@ -119,12 +178,15 @@ func (b *VariableBlock) removeUnnecessaryNullable() {
 		literal, ok := attr.Expr.(*hclsyntax.LiteralValueExpr)
 		if ok && literal.Val.True() {
 			b.Attributes = removeIndex(b.Attributes, i)
+			return true
 		}
-		return
+		return false
 	}
+	return false
 }
 
-func (b *VariableBlock) removeUnnecessarySensitive() {
+// removeUnnecessarySensitive returns true if `sensitive = false` has been removed.
+func (b *VariableBlock) removeUnnecessarySensitive() bool {
 	for i := 0; i < len(b.Attributes); i++ {
 		attr := b.Attributes[i]
 		if attr.Name != "sensitive" {
@@ -133,9 +195,11 @@ func (b *VariableBlock) removeUnnecessarySensitive() {
 		literal, ok := attr.Expr.(*hclsyntax.LiteralValueExpr)
 		if ok && literal.Val.False() {
 			b.Attributes = removeIndex(b.Attributes, i)
+			return true
 		}
-		return
+		return false
 	}
+	return false
 }
 
 func isRequiredVariableBlock(b *hclsyntax.Block) bool {
@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Warning describes a block that has been left untouched in fail-soft mode, or a block violating a rule avmfix cannot fix.
+type Warning struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// Block is the address of the block, e.g. `resource.azurerm_resource_group.this`.
+	Block  string `json:"block"`
+	Reason string `json:"reason"`
+	// Rule is the id of the violated rule, it's empty for skipped blocks.
+	Rule string `json:"rule,omitempty"`
+}
+
+func (w Warning) String() string {
+	if w.Rule != "" {
+		return fmt.Sprintf("%s:%d: %s: %s (%s)", w.File, w.Line, w.Block, w.Reason, w.Rule)
+	}
+	return fmt.Sprintf("%s:%d: %s skipped: %s", w.File, w.Line, w.Block, w.Reason)
+}
+
+func blockAddress(b *hclsyntax.Block) string {
+	return strings.Join(append([]string{b.Type}, b.Labels...), ".")
+}
+
+// skipBlock records a warning and returns true if the block could be left untouched, that's only allowed in fail-soft mode.
+func (f *HclFile) skipBlock(b *hclsyntax.Block, reason error) bool {
+	if f.dir == nil || !f.dir.failSoft {
+		return false
+	}
+	f.dir.warn(Warning{
+		File:   f.FileName,
+		Line:   b.DefRange().Start.Line,
+		Block:  blockAddress(b),
+		Reason: reason.Error(),
+	})
+	return true
+}
+
+// warn records the warning once, AutoFix runs more than once so the same block could be skipped again.
+func (d *directory) warn(w Warning) {
+	for _, existing := range d.warnings {
+		if existing.File == w.File && existing.Block == w.Block && existing.Rule == w.Rule {
+			return
+		}
+	}
+	d.warnings = append(d.warnings, w)
+}